@@ -34,6 +34,8 @@ type Context interface {
 	NotFound() Response
 	Acknowledge() Response
 	Nil() Response
+	// the IP address of the client that made the request
+	ClientIP() string
 }
 
 type Response interface {
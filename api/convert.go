@@ -36,6 +36,12 @@ func makeJSONRPCDoc(methods map[string]*jsonrpc.Method, api *API) interface{} {
 	}
 }
 
+func makeJSONRPCOpenAPI(spec *Spec) interface{} {
+	return func(context services.Context, params *APIDocParams) services.Response {
+		return context.Result(spec)
+	}
+}
+
 func (c *API) ToJSONRPC(validateSettings *services.ValidateSettings) (jsonrpc.Handler, error) {
 	methods := map[string]*jsonrpc.Method{}
 	for _, endpoint := range c.Endpoints {
@@ -48,6 +54,10 @@ func (c *API) ToJSONRPC(validateSettings *services.ValidateSettings) (jsonrpc.Ha
 		Form:    APIDocForm,
 		Handler: makeJSONRPCDoc(methods, c),
 	}
+	methods["_openapi"] = &jsonrpc.Method{
+		Form:    APIDocForm,
+		Handler: makeJSONRPCOpenAPI(c.OpenAPI()),
+	}
 	return jsonrpc.MethodsHandler(methods, validateSettings)
 }
 
@@ -0,0 +1,495 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"github.com/kiprotect/go-helpers/forms"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// OpenAPI 3 specification of an API. We only model the parts of the
+// specification that we actually generate.
+type Spec struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       *SpecInfo            `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components *Components          `json:"components"`
+}
+
+type SpecInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                   `json:"operationId"`
+	Summary     string                   `json:"summary,omitempty"`
+	Tags        []string                 `json:"tags,omitempty"`
+	Parameters  []*Parameter             `json:"parameters,omitempty"`
+	RequestBody *RequestBody             `json:"requestBody,omitempty"`
+	Responses   map[string]*ResponseSpec `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Schema      Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type ResponseSpec struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas map[string]Schema `json:"schemas"`
+}
+
+// A JSON schema
+type Schema map[string]interface{}
+
+const jsonContentType = "application/json"
+
+var restParamRegexp = regexp.MustCompile(`<([a-zA-Z0-9_]+)>`)
+
+func ref(name string) Schema {
+	return Schema{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(schema Schema) map[string]*MediaType {
+	return map[string]*MediaType{
+		jsonContentType: &MediaType{Schema: schema},
+	}
+}
+
+// Generates an OpenAPI specification for the REST and JSON-RPC interfaces of
+// the API. Request schemas are derived from the endpoint forms, response
+// schemas from the return type validators.
+func (c *API) OpenAPI() *Spec {
+
+	spec := &Spec{
+		OpenAPI: "3.1.0",
+		Info: &SpecInfo{
+			Title:       c.Name,
+			Description: c.Description,
+			Version:     fmt.Sprintf("%d", c.Version),
+		},
+		Paths: map[string]*PathItem{},
+		Components: &Components{
+			Schemas: map[string]Schema{
+				"Error": Schema{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"message": Schema{"type": "string"},
+						"data":    Schema{},
+					},
+					"required": []string{"message"},
+				},
+				"JSONRPCError": Schema{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"code":    Schema{"type": "integer"},
+						"message": Schema{"type": "string"},
+						"data":    Schema{},
+					},
+					"required": []string{"code", "message"},
+				},
+			},
+		},
+	}
+
+	requests := []interface{}{}
+	responses := []interface{}{}
+	mapping := map[string]string{}
+
+	for _, endpoint := range c.Endpoints {
+
+		paramsSchema := FormSchema(endpoint.Form)
+		resultSchema := Schema{}
+
+		if endpoint.ReturnType != nil {
+			resultSchema, _ = ValidatorsSchema(endpoint.ReturnType.Validators)
+		}
+
+		spec.Components.Schemas[endpoint.Name+"Params"] = paramsSchema
+		spec.Components.Schemas[endpoint.Name+"Result"] = resultSchema
+
+		spec.Components.Schemas[endpoint.Name+"Request"] = Schema{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"jsonrpc": Schema{"const": "2.0"},
+				"id":      Schema{},
+				"method":  Schema{"const": endpoint.Name},
+				"params":  ref(endpoint.Name + "Params"),
+			},
+			// requests without an ID are notifications
+			"required": []string{"jsonrpc", "method", "params"},
+		}
+
+		spec.Components.Schemas[endpoint.Name+"Response"] = Schema{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"jsonrpc": Schema{"const": "2.0"},
+				"id":      Schema{},
+				"result":  ref(endpoint.Name + "Result"),
+				"error":   ref("JSONRPCError"),
+			},
+			"required": []string{"jsonrpc"},
+		}
+
+		requests = append(requests, ref(endpoint.Name+"Request"))
+		responses = append(responses, ref(endpoint.Name+"Response"))
+		mapping[endpoint.Name] = "#/components/schemas/" + endpoint.Name + "Request"
+
+		if endpoint.REST == nil {
+			continue
+		}
+
+		path := "/" + restParamRegexp.ReplaceAllString(endpoint.REST.Path, "{$1}")
+
+		pathItem, ok := spec.Paths[path]
+
+		if !ok {
+			pathItem = &PathItem{}
+			spec.Paths[path] = pathItem
+		}
+
+		(*pathItem)[strings.ToLower(string(endpoint.REST.Method))] = restOperation(endpoint, paramsSchema)
+	}
+
+	spec.Components.Schemas["JSONRPCRequest"] = Schema{
+		"oneOf": requests,
+		"discriminator": map[string]interface{}{
+			"propertyName": "method",
+			"mapping":      mapping,
+		},
+	}
+
+	spec.Components.Schemas["JSONRPCResponse"] = Schema{
+		"oneOf": responses,
+	}
+
+	// requests can be sent individually or as a batch
+	spec.Paths["/jsonrpc"] = &PathItem{
+		"post": &Operation{
+			OperationID: "jsonrpc",
+			Summary:     "Calls an endpoint via JSON-RPC 2.0, using the endpoint name as method.",
+			Tags:        []string{"jsonrpc"},
+			RequestBody: &RequestBody{
+				Required: true,
+				Content: jsonContent(Schema{
+					"oneOf": []interface{}{
+						ref("JSONRPCRequest"),
+						Schema{"type": "array", "items": ref("JSONRPCRequest")},
+					},
+				}),
+			},
+			Responses: map[string]*ResponseSpec{
+				"200": &ResponseSpec{
+					Description: "The JSON-RPC response(s).",
+					Content: jsonContent(Schema{
+						"oneOf": []interface{}{
+							ref("JSONRPCResponse"),
+							Schema{"type": "array", "items": ref("JSONRPCResponse")},
+						},
+					}),
+				},
+				"204": &ResponseSpec{
+					Description: "The request only contained notifications.",
+				},
+			},
+		},
+	}
+
+	return spec
+}
+
+func restOperation(endpoint *Endpoint, paramsSchema Schema) *Operation {
+
+	operation := &Operation{
+		OperationID: endpoint.Name,
+		Summary:     endpoint.Description,
+		Tags:        []string{"rest"},
+		Responses: map[string]*ResponseSpec{
+			"200": &ResponseSpec{
+				Description: "The result of the call.",
+				Content:     jsonContent(ref(endpoint.Name + "Result")),
+			},
+			"default": &ResponseSpec{
+				Description: "An error.",
+				Content:     jsonContent(ref("Error")),
+			},
+		},
+	}
+
+	properties, _ := paramsSchema["properties"].(map[string]interface{})
+	required := map[string]bool{}
+
+	if requiredList, ok := paramsSchema["required"].([]string); ok {
+		for _, name := range requiredList {
+			required[name] = true
+		}
+	}
+
+	pathParams := map[string]bool{}
+
+	for _, match := range restParamRegexp.FindAllStringSubmatch(endpoint.REST.Path, -1) {
+		name := match[1]
+		pathParams[name] = true
+		schema, _ := properties[name].(Schema)
+		operation.Parameters = append(operation.Parameters, &Parameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   schema,
+		})
+	}
+
+	names := make([]string, 0, len(properties))
+
+	for name := range properties {
+		if !pathParams[name] {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	// GET requests pass the remaining parameters in the query string, all
+	// other requests in a JSON body
+	if endpoint.REST.Method == GET {
+		for _, name := range names {
+			schema, _ := properties[name].(Schema)
+			operation.Parameters = append(operation.Parameters, &Parameter{
+				Name:     name,
+				In:       "query",
+				Required: required[name],
+				Schema:   schema,
+			})
+		}
+		return operation
+	}
+
+	if len(pathParams) == 0 {
+		operation.RequestBody = &RequestBody{
+			Required: true,
+			Content:  jsonContent(ref(endpoint.Name + "Params")),
+		}
+		return operation
+	}
+
+	bodyProperties := map[string]interface{}{}
+	bodyRequired := []string{}
+
+	for _, name := range names {
+		bodyProperties[name] = properties[name]
+		if required[name] {
+			bodyRequired = append(bodyRequired, name)
+		}
+	}
+
+	bodySchema := Schema{
+		"type":       "object",
+		"properties": bodyProperties,
+	}
+
+	if len(bodyRequired) > 0 {
+		bodySchema["required"] = bodyRequired
+	}
+
+	operation.RequestBody = &RequestBody{
+		Required: true,
+		Content:  jsonContent(bodySchema),
+	}
+
+	return operation
+}
+
+// Returns the JSON schema of a form
+func FormSchema(form *forms.Form) Schema {
+	return (&schemaBuilder{forms: map[*forms.Form]bool{}}).form(form)
+}
+
+// Returns the JSON schema of a value described by the given validators, and
+// whether the value is optional.
+func ValidatorsSchema(validators []forms.Validator) (Schema, bool) {
+	return (&schemaBuilder{forms: map[*forms.Form]bool{}}).validators(validators)
+}
+
+// Validators that are not part of go-helpers can implement this interface to
+// describe the values they accept.
+type SchemaDescriber interface {
+	JSONSchema() map[string]interface{}
+}
+
+type schemaBuilder struct {
+	// the forms we're currently converting, to handle recursive forms
+	forms map[*forms.Form]bool
+}
+
+func (s *schemaBuilder) form(form *forms.Form) Schema {
+
+	schema := Schema{"type": "object"}
+
+	if form == nil || s.forms[form] {
+		return schema
+	}
+
+	s.forms[form] = true
+	defer delete(s.forms, form)
+
+	properties := map[string]interface{}{}
+	required := []string{}
+
+	for _, field := range form.Fields {
+		fieldSchema, optional := s.validators(field.Validators)
+		if field.Description != "" {
+			fieldSchema["description"] = field.Description
+		}
+		properties[field.Name] = fieldSchema
+		if !optional {
+			required = append(required, field.Name)
+		}
+	}
+
+	schema["properties"] = properties
+
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	if form.Strict {
+		schema["additionalProperties"] = false
+	}
+
+	return schema
+}
+
+// Validators are applied in order, so the first validator that checks the type
+// of a value determines its type on the wire. If a string is later decoded to
+// a structured value (e.g. signed JSON data) we describe it as JSON content.
+func (s *schemaBuilder) validators(validators []forms.Validator) (Schema, bool) {
+
+	schema := Schema{}
+	optional := false
+
+	setType := func(typeSchema Schema) {
+		if _, ok := schema["type"]; !ok {
+			for k, v := range typeSchema {
+				schema[k] = v
+			}
+		} else if schema["type"] == "string" && (typeSchema["type"] == "object" || typeSchema["type"] == "array") {
+			schema["contentMediaType"] = jsonContentType
+			schema["contentSchema"] = typeSchema
+		}
+	}
+
+	isString := func() bool {
+		return schema["type"] == "string"
+	}
+
+	for _, validator := range validators {
+		switch v := validator.(type) {
+		case forms.IsOptional:
+			optional = true
+			if v.Default != nil {
+				schema["default"] = v.Default
+			}
+		case forms.IsString:
+			setType(Schema{"type": "string"})
+			if isString() && v.MinLength > 0 {
+				schema["minLength"] = v.MinLength
+			}
+			if isString() && v.MaxLength > 0 {
+				schema["maxLength"] = v.MaxLength
+			}
+		case forms.IsBoolean:
+			setType(Schema{"type": "boolean"})
+		case forms.IsInteger:
+			setType(Schema{"type": "integer"})
+			if v.HasMin {
+				schema["minimum"] = v.Min
+			}
+			if v.HasMax {
+				schema["maximum"] = v.Max
+			}
+		case forms.IsFloat:
+			setType(Schema{"type": "number"})
+			if v.HasMin {
+				schema["minimum"] = v.Min
+			}
+			if v.HasMax {
+				schema["maximum"] = v.Max
+			}
+		case forms.IsIn:
+			schema["enum"] = v.Choices
+		case forms.IsTime:
+			setType(Schema{"type": "string", "format": "date-time"})
+		case forms.IsBytes:
+			if v.Encoding == "hex" {
+				setType(Schema{"type": "string", "contentEncoding": "base16"})
+			} else {
+				setType(Schema{"type": "string", "contentEncoding": "base64", "format": "byte"})
+			}
+		case forms.MatchesRegex:
+			if v.Regexp != nil {
+				schema["pattern"] = v.Regexp.String()
+			}
+		case forms.IsStringList:
+			setType(Schema{"type": "array", "items": Schema{"type": "string"}})
+		case forms.IsList:
+			items, _ := s.validators(v.Validators)
+			setType(Schema{"type": "array", "items": items})
+		case forms.IsStringMap:
+			setType(s.form(v.Form))
+		case forms.Switch:
+			keys := make([]string, 0, len(v.Cases))
+			for key := range v.Cases {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			cases := make([]interface{}, len(keys))
+			for i, key := range keys {
+				cases[i], _ = s.validators(v.Cases[key])
+			}
+			schema["oneOf"] = cases
+		case SchemaDescriber:
+			setType(v.JSONSchema())
+		}
+	}
+
+	return schema, optional
+}
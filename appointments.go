@@ -19,7 +19,9 @@
 package services
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"github.com/kiebitz-oss/services/crypto"
 	"time"
 )
@@ -146,6 +148,21 @@ type MediatorKeyData struct {
 	Encryption []byte `json:"encryption"`
 }
 
+// RevokeMediatorPublicKey
+
+type RevokeMediatorPublicKeySignedParams struct {
+	JSON      string                         `json:"data" coerce:"name:json"`
+	Data      *RevokeMediatorPublicKeyParams `json:"-" coerce:"name:data"`
+	Signature []byte                         `json:"signature"`
+	PublicKey []byte                         `json:"publicKey"`
+}
+
+type RevokeMediatorPublicKeyParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	// the public signing key of the mediator
+	Signing []byte `json:"signing"`
+}
+
 // AddCodes
 
 type AddCodesParams struct {
@@ -194,6 +211,30 @@ type Keys struct {
 	ProviderData []byte `json:"providerData"`
 	RootKey      []byte `json:"rootKey"`
 	TokenKey     []byte `json:"tokenKey"`
+	// used to sign appointments generated from series
+	AppointmentKey []byte `json:"appointmentKey,omitempty"`
+	// all versions of the above keys
+	Versions         []*KeyVersion `json:"versions"`
+	RevokedMediators []*ActorKey   `json:"revokedMediators"`
+}
+
+const (
+	// the key is used for signing
+	KeyCurrent = "current"
+	// the key is still accepted but no longer used for signing
+	KeyValid = "valid"
+	// the key will become valid in the future
+	KeyPending = "pending"
+	// the key is no longer accepted
+	KeyRetired = "retired"
+)
+
+type KeyVersion struct {
+	Name       string     `json:"name"`
+	PublicKey  []byte     `json:"publicKey"`
+	ValidFrom  *time.Time `json:"validFrom,omitempty"`
+	ValidUntil *time.Time `json:"validUntil,omitempty"`
+	Status     string     `json:"status"`
 }
 
 type KeyLists struct {
@@ -290,10 +331,19 @@ type TokenData struct {
 // GetAppointmentsByZipCode
 
 type GetAppointmentsByZipCodeParams struct {
-	Radius    int64     `json:"radius"`
-	ZipCode   string    `json:"zipCode"`
-	From      time.Time `json:"from"`
-	To        time.Time `json:"to"`
+	Radius  int64     `json:"radius"`
+	ZipCode string    `json:"zipCode"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	// optional filters
+	Properties map[string]interface{} `json:"properties,omitempty"`
+	Accessible bool                   `json:"accessible,omitempty"`
+	TimeFrom   string                 `json:"timeFrom,omitempty"` // time of day (HH:MM)
+	TimeTo     string                 `json:"timeTo,omitempty"`   // time of day (HH:MM)
+	MinSlots   int64                  `json:"minSlots,omitempty"`
+	SortBy     string                 `json:"sortBy,omitempty"` // "distance" or "earliest"
+	Limit      int64                  `json:"limit,omitempty"`
+	Cursor     string                 `json:"cursor,omitempty"`
 }
 
 // GetProvidersByZipCode
@@ -301,6 +351,8 @@ type GetAppointmentsByZipCodeParams struct {
 type GetProvidersByZipCodeParams struct {
 	ZipFrom string `json:"zipFrom"`
 	ZipTo   string `json:"zipTo"`
+	Limit   int64  `json:"limit,omitempty"`
+	Cursor  string `json:"cursor,omitempty"`
 }
 
 type KeyChain struct {
@@ -422,6 +474,8 @@ type Appointment struct {
 	SlotData   []*Slot                `json:"slotData"`
 	ID         []byte                 `json:"id"`
 	PublicKey  []byte                 `json:"publicKey"`
+	// the series the appointment has been generated from (if any)
+	SeriesID []byte `json:"seriesID,omitempty"`
 }
 
 type AppointmentAggregated struct {
@@ -451,6 +505,63 @@ type Slot struct {
 	ID []byte `json:"id"`
 }
 
+// PublishAppointmentSeries
+
+type PublishAppointmentSeriesSignedParams struct {
+	JSON      string                          `json:"data" coerce:"name:json"`
+	Data      *PublishAppointmentSeriesParams `json:"-" coerce:"name:data"`
+	Signature []byte                          `json:"signature"`
+	PublicKey []byte                          `json:"publicKey"`
+}
+
+type PublishAppointmentSeriesParams struct {
+	Timestamp time.Time          `json:"timestamp"`
+	Series    *AppointmentSeries `json:"series"`
+}
+
+// An appointment series describes appointments that recur daily or weekly
+// until the given end date. The server expands the series into individual
+// appointments over a rolling horizon.
+type AppointmentSeries struct {
+	ID         []byte                 `json:"id"`
+	Interval   string                 `json:"interval"` // "daily" or "weekly"
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	Duration   int64                  `json:"duration"`
+	Slots      int64                  `json:"slots"`
+	Properties map[string]interface{} `json:"properties"`
+	PublicKey  []byte                 `json:"publicKey"`
+	// the time up to which the series has been expanded (set by the server)
+	ExpandedUntil time.Time `json:"expandedUntil"`
+}
+
+// GetAppointmentSeries
+
+type GetAppointmentSeriesSignedParams struct {
+	JSON      string                      `json:"data" coerce:"name:json"`
+	Data      *GetAppointmentSeriesParams `json:"-" coerce:"name:data"`
+	Signature []byte                      `json:"signature"`
+	PublicKey []byte                      `json:"publicKey"`
+}
+
+type GetAppointmentSeriesParams struct {
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// DeleteAppointmentSeries
+
+type DeleteAppointmentSeriesSignedParams struct {
+	JSON      string                         `json:"data" coerce:"name:json"`
+	Data      *DeleteAppointmentSeriesParams `json:"-" coerce:"name:data"`
+	Signature []byte                         `json:"signature"`
+	PublicKey []byte                         `json:"publicKey"`
+}
+
+type DeleteAppointmentSeriesParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	ID        []byte    `json:"id"`
+}
+
 // BookAppointment
 
 type BookAppointmentSignedParams struct {
@@ -475,6 +586,47 @@ type Booking struct {
 	EncryptedData *crypto.ECDHEncryptedData `json:"encryptedData"`
 }
 
+// GetBookedAppointments
+
+type GetBookedAppointmentsSignedParams struct {
+	JSON      string                       `json:"data" coerce:"name:json"`
+	Data      *GetBookedAppointmentsParams `json:"-" coerce:"name:data"`
+	Signature []byte                       `json:"signature"`
+	PublicKey []byte                       `json:"publicKey"`
+}
+
+type GetBookedAppointmentsParams struct {
+	Timestamp       time.Time        `json:"timestamp"`
+	SignedTokenData *SignedTokenData `json:"signedTokenData"`
+}
+
+type BookedAppointment struct {
+	ProviderID    []byte             `json:"providerID"`
+	AppointmentID []byte             `json:"appointmentID"`
+	SlotID        []byte             `json:"slotID"`
+	Timestamp     time.Time          `json:"timestamp"`
+	Appointment   *SignedAppointment `json:"appointment,omitempty"`
+}
+
+// RescheduleAppointment
+
+type RescheduleAppointmentSignedParams struct {
+	JSON      string                       `json:"data" coerce:"name:json"`
+	Data      *RescheduleAppointmentParams `json:"-" coerce:"name:data"`
+	Signature []byte                       `json:"signature"`
+	PublicKey []byte                       `json:"publicKey"`
+}
+
+type RescheduleAppointmentParams struct {
+	Timestamp       time.Time                 `json:"timestamp"`
+	ProviderID      []byte                    `json:"providerID"`
+	ID              []byte                    `json:"id"`
+	NewProviderID   []byte                    `json:"newProviderID"`
+	NewID           []byte                    `json:"newID"`
+	EncryptedData   *crypto.ECDHEncryptedData `json:"encryptedData"`
+	SignedTokenData *SignedTokenData          `json:"signedTokenData"`
+}
+
 // GetAppointment
 
 type GetAppointmentParams struct {
@@ -498,6 +650,94 @@ type CancelAppointmentParams struct {
 	ID              []byte           `json:"id"`
 }
 
+// CancelBooking
+
+type CancelBookingSignedParams struct {
+	JSON      string               `json:"data" coerce:"name:json"`
+	Data      *CancelBookingParams `json:"-" coerce:"name:data"`
+	Signature []byte               `json:"signature"`
+	PublicKey []byte               `json:"publicKey"`
+}
+
+type CancelBookingParams struct {
+	Timestamp       time.Time                 `json:"timestamp"`
+	ID              []byte                    `json:"id"`
+	BookingID       []byte                    `json:"bookingID"`
+	EncryptedReason *crypto.ECDHEncryptedData `json:"encryptedReason"`
+}
+
+// this record is accessible to the user whose booking has been cancelled
+type BookingCancellation struct {
+	ProviderID      []byte                    `json:"providerID"`
+	AppointmentID   []byte                    `json:"appointmentID"`
+	BookingID       []byte                    `json:"bookingID"`
+	Timestamp       time.Time                 `json:"timestamp"`
+	CancelledAt     time.Time                 `json:"cancelledAt"`
+	EncryptedReason *crypto.ECDHEncryptedData `json:"encryptedReason"`
+}
+
+// GetBookingCancellations
+
+type GetBookingCancellationsSignedParams struct {
+	JSON      string                         `json:"data" coerce:"name:json"`
+	Data      *GetBookingCancellationsParams `json:"-" coerce:"name:data"`
+	Signature []byte                         `json:"signature"`
+	PublicKey []byte                         `json:"publicKey"`
+}
+
+type GetBookingCancellationsParams struct {
+	Timestamp       time.Time        `json:"timestamp"`
+	SignedTokenData *SignedTokenData `json:"signedTokenData"`
+}
+
+// JoinWaitlist
+
+type JoinWaitlistSignedParams struct {
+	JSON      string              `json:"data" coerce:"name:json"`
+	Data      *JoinWaitlistParams `json:"-" coerce:"name:data"`
+	Signature []byte              `json:"signature"`
+	PublicKey []byte              `json:"publicKey"`
+}
+
+type JoinWaitlistParams struct {
+	Timestamp       time.Time                 `json:"timestamp"`
+	ProviderID      []byte                    `json:"providerID"`
+	From            time.Time                 `json:"from"`
+	To              time.Time                 `json:"to"`
+	EncryptedData   *crypto.ECDHEncryptedData `json:"encryptedData"`
+	SignedTokenData *SignedTokenData          `json:"signedTokenData"`
+}
+
+// GetWaitlist & LeaveWaitlist
+
+type WaitlistSignedParams struct {
+	JSON      string          `json:"data" coerce:"name:json"`
+	Data      *WaitlistParams `json:"-" coerce:"name:data"`
+	Signature []byte          `json:"signature"`
+	PublicKey []byte          `json:"publicKey"`
+}
+
+type WaitlistParams struct {
+	Timestamp       time.Time        `json:"timestamp"`
+	ProviderID      []byte           `json:"providerID"`
+	SignedTokenData *SignedTokenData `json:"signedTokenData"`
+}
+
+type WaitlistEntry struct {
+	Token         []byte                    `json:"token"`
+	PublicKey     []byte                    `json:"publicKey"`
+	N             int64                     `json:"n"`
+	From          time.Time                 `json:"from"`
+	To            time.Time                 `json:"to"`
+	EncryptedData *crypto.ECDHEncryptedData `json:"encryptedData"`
+	CreatedAt     time.Time                 `json:"createdAt"`
+	// the ID of the appointment the user has been booked into (if any)
+	AppointmentID []byte `json:"appointmentID,omitempty"`
+	// the position in the waitlist (starting at 1), or 0 if a slot has been
+	// assigned to the user already
+	Position int64 `json:"position"`
+}
+
 // CheckProviderData
 
 type CheckProviderDataSignedParams struct {
@@ -543,6 +783,7 @@ type GetPendingProviderDataSignedParams struct {
 type GetPendingProviderDataParams struct {
 	Timestamp time.Time `json:"timestamp"`
 	Limit     int64     `json:"limit"`
+	Cursor    string    `json:"cursor,omitempty"`
 }
 
 // GetVerifiedProviderData
@@ -557,6 +798,118 @@ type GetVerifiedProviderDataSignedParams struct {
 type GetVerifiedProviderDataParams struct {
 	Timestamp time.Time `json:"timestamp"`
 	Limit     int64     `json:"limit"`
+	Cursor    string    `json:"cursor,omitempty"`
+}
+
+// SuspendProvider, ReactivateProvider & DeleteProvider
+
+type ManageProviderSignedParams struct {
+	JSON      string                `json:"data" coerce:"name:json"`
+	Data      *ManageProviderParams `json:"-" coerce:"name:data"`
+	Signature []byte                `json:"signature"`
+	PublicKey []byte                `json:"publicKey"`
+}
+
+type ManageProviderParams struct {
+	Timestamp  time.Time `json:"timestamp"`
+	ProviderID []byte    `json:"providerID"`
+}
+
+// GetAuditLog
+
+type GetAuditLogSignedParams struct {
+	JSON      string             `json:"data" coerce:"name:json"`
+	Data      *GetAuditLogParams `json:"-" coerce:"name:data"`
+	Signature []byte             `json:"signature"`
+	PublicKey []byte             `json:"publicKey"`
+}
+
+type GetAuditLogParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	From      int64     `json:"from"`
+	Limit     int64     `json:"limit"`
+}
+
+// An entry of the audit log, which records privileged operations. Each entry
+// contains the hash of its predecessor, so entries can't be modified or
+// removed without breaking the chain.
+type AuditEntry struct {
+	N         int64     `json:"n"`
+	Endpoint  string    `json:"endpoint"`
+	PublicKey []byte    `json:"publicKey"`
+	Timestamp time.Time `json:"timestamp"`
+	Data      string    `json:"data"` // the signed request data
+	Signature []byte    `json:"signature"`
+	IDs       [][]byte  `json:"ids"`
+	CreatedAt time.Time `json:"createdAt"`
+	PrevHash  []byte    `json:"prevHash"`
+	Hash      []byte    `json:"hash"`
+}
+
+// Computes the hash of the entry, which covers all fields apart from the
+// hash itself.
+func (a *AuditEntry) ComputeHash() ([]byte, error) {
+	entry := *a
+	entry.Hash = nil
+	if data, err := json.Marshal(&entry); err != nil {
+		return nil, err
+	} else {
+		return crypto.Hash(data), nil
+	}
+}
+
+// Verifies the request signature of the entry and checks that the timestamp
+// of the entry is the one that has been signed.
+func (a *AuditEntry) VerifySignature() error {
+	if ok, err := crypto.VerifyWithBytes([]byte(a.Data), a.Signature, a.PublicKey); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("invalid request signature")
+	}
+	var data struct {
+		Timestamp time.Time `json:"timestamp"`
+	}
+	if err := json.Unmarshal([]byte(a.Data), &data); err != nil {
+		return err
+	} else if !data.Timestamp.Equal(a.Timestamp) {
+		return fmt.Errorf("timestamp does not match the request")
+	}
+	return nil
+}
+
+// Verifies the hashes and request signatures of the given consecutive entries
+// and the links between them. The first entry can't be linked as its
+// predecessor isn't known.
+func VerifyAuditLog(entries []*AuditEntry) error {
+	for i, entry := range entries {
+		if hash, err := entry.ComputeHash(); err != nil {
+			return err
+		} else if !bytes.Equal(hash, entry.Hash) {
+			return fmt.Errorf("entry %d: hash mismatch", entry.N)
+		}
+		if err := entry.VerifySignature(); err != nil {
+			return fmt.Errorf("entry %d: %v", entry.N, err)
+		}
+		if i == 0 {
+			continue
+		}
+		if entry.N != entries[i-1].N+1 {
+			return fmt.Errorf("entry %d: expected entry %d", entry.N, entries[i-1].N+1)
+		}
+		if !bytes.Equal(entry.PrevHash, entries[i-1].Hash) {
+			return fmt.Errorf("entry %d: not linked to its predecessor", entry.N)
+		}
+	}
+	return nil
+}
+
+// Pagination
+
+// A page of results. If there are more results, the cursor can be passed to
+// the same endpoint (with otherwise identical parameters) to get the next page.
+type Page struct {
+	Results interface{} `json:"results"`
+	Cursor  string      `json:"cursor,omitempty"`
 }
 
 // GetStats
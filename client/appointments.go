@@ -0,0 +1,289 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+)
+
+var appointmentsRoutes = map[string]*Route{
+	"getStats":                  {"GET", "stats"},
+	"getKeys":                   {"GET", "keys"},
+	"getConfigurables":          {"GET", "configurables"},
+	"getAppointmentsAggregated": {"GET", "appointments/aggregated/<zipCode>/<radius>/<from>/<to>"},
+	"getAppointmentsByZipCode":  {"GET", "appointments/zipCode/<zipCode>/<radius>/<from>/<to>"},
+	"getProvidersByZipCode":     {"GET", "providers/zipCode/<zipFrom>/<zipTo>"},
+	"getAppointment":            {"GET", "provider/<providerID>/appointments/<id>"},
+	"getToken":                  {"POST", "token"},
+	"addMediatorPublicKeys":     {"POST", "mediators"},
+	"revokeMediatorPublicKey":   {"POST", "mediators/revoke"},
+	"getAuditLog":               {"POST", "audit"},
+	"addCodes":                  {"POST", "codes"},
+	"uploadDistances":           {"POST", "distances"},
+	"resetDB":                   {"DELETE", "db/reset"},
+	"confirmProvider":           {"POST", "providers"},
+	"getPendingProviderData":    {"POST", "providers/pending"},
+	"getVerifiedProviderData":   {"POST", "providers/verified"},
+	"suspendProvider":           {"POST", "providers/suspend"},
+	"reactivateProvider":        {"POST", "providers/reactivate"},
+	"deleteProvider":            {"POST", "providers/delete"},
+	"getProviderAppointments":   {"POST", "appointments"},
+	"publishAppointments":       {"POST", "appointments/publish"},
+	"publishAppointmentSeries":  {"POST", "appointments/series/publish"},
+	"getAppointmentSeries":      {"POST", "appointments/series"},
+	"deleteAppointmentSeries":   {"POST", "appointments/series/delete"},
+	"cancelBooking":             {"POST", "appointments/bookings/cancel"},
+	"storeProviderData":         {"POST", "providers/data"},
+	"checkProviderData":         {"POST", "providers/data/check"},
+	"bookAppointment":           {"POST", "appointments/book"},
+	"rescheduleAppointment":     {"POST", "appointments/reschedule"},
+	"getBookedAppointments":     {"POST", "appointments/booked"},
+	"getBookingCancellations":   {"POST", "appointments/cancellations"},
+	"joinWaitlist":              {"POST", "waitlist/join"},
+	"getWaitlist":               {"POST", "waitlist"},
+	"leaveWaitlist":             {"POST", "waitlist/leave"},
+	"cancelAppointment":         {"DELETE", "appointments/cancel"},
+}
+
+// Results of the paged endpoints. The API only returns a page (with the
+// cursor for the next page) if the request contains a limit or cursor, and
+// otherwise a plain list of results, which ends up in Results.
+type ProviderAppointmentsPage struct {
+	Results []*services.ProviderAppointments `json:"results"`
+	Cursor  string                           `json:"cursor"`
+}
+
+type AggregatedProviderAppointmentsPage struct {
+	Results []*services.AggregatedProviderAppointments `json:"results"`
+	Cursor  string                                     `json:"cursor"`
+}
+
+type ProvidersPage struct {
+	Results []*services.SignedProviderData `json:"results"`
+	Cursor  string                         `json:"cursor"`
+}
+
+type ProviderDataPage struct {
+	Results []*services.RawProviderData `json:"results"`
+	Cursor  string                      `json:"cursor"`
+}
+
+// A client for the appointments API. Authenticated methods take the key of
+// the actor (root, mediator, provider or user) that signs the request.
+// Timestamps that are not set will be set to the current time, and retried
+// requests are always signed again with a fresh timestamp.
+type AppointmentsClient struct {
+	*Client
+}
+
+func MakeAppointmentsClient(endpoint string, options *Options) *AppointmentsClient {
+	return &AppointmentsClient{
+		Client: makeClient(endpoint, options, appointmentsRoutes),
+	}
+}
+
+// unauthenticated endpoints
+
+func (a *AppointmentsClient) GetStats(params *services.GetStatsParams) ([]*services.StatsValue, error) {
+	var result []*services.StatsValue
+	return result, a.call("getStats", params, nil, &result)
+}
+
+func (a *AppointmentsClient) GetKeys() (*services.Keys, error) {
+	result := &services.Keys{}
+	return result, a.call("getKeys", nil, nil, result)
+}
+
+func (a *AppointmentsClient) GetConfigurables() (*services.ValidateSettings, error) {
+	result := &services.ValidateSettings{}
+	return result, a.call("getConfigurables", nil, nil, result)
+}
+
+func (a *AppointmentsClient) GetAppointmentsAggregated(params *services.GetAppointmentsByZipCodeParams) (*AggregatedProviderAppointmentsPage, error) {
+	result := &AggregatedProviderAppointmentsPage{}
+	if params.Limit == 0 && params.Cursor == "" {
+		return result, a.call("getAppointmentsAggregated", params, nil, &result.Results)
+	}
+	return result, a.call("getAppointmentsAggregated", params, nil, result)
+}
+
+func (a *AppointmentsClient) GetAppointmentsByZipCode(params *services.GetAppointmentsByZipCodeParams) (*ProviderAppointmentsPage, error) {
+	result := &ProviderAppointmentsPage{}
+	if params.Limit == 0 && params.Cursor == "" {
+		return result, a.call("getAppointmentsByZipCode", params, nil, &result.Results)
+	}
+	return result, a.call("getAppointmentsByZipCode", params, nil, result)
+}
+
+func (a *AppointmentsClient) GetProvidersByZipCode(params *services.GetProvidersByZipCodeParams) (*ProvidersPage, error) {
+	result := &ProvidersPage{}
+	if params.Limit == 0 && params.Cursor == "" {
+		return result, a.call("getProvidersByZipCode", params, nil, &result.Results)
+	}
+	return result, a.call("getProvidersByZipCode", params, nil, result)
+}
+
+func (a *AppointmentsClient) GetAppointment(params *services.GetAppointmentParams) (*services.ProviderAppointments, error) {
+	result := &services.ProviderAppointments{}
+	return result, a.call("getAppointment", params, nil, result)
+}
+
+func (a *AppointmentsClient) GetToken(params *services.GetTokenParams) (*services.SignedTokenData, error) {
+	result := &services.SignedTokenData{}
+	return result, a.call("getToken", params, nil, result)
+}
+
+// root endpoints
+
+func (a *AppointmentsClient) AddMediatorPublicKeys(key *crypto.Key, params *services.AddMediatorPublicKeysParams) error {
+	return a.call("addMediatorPublicKeys", params, key, nil)
+}
+
+func (a *AppointmentsClient) RevokeMediatorPublicKey(key *crypto.Key, params *services.RevokeMediatorPublicKeyParams) error {
+	return a.call("revokeMediatorPublicKey", params, key, nil)
+}
+
+func (a *AppointmentsClient) AddCodes(key *crypto.Key, params *services.CodesData) error {
+	return a.call("addCodes", params, key, nil)
+}
+
+func (a *AppointmentsClient) UploadDistances(key *crypto.Key, params *services.UploadDistancesParams) error {
+	return a.call("uploadDistances", params, key, nil)
+}
+
+func (a *AppointmentsClient) ResetDB(key *crypto.Key) error {
+	return a.call("resetDB", &services.ResetDBParams{}, key, nil)
+}
+
+func (a *AppointmentsClient) GetAuditLog(key *crypto.Key, params *services.GetAuditLogParams) ([]*services.AuditEntry, error) {
+	var result []*services.AuditEntry
+	return result, a.call("getAuditLog", params, key, &result)
+}
+
+// mediator endpoints
+
+func (a *AppointmentsClient) ConfirmProvider(key *crypto.Key, params *services.ConfirmProviderParams) error {
+	return a.call("confirmProvider", params, key, nil)
+}
+
+func (a *AppointmentsClient) GetPendingProviderData(key *crypto.Key, params *services.GetPendingProviderDataParams) (*ProviderDataPage, error) {
+	result := &ProviderDataPage{}
+	if params.Limit == 0 && params.Cursor == "" {
+		return result, a.call("getPendingProviderData", params, key, &result.Results)
+	}
+	return result, a.call("getPendingProviderData", params, key, result)
+}
+
+func (a *AppointmentsClient) GetVerifiedProviderData(key *crypto.Key, params *services.GetVerifiedProviderDataParams) (*ProviderDataPage, error) {
+	result := &ProviderDataPage{}
+	if params.Limit == 0 && params.Cursor == "" {
+		return result, a.call("getVerifiedProviderData", params, key, &result.Results)
+	}
+	return result, a.call("getVerifiedProviderData", params, key, result)
+}
+
+func (a *AppointmentsClient) SuspendProvider(key *crypto.Key, params *services.ManageProviderParams) error {
+	return a.call("suspendProvider", params, key, nil)
+}
+
+func (a *AppointmentsClient) ReactivateProvider(key *crypto.Key, params *services.ManageProviderParams) error {
+	return a.call("reactivateProvider", params, key, nil)
+}
+
+func (a *AppointmentsClient) DeleteProvider(key *crypto.Key, params *services.ManageProviderParams) error {
+	return a.call("deleteProvider", params, key, nil)
+}
+
+// provider endpoints
+
+func (a *AppointmentsClient) GetProviderAppointments(key *crypto.Key, params *services.GetProviderAppointmentsParams) (*services.ProviderAppointments, error) {
+	result := &services.ProviderAppointments{}
+	return result, a.call("getProviderAppointments", params, key, result)
+}
+
+func (a *AppointmentsClient) PublishAppointments(key *crypto.Key, params *services.PublishAppointmentsParams) error {
+	return a.call("publishAppointments", params, key, nil)
+}
+
+func (a *AppointmentsClient) PublishAppointmentSeries(key *crypto.Key, params *services.PublishAppointmentSeriesParams) error {
+	return a.call("publishAppointmentSeries", params, key, nil)
+}
+
+func (a *AppointmentsClient) GetAppointmentSeries(key *crypto.Key, params *services.GetAppointmentSeriesParams) ([]*services.AppointmentSeries, error) {
+	var result []*services.AppointmentSeries
+	return result, a.call("getAppointmentSeries", params, key, &result)
+}
+
+func (a *AppointmentsClient) DeleteAppointmentSeries(key *crypto.Key, params *services.DeleteAppointmentSeriesParams) error {
+	return a.call("deleteAppointmentSeries", params, key, nil)
+}
+
+func (a *AppointmentsClient) CancelBooking(key *crypto.Key, params *services.CancelBookingParams) error {
+	return a.call("cancelBooking", params, key, nil)
+}
+
+func (a *AppointmentsClient) StoreProviderData(key *crypto.Key, params *services.StoreProviderDataParams) error {
+	return a.call("storeProviderData", params, key, nil)
+}
+
+func (a *AppointmentsClient) CheckProviderData(key *crypto.Key, params *services.CheckProviderDataParams) (*services.ConfirmedProviderData, error) {
+	result := &services.ConfirmedProviderData{}
+	return result, a.call("checkProviderData", params, key, result)
+}
+
+// user endpoints
+
+func (a *AppointmentsClient) BookAppointment(key *crypto.Key, params *services.BookAppointmentParams) (*services.Booking, error) {
+	result := &services.Booking{}
+	return result, a.call("bookAppointment", params, key, result)
+}
+
+func (a *AppointmentsClient) RescheduleAppointment(key *crypto.Key, params *services.RescheduleAppointmentParams) (*services.Booking, error) {
+	result := &services.Booking{}
+	return result, a.call("rescheduleAppointment", params, key, result)
+}
+
+func (a *AppointmentsClient) GetBookedAppointments(key *crypto.Key, params *services.GetBookedAppointmentsParams) ([]*services.BookedAppointment, error) {
+	var result []*services.BookedAppointment
+	return result, a.call("getBookedAppointments", params, key, &result)
+}
+
+func (a *AppointmentsClient) GetBookingCancellations(key *crypto.Key, params *services.GetBookingCancellationsParams) ([]*services.BookingCancellation, error) {
+	var result []*services.BookingCancellation
+	return result, a.call("getBookingCancellations", params, key, &result)
+}
+
+func (a *AppointmentsClient) JoinWaitlist(key *crypto.Key, params *services.JoinWaitlistParams) (*services.WaitlistEntry, error) {
+	result := &services.WaitlistEntry{}
+	return result, a.call("joinWaitlist", params, key, result)
+}
+
+func (a *AppointmentsClient) GetWaitlist(key *crypto.Key, params *services.WaitlistParams) (*services.WaitlistEntry, error) {
+	result := &services.WaitlistEntry{}
+	return result, a.call("getWaitlist", params, key, result)
+}
+
+func (a *AppointmentsClient) LeaveWaitlist(key *crypto.Key, params *services.WaitlistParams) error {
+	return a.call("leaveWaitlist", params, key, nil)
+}
+
+func (a *AppointmentsClient) CancelAppointment(key *crypto.Key, params *services.CancelAppointmentParams) error {
+	return a.call("cancelAppointment", params, key, nil)
+}
@@ -0,0 +1,487 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/kiebitz-oss/services/crypto"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Transport int
+
+const (
+	JSONRPC Transport = iota
+	REST
+)
+
+type Options struct {
+	// the transport to use, JSON-RPC by default
+	Transport Transport
+	// how often we retry a request that failed with a transient error
+	MaxRetries int
+	// the delay before the first retry, which doubles with every attempt
+	Backoff    time.Duration
+	HTTPClient *http.Client
+}
+
+// An error returned by the API. For REST requests, the code is the HTTP
+// status code, for JSON-RPC requests the error code of the response.
+type Error struct {
+	StatusCode int
+	Code       int
+	Message    string
+	Data       interface{}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("API error %d: %s", e.Code, e.Message)
+}
+
+// Returns true if the request may succeed when retried
+func (e *Error) Temporary() bool {
+	switch e.StatusCode {
+	case 429, 502, 503, 504:
+		return true
+	}
+	return false
+}
+
+// An error that occurred while talking to the server
+type TransportError struct {
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("transport error: %v", e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TransportError) Temporary() bool {
+	return true
+}
+
+// Returns true if the error is an API error with the given code
+func IsCode(err error, code int) bool {
+	apiErr, ok := err.(*Error)
+	return ok && apiErr.Code == code
+}
+
+func IsNotFound(err error) bool {
+	return IsCode(err, 404)
+}
+
+func isTemporary(err error) bool {
+	temporary, ok := err.(interface{ Temporary() bool })
+	return ok && temporary.Temporary()
+}
+
+// A REST route of an endpoint
+type Route struct {
+	Method string
+	Path   string
+}
+
+var pathParamRegexp = regexp.MustCompile(`<([a-zA-Z0-9_]+)>`)
+
+// Go encodes zero timestamps like this, we replace them with the current time
+// when signing requests
+const zeroTimestamp = "0001-01-01T00:00:00Z"
+
+type Client struct {
+	endpoint string
+	options  *Options
+	routes   map[string]*Route
+}
+
+func makeClient(endpoint string, options *Options, routes map[string]*Route) *Client {
+
+	if options == nil {
+		options = &Options{}
+	}
+
+	if options.HTTPClient == nil {
+		options.HTTPClient = &http.Client{Timeout: 60 * time.Second}
+	}
+
+	if options.Backoff == 0 {
+		options.Backoff = 100 * time.Millisecond
+	}
+
+	return &Client{
+		// we accept the JSON-RPC endpoint as well
+		endpoint: strings.TrimSuffix(strings.TrimSuffix(endpoint, "/"), "/jsonrpc"),
+		options:  options,
+		routes:   routes,
+	}
+}
+
+// Returns the REST route of the given endpoint, or nil if there is none
+func (c *Client) Route(method string) *Route {
+	return c.routes[method]
+}
+
+func toMap(params interface{}) (map[string]interface{}, error) {
+
+	mapParams := map[string]interface{}{}
+
+	if params == nil {
+		return mapParams, nil
+	}
+
+	data, err := json.Marshal(params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &mapParams); err != nil {
+		return nil, err
+	}
+
+	return mapParams, nil
+}
+
+// Converts the parameters to a map, signing them with the given key (if any).
+// An empty timestamp is replaced with the current time. For retries (fresh)
+// we always use the current time, as the server rejects signed data it has
+// already seen. Signed parameters without a timestamp can't be retried, which
+// is indicated by the returned boolean.
+func prepareParams(params interface{}, key *crypto.Key, fresh bool) (map[string]interface{}, bool, error) {
+
+	mapParams, err := toMap(params)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if key == nil {
+		return mapParams, true, nil
+	}
+
+	timestamp, timestamped := mapParams["timestamp"]
+
+	if timestamped && (fresh || timestamp == nil || timestamp == zeroTimestamp) {
+		mapParams["timestamp"] = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+
+	data, err := json.Marshal(mapParams)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	signedData, err := key.SignString(string(data))
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return signedData.AsMap(), timestamped, nil
+}
+
+// Calls the given method, decoding the result into the given value (if it's
+// not nil). Requests that fail with a transient error are retried.
+func (c *Client) call(method string, params interface{}, key *crypto.Key, result interface{}) error {
+
+	for attempt := 0; ; attempt++ {
+
+		// we sign the parameters again for every attempt with a fresh
+		// timestamp, as the server would reject a replayed signature
+		mapParams, retryable, err := prepareParams(params, key, attempt > 0)
+
+		if err != nil {
+			return err
+		}
+
+		var data []byte
+
+		if c.options.Transport == REST {
+			data, err = c.callREST(method, mapParams)
+		} else {
+			data, err = c.callJSONRPC(method, mapParams)
+		}
+
+		if err == nil {
+			return decodeResult(data, result)
+		}
+
+		if attempt >= c.options.MaxRetries || !retryable || !isTemporary(err) {
+			return err
+		}
+
+		time.Sleep(c.options.Backoff * time.Duration(1<<uint(attempt)))
+	}
+}
+
+func (c *Client) do(method, url string, body interface{}) (int, []byte, error) {
+
+	var reader *bytes.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := c.options.HTTPClient.Do(req)
+
+	if err != nil {
+		return 0, nil, &TransportError{Err: err}
+	}
+
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return 0, nil, &TransportError{Err: err}
+	}
+
+	return resp.StatusCode, data, nil
+}
+
+type jsonRPCResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int         `json:"code"`
+		Message string      `json:"message"`
+		Data    interface{} `json:"data"`
+	} `json:"error"`
+}
+
+func (c *Client) callJSONRPC(method string, params map[string]interface{}) ([]byte, error) {
+
+	statusCode, data, err := c.do("POST", c.endpoint+"/jsonrpc", map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  method,
+		"params":  params,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	response := &jsonRPCResponse{}
+
+	if err := json.Unmarshal(data, response); err != nil {
+		// e.g. a proxy that returns an HTML error page
+		return nil, &Error{StatusCode: statusCode, Code: statusCode, Message: http.StatusText(statusCode)}
+	}
+
+	if response.Error != nil {
+		return nil, &Error{
+			StatusCode: statusCode,
+			Code:       response.Error.Code,
+			Message:    response.Error.Message,
+			Data:       response.Error.Data,
+		}
+	}
+
+	return response.Result, nil
+}
+
+// Converts a parameter value to a string for use in a URL
+func urlValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		// lists and maps are passed as JSON
+		if data, err := json.Marshal(v); err != nil {
+			return "", err
+		} else {
+			return string(data), nil
+		}
+	}
+}
+
+func (c *Client) callREST(method string, params map[string]interface{}) ([]byte, error) {
+
+	route, ok := c.routes[method]
+
+	if !ok {
+		return nil, fmt.Errorf("method %s is not available via REST", method)
+	}
+
+	var err error
+
+	// we replace the path parameters with their values
+	path := pathParamRegexp.ReplaceAllStringFunc(route.Path, func(match string) string {
+		name := match[1 : len(match)-1]
+		value, ok := params[name]
+		if !ok {
+			err = fmt.Errorf("parameter %s missing", name)
+			return ""
+		}
+		delete(params, name)
+		strValue, valueErr := urlValue(value)
+		if valueErr != nil {
+			err = valueErr
+		}
+		return url.QueryEscape(strValue)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	requestURL := c.endpoint + "/" + path
+
+	var body interface{}
+
+	// GET requests pass all other parameters in the query string
+	if route.Method == "GET" {
+		query := url.Values{}
+		for name, value := range params {
+			if value == nil {
+				continue
+			}
+			if strValue, err := urlValue(value); err != nil {
+				return nil, err
+			} else {
+				query.Set(name, strValue)
+			}
+		}
+		if len(query) > 0 {
+			requestURL += "?" + query.Encode()
+		}
+	} else {
+		body = params
+	}
+
+	statusCode, data, err := c.do(route.Method, requestURL, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode == 200 {
+		return data, nil
+	}
+
+	restError := &struct {
+		Message string      `json:"message"`
+		Data    interface{} `json:"data"`
+	}{}
+
+	if err := json.Unmarshal(data, restError); err != nil || restError.Message == "" {
+		restError.Message = http.StatusText(statusCode)
+	}
+
+	return nil, &Error{
+		StatusCode: statusCode,
+		Code:       statusCode,
+		Message:    restError.Message,
+		Data:       restError.Data,
+	}
+}
+
+func decodeResult(data []byte, result interface{}) error {
+
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, result); err != nil {
+		return err
+	}
+
+	return decodeSignedData(reflect.ValueOf(result))
+}
+
+// Signed data structures contain their payload as a JSON string, which we
+// decode into the 'Data' field so that callers can use it directly.
+func decodeSignedData(value reflect.Value) error {
+
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return decodeSignedData(value.Elem())
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := decodeSignedData(value.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range value.MapKeys() {
+			if err := decodeSignedData(value.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		jsonField := value.FieldByName("JSON")
+		dataField := value.FieldByName("Data")
+		if jsonField.IsValid() && jsonField.Kind() == reflect.String && jsonField.String() != "" &&
+			dataField.IsValid() && dataField.Kind() == reflect.Ptr && dataField.IsNil() && dataField.CanSet() {
+			data := reflect.New(dataField.Type().Elem())
+			if err := json.Unmarshal([]byte(jsonField.String()), data.Interface()); err != nil {
+				return err
+			}
+			dataField.Set(data)
+		}
+		for i := 0; i < value.NumField(); i++ {
+			if field := value.Field(i); field.CanInterface() {
+				if err := decodeSignedData(field); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,271 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client_test
+
+import (
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/client"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/servers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppointmentsClient(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		at.FC{af.ProvidersAndAppointments{
+			Providers: 2,
+			BaseProvider: af.Provider{
+				ZipCode:   "10707",
+				StoreData: true,
+				Confirm:   true,
+			},
+			BaseAppointments: af.Appointments{
+				N:        5,
+				Start:    af.TS("2022-10-01T12:00:00Z"),
+				Duration: 30,
+				Slots:    5,
+				Properties: map[string]interface{}{
+					"vaccine": "moderna",
+				},
+			},
+		}, "providersAndAppointments"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := fixtures["settings"].(*services.Settings)
+	providersAndAppointments := fixtures["providersAndAppointments"].([]*af.ProviderAndAppointments)
+	// the fixture appends the providers to the end of the list
+	provider := providersAndAppointments[len(providersAndAppointments)-1].Provider
+
+	for _, transport := range []client.Transport{client.JSONRPC, client.REST} {
+
+		appointmentsClient := client.MakeAppointmentsClient(settings.Admin.Client.AppointmentsEndpoint, &client.Options{
+			Transport: transport,
+		})
+
+		if keys, err := appointmentsClient.GetKeys(); err != nil {
+			t.Fatal(err)
+		} else if len(keys.RootKey) == 0 {
+			t.Fatalf("expected a root key")
+		}
+
+		page, err := appointmentsClient.GetAppointmentsByZipCode(&services.GetAppointmentsByZipCodeParams{
+			ZipCode: "10707",
+			Radius:  20,
+			From:    af.TS("2022-10-01T00:00:00Z"),
+			To:      af.TS("2022-10-02T00:00:00Z"),
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(page.Results) != 2 {
+			t.Fatalf("expected 2 providers, got %d", len(page.Results))
+		}
+
+		// signed data should be decoded for us
+		for _, providerAppointments := range page.Results {
+			if providerAppointments.Provider.Data == nil || providerAppointments.Provider.Data.ZipCode != "10707" {
+				t.Fatalf("expected decoded provider data")
+			}
+			if len(providerAppointments.Appointments) != 5 || providerAppointments.Appointments[0].Data == nil {
+				t.Fatalf("expected decoded appointments")
+			}
+		}
+
+		// this request is signed by the provider
+		providerAppointments, err := appointmentsClient.GetProviderAppointments(provider.Actor.SigningKey, &services.GetProviderAppointmentsParams{
+			From: af.TS("2022-10-01T00:00:00Z"),
+			To:   af.TS("2022-10-02T00:00:00Z"),
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(providerAppointments.Appointments) != 5 {
+			t.Fatalf("expected 5 appointments, got %d", len(providerAppointments.Appointments))
+		}
+
+		if _, err := appointmentsClient.GetAppointment(&services.GetAppointmentParams{
+			ProviderID: provider.Actor.SigningKey.PublicKey[:32],
+			ID:         make([]byte, 32),
+		}); !client.IsNotFound(err) {
+			t.Fatalf("expected a not found error, got %v", err)
+		}
+	}
+
+	// the REST routes of the client must match those of the server
+	appointmentsServer := fixtures["appointmentsServer"].(*servers.Appointments)
+	spec := appointmentsServer.OpenAPI()
+
+	restClient := client.MakeAppointmentsClient(settings.Admin.Client.AppointmentsEndpoint, nil)
+	re := regexp.MustCompile(`<([a-zA-Z0-9_]+)>`)
+
+	for _, endpoint := range []string{"getKeys", "getAppointmentsByZipCode", "getAppointment", "bookAppointment", "cancelAppointment"} {
+		found := false
+		for path, pathItem := range spec.Paths {
+			for method, operation := range *pathItem {
+				if operation.OperationID != endpoint || path == "/jsonrpc" {
+					continue
+				}
+				found = true
+				route := restClient.Route(endpoint)
+				if route == nil || "/"+re.ReplaceAllString(route.Path, "{$1}") != path || strings.ToLower(route.Method) != method {
+					t.Fatalf("REST route for %s does not match", endpoint)
+				}
+			}
+		}
+		if !found {
+			t.Fatalf("no REST route found for %s", endpoint)
+		}
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+
+	attempts := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(503)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc": "2.0", "id": 1, "result": {"rootKey": "AQI="}}`))
+	}))
+
+	defer server.Close()
+
+	appointmentsClient := client.MakeAppointmentsClient(server.URL, &client.Options{
+		MaxRetries: 3,
+		Backoff:    time.Millisecond,
+	})
+
+	if keys, err := appointmentsClient.GetKeys(); err != nil {
+		t.Fatal(err)
+	} else if len(keys.RootKey) != 2 {
+		t.Fatalf("expected a root key")
+	}
+
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+
+	// without retries we get the error
+	attempts = 0
+	appointmentsClient = client.MakeAppointmentsClient(server.URL, &client.Options{})
+
+	if _, err := appointmentsClient.GetKeys(); !client.IsCode(err, 503) {
+		t.Fatalf("expected a 503 error, got %v", err)
+	}
+
+}
+
+func TestClientRetriesSignedRequests(t *testing.T) {
+
+	timestamps := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var request struct {
+			Params struct {
+				Data string `json:"data"`
+			} `json:"params"`
+		}
+
+		var data struct {
+			Timestamp string `json:"timestamp"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal([]byte(request.Params.Data), &data); err != nil {
+			t.Fatal(err)
+		}
+
+		timestamps = append(timestamps, data.Timestamp)
+
+		if len(timestamps) < 2 {
+			w.WriteHeader(503)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc": "2.0", "id": 1, "result": {"appointments": []}}`))
+	}))
+
+	defer server.Close()
+
+	key, err := crypto.GenerateWebKey("provider", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appointmentsClient := client.MakeAppointmentsClient(server.URL, &client.Options{
+		MaxRetries: 3,
+		Backoff:    time.Millisecond,
+	})
+
+	// the retry must not reuse the explicitly given timestamp, as the server
+	// would reject it as a replay
+	if _, err := appointmentsClient.GetProviderAppointments(key, &services.GetProviderAppointmentsParams{
+		Timestamp: time.Now().Add(-time.Second),
+		From:      time.Now(),
+		To:        time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(timestamps) != 2 || timestamps[0] == timestamps[1] {
+		t.Fatalf("expected a fresh timestamp for the retry, got %v", timestamps)
+	}
+}
@@ -0,0 +1,130 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+)
+
+var storageRoutes = map[string]*Route{
+	"storeSettings":   {"PUT", "store"},
+	"getSettings":     {"GET", "store/<id>"},
+	"deleteSettings":  {"DELETE", "store"},
+	"createPairing":   {"POST", "pairing"},
+	"joinPairing":     {"POST", "pairing/join"},
+	"getPairing":      {"GET", "pairing/<id>"},
+	"completePairing": {"POST", "pairing/complete"},
+	"createBlob":      {"POST", "blobs"},
+	"uploadBlobChunk": {"PUT", "blobs/chunks"},
+	"finalizeBlob":    {"POST", "blobs/finalize"},
+	"getBlob":         {"GET", "blobs/<id>"},
+	"getBlobChunk":    {"GET", "blobs/<id>/chunks/<index>"},
+	"deleteBlob":      {"DELETE", "blobs"},
+	"resetDB":         {"DELETE", "db/reset"},
+}
+
+// A client for the storage API
+type StorageClient struct {
+	*Client
+}
+
+func MakeStorageClient(endpoint string, options *Options) *StorageClient {
+	return &StorageClient{
+		Client: makeClient(endpoint, options, storageRoutes),
+	}
+}
+
+// Stores the given data under the given ID and returns the new version of the
+// record. The version in the parameters has to match the current version of
+// the record (0 for new records), and records can only be modified with the
+// key that created them.
+func (s *StorageClient) StoreSettings(params *services.StoreSettingsParams, key *crypto.Key) (*services.SettingsVersion, error) {
+	result := &services.SettingsVersion{}
+	return result, s.call("storeSettings", params, key, result)
+}
+
+// Returns the (usually encrypted) data stored under the given ID, along with
+// its version
+func (s *StorageClient) GetSettings(params *services.GetSettingsParams) (*services.SettingsRecord, error) {
+	result := &services.SettingsRecord{}
+	return result, s.call("getSettings", params, nil, result)
+}
+
+func (s *StorageClient) DeleteSettings(params *services.DeleteSettingsParams, key *crypto.Key) error {
+	return s.call("deleteSettings", params, key, nil)
+}
+
+// Creates a pairing session and returns its ID and the code that the other
+// device can join it with. Only the given key can complete the session.
+func (s *StorageClient) CreatePairing(params *services.CreatePairingParams, key *crypto.Key) (*services.PairingCode, error) {
+	result := &services.PairingCode{}
+	return result, s.call("createPairing", params, key, result)
+}
+
+func (s *StorageClient) JoinPairing(params *services.JoinPairingParams) (*services.PairingSession, error) {
+	result := &services.PairingSession{}
+	return result, s.call("joinPairing", params, nil, result)
+}
+
+func (s *StorageClient) GetPairing(params *services.GetPairingParams) (*services.PairingSession, error) {
+	result := &services.PairingSession{}
+	return result, s.call("getPairing", params, nil, result)
+}
+
+func (s *StorageClient) CompletePairing(params *services.CompletePairingParams, key *crypto.Key) error {
+	return s.call("completePairing", params, key, nil)
+}
+
+// Creates an upload session for a blob and returns its manifest, which
+// contains the chunk size that the blob needs to be uploaded in
+func (s *StorageClient) CreateBlob(params *services.CreateBlobParams, key *crypto.Key) (*services.BlobManifest, error) {
+	result := &services.BlobManifest{}
+	return result, s.call("createBlob", params, key, result)
+}
+
+func (s *StorageClient) UploadBlobChunk(params *services.UploadBlobChunkParams, key *crypto.Key) (*services.BlobManifest, error) {
+	result := &services.BlobManifest{}
+	return result, s.call("uploadBlobChunk", params, key, result)
+}
+
+func (s *StorageClient) FinalizeBlob(params *services.BlobParams, key *crypto.Key) (*services.BlobManifest, error) {
+	result := &services.BlobManifest{}
+	return result, s.call("finalizeBlob", params, key, result)
+}
+
+// Returns the manifest of a blob, which lists the chunks that have been
+// uploaded so far
+func (s *StorageClient) GetBlob(params *services.GetBlobParams) (*services.BlobManifest, error) {
+	result := &services.BlobManifest{}
+	return result, s.call("getBlob", params, nil, result)
+}
+
+func (s *StorageClient) GetBlobChunk(params *services.GetBlobChunkParams) (*services.BlobChunk, error) {
+	result := &services.BlobChunk{}
+	return result, s.call("getBlobChunk", params, nil, result)
+}
+
+func (s *StorageClient) DeleteBlob(params *services.BlobParams, key *crypto.Key) error {
+	return s.call("deleteBlob", params, key, nil)
+}
+
+func (s *StorageClient) ResetDB(key *crypto.Key) error {
+	return s.call("resetDB", &services.ResetDBParams{}, key, nil)
+}
@@ -36,4 +36,8 @@ var Commands = services.CommandsDefinitions{
 		Name:  "run",
 		Maker: helpers.Run,
 	},
+	services.CommandsDefinition{
+		Name:  "api",
+		Maker: helpers.API,
+	},
 }
@@ -202,9 +202,10 @@ func setupKeys(settings *services.Settings) func(c *cli.Context) error {
 		storageKeys := []*crypto.Key{}
 
 		keys := map[string]string{
-			"root":     "ecdsa",
-			"token":    "ecdsa",
-			"provider": "ecdh",
+			"root":        "ecdsa",
+			"token":       "ecdsa",
+			"appointment": "ecdsa",
+			"provider":    "ecdh",
 		}
 
 		for name, keyType := range keys {
@@ -223,9 +224,9 @@ func setupKeys(settings *services.Settings) func(c *cli.Context) error {
 
 			keyCopy := *settingsKey
 
-			if name != "token" {
-				// we remove all private keys except for the 'token' key, which the backend needs
-				// to sign tokens...
+			if name != "token" && name != "appointment" {
+				// we remove all private keys except for the 'token' and 'appointment' keys, which
+				// the backend needs to sign tokens and appointments generated from series...
 				keyCopy.PrivateKey = nil
 			}
 
@@ -751,6 +752,156 @@ func uploadMediatorKeys(settings *services.Settings) func(c *cli.Context) error
 	}
 }
 
+func revokeMediatorKeys(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		if settings.Admin == nil {
+			services.Log.Fatal("admin settings missing")
+		}
+
+		filename := c.Args().Get(0)
+
+		if filename == "" {
+			services.Log.Fatal("please specify a filename")
+		}
+
+		jsonBytes, err := ioutil.ReadFile(filename)
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		keyPairs := &KeyPairs{}
+		var rawKeyPairs map[string]interface{}
+
+		if err := json.Unmarshal(jsonBytes, &rawKeyPairs); err != nil {
+			services.Log.Fatal(err)
+		}
+
+		if params, err := KeyPairsForm.Validate(rawKeyPairs); err != nil {
+			services.Log.Fatal(err)
+		} else if KeyPairsForm.Coerce(keyPairs, params); err != nil {
+			services.Log.Fatal(err)
+		}
+
+		params := &services.RevokeMediatorPublicKeyParams{
+			Timestamp: time.Now(),
+			Signing:   keyPairs.Signing.PublicKey,
+		}
+
+		rootKey := settings.Admin.Signing.Key("root")
+
+		client := &http.Client{}
+		requester := helpers.MakeAPIClient(settings.Admin.Client.AppointmentsEndpoint, client)
+
+		if resp, err := requester("revokeMediatorPublicKey", params, rootKey); err != nil {
+			return err
+		} else if resp.StatusCode != 200 {
+			services.Log.Fatal(fmt.Sprintf("cannot revoke mediator key (status code %d)", resp.StatusCode))
+		}
+
+		return nil
+	}
+}
+
+func exportAuditLog(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		if settings.Admin == nil {
+			services.Log.Fatal("admin settings missing")
+		}
+
+		client := helpers.MakeAppointmentsClient(settings, &http.Client{})
+
+		var limit int64 = 1000
+		var from int64 = 1
+		entries := make([]*services.AuditEntry, 0)
+
+		// we fetch the log page by page until we reach its head
+		for {
+
+			resp, err := client.GetAuditLog(from, limit)
+
+			if err != nil {
+				services.Log.Fatal(err)
+			} else if resp.StatusCode != 200 {
+				services.Log.Fatal(fmt.Sprintf("cannot get audit log (status code %d)", resp.StatusCode))
+			}
+
+			var result struct {
+				Result []*services.AuditEntry `json:"result"`
+			}
+
+			if data, err := resp.Bytes(); err != nil {
+				services.Log.Fatal(err)
+			} else if err := json.Unmarshal(data, &result); err != nil {
+				services.Log.Fatal(err)
+			}
+
+			entries = append(entries, result.Result...)
+
+			if int64(len(result.Result)) < limit {
+				break
+			}
+
+			from = result.Result[len(result.Result)-1].N + 1
+		}
+
+		if err := services.VerifyAuditLog(entries); err != nil {
+			services.Log.Fatal(err)
+		}
+
+		jsonData, err := json.MarshalIndent(entries, "", "  ")
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		if filename := c.String("output"); filename != "" {
+			if err := ioutil.WriteFile(filename, jsonData, 0644); err != nil {
+				services.Log.Fatal(err)
+			}
+		} else {
+			fmt.Println(string(jsonData))
+		}
+
+		services.Log.Infof("Exported and verified %d audit log entries.", len(entries))
+
+		return nil
+	}
+}
+
+func verifyAuditLog(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		filename := c.Args().Get(0)
+
+		if filename == "" {
+			services.Log.Fatal("please specify a filename")
+		}
+
+		jsonBytes, err := ioutil.ReadFile(filename)
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		var entries []*services.AuditEntry
+
+		if err := json.Unmarshal(jsonBytes, &entries); err != nil {
+			services.Log.Fatal(err)
+		}
+
+		if err := services.VerifyAuditLog(entries); err != nil {
+			services.Log.Fatal(err)
+		}
+
+		services.Log.Infof("Verified %d audit log entries.", len(entries))
+
+		return nil
+	}
+}
+
 func Admin(settings *services.Settings) ([]cli.Command, error) {
 
 	return []cli.Command{
@@ -844,6 +995,36 @@ func Admin(settings *services.Settings) ([]cli.Command, error) {
 							Usage:  "upload signed keys data for a mediator",
 							Action: uploadMediatorKeys(settings),
 						},
+						{
+							Name:   "revoke",
+							Flags:  []cli.Flag{},
+							Usage:  "revoke the keys of a mediator and flag the providers it confirmed",
+							Action: revokeMediatorKeys(settings),
+						},
+					},
+				},
+				{
+					Name:  "audit",
+					Flags: []cli.Flag{},
+					Usage: "Audit log-related command.",
+					Subcommands: []cli.Command{
+						{
+							Name: "export",
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:  "output, o",
+									Usage: "file to write the audit log to (stdout if not given)",
+								},
+							},
+							Usage:  "export the audit log and verify its hash chain",
+							Action: exportAuditLog(settings),
+						},
+						{
+							Name:   "verify",
+							Flags:  []cli.Flag{},
+							Usage:  "verify the hash chain of an exported audit log",
+							Action: verifyAuditLog(settings),
+						},
 					},
 				},
 			},
@@ -0,0 +1,98 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/api"
+	"github.com/kiebitz-oss/services/servers"
+	"github.com/urfave/cli"
+	"io/ioutil"
+)
+
+// Generates the specification from the API definitions of the server, so
+// neither settings for the server nor a database are required.
+func getSpec(server string) (*api.Spec, error) {
+	switch server {
+	case "appointments":
+		return servers.AppointmentsSpec(), nil
+	case "storage":
+		return servers.StorageSpec(), nil
+	default:
+		return nil, fmt.Errorf("unknown server: %s", server)
+	}
+}
+
+func apiSpec() func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		spec, err := getSpec(c.String("server"))
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		jsonData, err := json.MarshalIndent(spec, "", "  ")
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		if output := c.String("output"); output != "" {
+			if err := ioutil.WriteFile(output, jsonData, 0644); err != nil {
+				services.Log.Fatal(err)
+			}
+			return nil
+		}
+
+		fmt.Println(string(jsonData))
+		return nil
+	}
+}
+
+func API(settings *services.Settings) ([]cli.Command, error) {
+
+	return []cli.Command{
+		{
+			Name:  "api",
+			Flags: []cli.Flag{},
+			Usage: "API-related commands.",
+			Subcommands: []cli.Command{
+				{
+					Name: "spec",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "server, s",
+							Value: "appointments",
+							Usage: "server for which to generate the specification (appointments or storage)",
+						},
+						&cli.StringFlag{
+							Name:  "output, o",
+							Value: "",
+							Usage: "file to write the specification to (default: stdout)",
+						},
+					},
+					Usage:  "print the OpenAPI specification of a server",
+					Action: apiSpec(),
+				},
+			},
+		},
+	}, nil
+}
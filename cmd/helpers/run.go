@@ -84,6 +84,19 @@ func initializeMetrics(settings *services.Settings) (Server, error) {
 
 type Initializer func(settings *services.Settings) (Server, error)
 
+// Opens the database and creates the meter, which only the servers require
+func initializeDatabase(settings *services.Settings) error {
+	if db, err := helpers.InitializeDatabase(settings); err != nil {
+		return err
+	} else if meter, err := helpers.InitializeMeter(settings); err != nil {
+		return err
+	} else {
+		settings.DatabaseObj = db
+		settings.MeterObj = meter
+		return nil
+	}
+}
+
 func startServer(settings *services.Settings, initializer Initializer) Server {
 
 	server, err := initializer(settings)
@@ -106,6 +119,9 @@ func startServer(settings *services.Settings, initializer Initializer) Server {
 
 func run(settings *services.Settings, initializers []Initializer) func(c *cli.Context) error {
 	return func(c *cli.Context) error {
+		if err := initializeDatabase(settings); err != nil {
+			services.Log.Fatal(err)
+		}
 		servers := make([]Server, 0)
 		for _, initializer := range initializers {
 			if server := startServer(settings, initializer); server != nil {
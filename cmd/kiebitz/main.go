@@ -43,15 +43,10 @@ func Settings(definitions *services.Definitions) (*services.Settings, error) {
 }
 
 func main() {
+	// the database and meter are only initialized by commands that need them
 	if settings, err := Settings(&definitions.Default); err != nil {
 		services.Log.Fatal(err)
-	} else if db, err := helpers.InitializeDatabase(settings); err != nil {
-		services.Log.Fatal(err)
-	} else if meter, err := helpers.InitializeMeter(settings); err != nil {
-		services.Log.Fatal(err)
 	} else {
-		settings.DatabaseObj = db
-		settings.MeterObj = meter
 		cmdHelpers.CLI(settings)
 	}
 }
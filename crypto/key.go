@@ -18,6 +18,10 @@
 
 package crypto
 
+import (
+	"time"
+)
+
 type Key struct {
 	Name      string                 `json:"name"`
 	Type      string                 `json:"type"`
@@ -27,6 +31,21 @@ type Key struct {
 	Purposes  []string               `json:"purposes"`
 	// only defined for local signing operations
 	PrivateKey []byte `json:"privateKey,omitempty"`
+	// optional validity period, which allows several versions of a key to
+	// be in use while rotating it
+	ValidFrom  *time.Time `json:"validFrom,omitempty"`
+	ValidUntil *time.Time `json:"validUntil,omitempty"`
+}
+
+// Returns true if the key is valid at the given time
+func (k *Key) ValidAt(t time.Time) bool {
+	if k.ValidFrom != nil && t.Before(*k.ValidFrom) {
+		return false
+	}
+	if k.ValidUntil != nil && !t.Before(*k.ValidUntil) {
+		return false
+	}
+	return true
 }
 
 func (k *Key) Encrypt(data []byte, recipient *Key) (*ECDHEncryptedData, error) {
@@ -48,6 +67,21 @@ func (k *Key) Encrypt(data []byte, recipient *Key) (*ECDHEncryptedData, error) {
 	}
 }
 
+// Decrypts data that has been encrypted for this key
+func (k *Key) Decrypt(data *ECDHEncryptedData) ([]byte, error) {
+	if privateKey, err := LoadPrivateKey(k.PrivateKey); err != nil {
+		return nil, err
+	} else if publicKey, err := LoadPublicKey(data.PublicKey); err != nil {
+		return nil, err
+	} else {
+		key := DeriveKey(publicKey, privateKey)
+		return Decrypt(&EncryptedData{
+			IV:   data.IV,
+			Data: data.Data,
+		}, key)
+	}
+}
+
 func (k *Key) SignString(data string) (*SignedStringData, error) {
 	if signature, err := k.Sign([]byte(data)); err != nil {
 		return nil, err
@@ -107,6 +107,9 @@ type Integer interface {
 	IncrBy(int64) (int64, error)
 	Get() (int64, error)
 	Del() error
+	// Returns the remaining time to live, which is 0 if the integer doesn't
+	// expire. Returns NotFound if the integer doesn't exist.
+	TTL() (time.Duration, error)
 }
 
 type Value interface {
@@ -114,6 +117,9 @@ type Value interface {
 	Set(value []byte, ttl time.Duration) error
 	Get() ([]byte, error)
 	Del() error
+	// Returns the remaining time to live, which is 0 if the value doesn't
+	// expire. Returns NotFound if the value doesn't exist.
+	TTL() (time.Duration, error)
 }
 
 type BaseDatabase struct {
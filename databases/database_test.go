@@ -0,0 +1,198 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package databases
+
+import (
+	"github.com/kiebitz-oss/services"
+	"sync"
+	"testing"
+	"time"
+)
+
+// These tests are run against every database implementation to ensure
+// they all behave like Redis.
+
+func testSortedSet(t *testing.T, db services.Database) {
+
+	ss := db.SortedSet("test", []byte("foo"))
+
+	for i, v := range []string{"c", "a", "b", "d"} {
+		if err := ss.Add([]byte(v), int64(i%2)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if entries, err := ss.Range(0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(entries))
+	} else if string(entries[0].Data) != "b" || string(entries[3].Data) != "d" {
+		t.Fatalf("wrong sort order")
+	}
+
+	if entries, err := ss.RangeByScore(1, 1); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+
+	if entry, err := ss.At(-1); err != nil {
+		t.Fatal(err)
+	} else if string(entry.Data) != "d" || entry.Score != 1 {
+		t.Fatalf("wrong entry")
+	}
+
+	if entries, err := ss.PopMin(1); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 || string(entries[0].Data) != "b" {
+		t.Fatalf("wrong entry popped")
+	}
+
+	if err := ss.RemoveRangeByScore(0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ss.Score([]byte("c")); err != NotFound {
+		t.Fatalf("expected entry to be removed")
+	}
+
+}
+
+func testTTL(t *testing.T, db services.Database) {
+
+	value := db.Value("test", []byte("foo"))
+
+	if err := value.Set([]byte("bar"), time.Millisecond*10); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := value.Get(); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "bar" {
+		t.Fatalf("wrong value")
+	}
+
+	if ttl, err := value.TTL(); err != nil {
+		t.Fatal(err)
+	} else if ttl <= 0 || ttl > time.Millisecond*10 {
+		t.Fatalf("wrong TTL: %v", ttl)
+	}
+
+	persistent := db.Value("test", []byte("baz"))
+
+	if err := persistent.Set([]byte("bar"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl, err := persistent.TTL(); err != nil {
+		t.Fatal(err)
+	} else if ttl != 0 {
+		t.Fatalf("expected no TTL, got %v", ttl)
+	}
+
+	counter := db.Integer("test", []byte("counter"))
+
+	if _, err := counter.IncrBy(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl, err := counter.TTL(); err != nil {
+		t.Fatal(err)
+	} else if ttl != 0 {
+		t.Fatalf("expected no TTL, got %v", ttl)
+	}
+
+	if err := db.Expire("test", []byte("counter"), time.Millisecond*10); err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl, err := counter.TTL(); err != nil {
+		t.Fatal(err)
+	} else if ttl <= 0 || ttl > time.Millisecond*10 {
+		t.Fatalf("wrong TTL: %v", ttl)
+	}
+
+	m := db.Map("test", []byte("bar"))
+
+	if err := m.Set([]byte("foo"), []byte("bar")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Expire("test", []byte("bar"), time.Millisecond*10); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 20)
+
+	if _, err := value.Get(); err != NotFound {
+		t.Fatalf("expected value to be expired")
+	}
+
+	if _, err := value.TTL(); err != NotFound {
+		t.Fatalf("expected no TTL for an expired value")
+	}
+
+	if _, err := m.Get([]byte("foo")); err != NotFound {
+		t.Fatalf("expected map to be expired")
+	}
+
+	if _, err := counter.TTL(); err != NotFound {
+		t.Fatalf("expected no TTL for an expired integer")
+	}
+
+}
+
+func testLock(t *testing.T, db services.Database) {
+
+	counter := db.Integer("test", []byte("counter"))
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock, err := db.Lock("counter")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer lock.Release()
+			// a non-atomic read-modify-write that is only safe under the lock
+			v, err := counter.Get()
+			if err != nil && err != NotFound {
+				t.Error(err)
+				return
+			}
+			time.Sleep(time.Millisecond)
+			if err := counter.Set(v+1, 0); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if v, err := counter.Get(); err != nil {
+		t.Fatal(err)
+	} else if v != 20 {
+		t.Fatalf("expected 20, got %d", v)
+	}
+
+}
@@ -35,6 +35,12 @@ var Databases = services.DatabaseDefinitions{
 		Maker:             MakeRedisShardAsDatabase,
 		SettingsValidator: ValidateRedisShardSettings,
 	},
+	"sql": services.DatabaseDefinition{
+		Name:              "SQL Database",
+		Description:       "PostgreSQL (for production use) or embedded SQLite",
+		Maker:             MakeSQLAsDatabase,
+		SettingsValidator: ValidateSQLSettings,
+	},
 	"in-memory": services.DatabaseDefinition{
 		Name:              "In-memory Database (no persistence! just use for testing)",
 		Description:       "An in-memory database for testing only",
@@ -19,8 +19,14 @@
 package databases
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"encoding/binary"
+	"errors"
 	"github.com/kiebitz-oss/services"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 )
 
@@ -29,9 +35,16 @@ type TTL struct {
 	TTL time.Time
 }
 
+// InMemory implements the full database interface on top of a simple
+// map. All values are stored as lists of byte strings in Data, expiration
+// times are kept in TTLs, which is sorted by expiration time. Expired keys
+// are removed lazily, i.e. whenever the database is accessed.
 type InMemory struct {
-	Data map[string][][]byte
-	TTLs []*TTL
+	Data  map[string][][]byte
+	TTLs  []*TTL
+	ttls  map[string]*TTL
+	locks map[string]chan bool
+	mutex sync.Mutex
 }
 
 // we hash all keys to SHA256 values to limit the storage size
@@ -45,7 +58,7 @@ func hash(key []byte) string {
 }
 
 func fk(table string, key []byte) []byte {
-	return append([]byte(table), key...)
+	return append([]byte(table+"::"), key...)
 }
 
 type InMemorySettings struct {
@@ -57,14 +70,21 @@ func ValidateInMemorySettings(settings map[string]interface{}) (interface{}, err
 
 func MakeInMemory(settings interface{}) (services.Database, error) {
 	return &InMemory{
-		Data: make(map[string][][]byte),
-		TTLs: make([]*TTL, 0, 100),
+		Data:  make(map[string][][]byte),
+		TTLs:  make([]*TTL, 0, 100),
+		ttls:  make(map[string]*TTL),
+		locks: make(map[string]chan bool),
 	}, nil
 }
 
 var _ services.Database = &InMemory{}
 
 func (d *InMemory) Reset() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.Data = make(map[string][][]byte)
+	d.TTLs = make([]*TTL, 0, 100)
+	d.ttls = make(map[string]*TTL)
 	return nil
 }
 
@@ -76,19 +96,142 @@ func (d *InMemory) Open() error {
 	return nil
 }
 
+type InMemoryLock struct {
+	db       *InMemory
+	lockKey  string
+	released chan bool
+}
+
+// Lock blocks until the lock with the given key is available
 func (d *InMemory) Lock(lockKey string) (services.Lock, error) {
-	return nil, nil
+	for {
+		d.mutex.Lock()
+		released, ok := d.locks[lockKey]
+		if !ok {
+			released = make(chan bool)
+			d.locks[lockKey] = released
+			d.mutex.Unlock()
+			return &InMemoryLock{
+				db:       d,
+				lockKey:  lockKey,
+				released: released,
+			}, nil
+		}
+		d.mutex.Unlock()
+		// we wait until the current holder releases the lock
+		<-released
+	}
+}
+
+func (l *InMemoryLock) Release() error {
+	l.db.mutex.Lock()
+	defer l.db.mutex.Unlock()
+	if released, ok := l.db.locks[l.lockKey]; !ok || released != l.released {
+		services.Log.Errorf("Unable to release lock %s, which is not held.", l.lockKey)
+		return errors.New("no lock")
+	}
+	delete(l.db.locks, l.lockKey)
+	close(l.released)
+	return nil
+}
+
+// the following helpers must only be called with the mutex held
+
+// removes all keys whose TTL has passed
+func (d *InMemory) purge() {
+	now := time.Now()
+	i := 0
+	for ; i < len(d.TTLs) && !d.TTLs[i].TTL.After(now); i++ {
+		delete(d.Data, d.TTLs[i].Key)
+		delete(d.ttls, d.TTLs[i].Key)
+	}
+	if i > 0 {
+		d.TTLs = d.TTLs[i:]
+	}
+}
+
+func (d *InMemory) get(key string) [][]byte {
+	d.purge()
+	return d.Data[key]
+}
+
+// stores the given entries, removing the key if there are none
+func (d *InMemory) put(key string, entries [][]byte) {
+	if len(entries) == 0 {
+		d.del(key)
+		return
+	}
+	d.Data[key] = entries
+}
+
+func (d *InMemory) del(key string) {
+	delete(d.Data, key)
+	d.removeTTL(key)
+}
+
+func (d *InMemory) removeTTL(key string) {
+	ttl, ok := d.ttls[key]
+	if !ok {
+		return
+	}
+	delete(d.ttls, key)
+	i := sort.Search(len(d.TTLs), func(i int) bool { return !d.TTLs[i].TTL.Before(ttl.TTL) })
+	for ; i < len(d.TTLs); i++ {
+		if d.TTLs[i] == ttl {
+			d.TTLs = append(d.TTLs[:i], d.TTLs[i+1:]...)
+			return
+		}
+	}
+}
+
+// sets the TTL of the given key, a zero TTL removes the expiration
+func (d *InMemory) setTTL(key string, ttl time.Duration) {
+	d.removeTTL(key)
+	if ttl <= 0 {
+		return
+	}
+	entry := &TTL{Key: key, TTL: time.Now().Add(ttl)}
+	i := sort.Search(len(d.TTLs), func(i int) bool { return d.TTLs[i].TTL.After(entry.TTL) })
+	d.TTLs = append(d.TTLs, nil)
+	copy(d.TTLs[i+1:], d.TTLs[i:])
+	d.TTLs[i] = entry
+	d.ttls[key] = entry
+}
+
+func cp(data []byte) []byte {
+	c := make([]byte, len(data))
+	copy(c, data)
+	return c
 }
 
 func (d *InMemory) Expire(table string, key []byte, ttl time.Duration) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	fullKey := hash(fk(table, key))
+	// like Redis we ignore keys that do not exist
+	if d.get(fullKey) == nil {
+		return nil
+	}
+	if ttl <= 0 {
+		d.del(fullKey)
+		return nil
+	}
+	d.setTTL(fullKey, ttl)
 	return nil
 }
 
 func (d *InMemory) Set(table string, key []byte) services.Set {
-	return nil
+	return &InMemorySet{
+		db:      d,
+		fullKey: hash(fk(table, key)),
+	}
 }
+
 func (d *InMemory) SortedSet(table string, key []byte) services.SortedSet {
-	return nil
+	return &InMemorySortedSet{
+		db:      d,
+		fullKey: hash(fk(table, key)),
+	}
 }
 
 func (d *InMemory) List(table string, key []byte) services.List {
@@ -96,13 +239,402 @@ func (d *InMemory) List(table string, key []byte) services.List {
 }
 
 func (d *InMemory) Map(table string, key []byte) services.Map {
-	return nil
+	return &InMemoryMap{
+		db:      d,
+		fullKey: hash(fk(table, key)),
+	}
 }
 
 func (d *InMemory) Value(table string, key []byte) services.Value {
-	return nil
+	return &InMemoryValue{
+		db:      d,
+		fullKey: hash(fk(table, key)),
+	}
 }
 
 func (d *InMemory) Integer(table string, key []byte) services.Integer {
+	return &InMemoryInteger{
+		db:      d,
+		fullKey: hash(fk(table, key)),
+	}
+}
+
+// A map is stored as a list of alternating keys and values
+type InMemoryMap struct {
+	db      *InMemory
+	fullKey string
+}
+
+func (m *InMemoryMap) Del(key []byte) error {
+	m.db.mutex.Lock()
+	defer m.db.mutex.Unlock()
+	entries := m.db.get(m.fullKey)
+	for i := 0; i < len(entries); i += 2 {
+		if bytes.Equal(entries[i], key) {
+			m.db.put(m.fullKey, append(entries[:i:i], entries[i+2:]...))
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *InMemoryMap) GetAll() (map[string][]byte, error) {
+	m.db.mutex.Lock()
+	defer m.db.mutex.Unlock()
+	entries := m.db.get(m.fullKey)
+	byteMap := map[string][]byte{}
+	for i := 0; i < len(entries); i += 2 {
+		byteMap[string(entries[i])] = cp(entries[i+1])
+	}
+	return byteMap, nil
+}
+
+func (m *InMemoryMap) Get(key []byte) ([]byte, error) {
+	m.db.mutex.Lock()
+	defer m.db.mutex.Unlock()
+	entries := m.db.get(m.fullKey)
+	for i := 0; i < len(entries); i += 2 {
+		if bytes.Equal(entries[i], key) {
+			return cp(entries[i+1]), nil
+		}
+	}
+	return nil, NotFound
+}
+
+func (m *InMemoryMap) Set(key []byte, value []byte) error {
+	m.db.mutex.Lock()
+	defer m.db.mutex.Unlock()
+	entries := m.db.get(m.fullKey)
+	for i := 0; i < len(entries); i += 2 {
+		if bytes.Equal(entries[i], key) {
+			entries[i+1] = cp(value)
+			return nil
+		}
+	}
+	m.db.put(m.fullKey, append(entries, cp(key), cp(value)))
+	return nil
+}
+
+type InMemorySet struct {
+	db      *InMemory
+	fullKey string
+}
+
+func (s *InMemorySet) Add(data []byte) error {
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+	entries := s.db.get(s.fullKey)
+	for _, entry := range entries {
+		if bytes.Equal(entry, data) {
+			return nil
+		}
+	}
+	s.db.put(s.fullKey, append(entries, cp(data)))
+	return nil
+}
+
+func (s *InMemorySet) Has(data []byte) (bool, error) {
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+	for _, entry := range s.db.get(s.fullKey) {
+		if bytes.Equal(entry, data) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *InMemorySet) Del(data []byte) error {
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+	entries := s.db.get(s.fullKey)
+	for i, entry := range entries {
+		if bytes.Equal(entry, data) {
+			s.db.put(s.fullKey, append(entries[:i:i], entries[i+1:]...))
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *InMemorySet) Members() ([]*services.SetEntry, error) {
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+
+	var entries []*services.SetEntry
+
+	for _, entry := range s.db.get(s.fullKey) {
+		entries = append(entries, &services.SetEntry{
+			Data: cp(entry),
+		})
+	}
+	return entries, nil
+}
+
+type InMemoryInteger struct {
+	db      *InMemory
+	fullKey string
+}
+
+func (i *InMemoryInteger) Set(value int64, ttl time.Duration) error {
+	i.db.mutex.Lock()
+	defer i.db.mutex.Unlock()
+	i.db.purge()
+	i.db.put(i.fullKey, [][]byte{[]byte(strconv.FormatInt(value, 10))})
+	i.db.setTTL(i.fullKey, ttl)
+	return nil
+}
+
+func (i *InMemoryInteger) get() (int64, error) {
+	entries := i.db.get(i.fullKey)
+	if entries == nil {
+		return 0, NotFound
+	}
+	return strconv.ParseInt(string(entries[0]), 10, 64)
+}
+
+func (i *InMemoryInteger) IncrBy(value int64) (int64, error) {
+	i.db.mutex.Lock()
+	defer i.db.mutex.Unlock()
+	current, err := i.get()
+	if err != nil && err != NotFound {
+		return 0, err
+	}
+	current += value
+	// like in Redis, incrementing a value retains its TTL
+	i.db.put(i.fullKey, [][]byte{[]byte(strconv.FormatInt(current, 10))})
+	return current, nil
+}
+
+func (i *InMemoryInteger) Get() (int64, error) {
+	i.db.mutex.Lock()
+	defer i.db.mutex.Unlock()
+	return i.get()
+}
+
+func (i *InMemoryInteger) Del() error {
+	i.db.mutex.Lock()
+	defer i.db.mutex.Unlock()
+	i.db.del(i.fullKey)
+	return nil
+}
+
+func (i *InMemoryInteger) TTL() (time.Duration, error) {
+	i.db.mutex.Lock()
+	defer i.db.mutex.Unlock()
+	if i.db.get(i.fullKey) == nil {
+		return 0, NotFound
+	}
+	if ttl, ok := i.db.ttls[i.fullKey]; ok {
+		return time.Until(ttl.TTL), nil
+	}
+	return 0, nil
+}
+
+type InMemoryValue struct {
+	db      *InMemory
+	fullKey string
+}
+
+func (v *InMemoryValue) Set(data []byte, ttl time.Duration) error {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	v.db.purge()
+	v.db.Data[v.fullKey] = [][]byte{cp(data)}
+	v.db.setTTL(v.fullKey, ttl)
+	return nil
+}
+
+func (v *InMemoryValue) Get() ([]byte, error) {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	entries := v.db.get(v.fullKey)
+	if entries == nil {
+		return nil, NotFound
+	}
+	return cp(entries[0]), nil
+}
+
+func (v *InMemoryValue) TTL() (time.Duration, error) {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	if v.db.get(v.fullKey) == nil {
+		return 0, NotFound
+	}
+	if ttl, ok := v.db.ttls[v.fullKey]; ok {
+		return time.Until(ttl.TTL), nil
+	}
+	return 0, nil
+}
+
+func (v *InMemoryValue) Del() error {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	v.db.del(v.fullKey)
+	return nil
+}
+
+// A sorted set is stored as a list of alternating scores and members,
+// ordered by score and then by member (like in Redis).
+type InMemorySortedSet struct {
+	db      *InMemory
+	fullKey string
+}
+
+func (s *InMemorySortedSet) entries() []*services.SortedSetEntry {
+	data := s.db.get(s.fullKey)
+	entries := make([]*services.SortedSetEntry, 0, len(data)/2)
+	for i := 0; i < len(data); i += 2 {
+		entries = append(entries, &services.SortedSetEntry{
+			Score: int64(binary.BigEndian.Uint64(data[i])),
+			Data:  data[i+1],
+		})
+	}
+	return entries
+}
+
+func (s *InMemorySortedSet) store(entries []*services.SortedSetEntry) {
+	data := make([][]byte, 0, len(entries)*2)
+	for _, entry := range entries {
+		score := make([]byte, 8)
+		binary.BigEndian.PutUint64(score, uint64(entry.Score))
+		data = append(data, score, entry.Data)
+	}
+	s.db.put(s.fullKey, data)
+}
+
+func copyEntries(entries []*services.SortedSetEntry) []*services.SortedSetEntry {
+	result := make([]*services.SortedSetEntry, len(entries))
+	for i, entry := range entries {
+		result[i] = &services.SortedSetEntry{
+			Score: entry.Score,
+			Data:  cp(entry.Data),
+		}
+	}
+	return result
+}
+
+// converts Redis-style (possibly negative) range indexes to slice bounds
+func rangeBounds(from, to, n int64) (int64, int64) {
+	if from < 0 {
+		from += n
+	}
+	if to < 0 {
+		to += n
+	}
+	if from < 0 {
+		from = 0
+	}
+	if to >= n {
+		to = n - 1
+	}
+	if from > to {
+		return 0, 0
+	}
+	return from, to + 1
+}
+
+func (s *InMemorySortedSet) Score(data []byte) (int64, error) {
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+	for _, entry := range s.entries() {
+		if bytes.Equal(entry.Data, data) {
+			return entry.Score, nil
+		}
+	}
+	return 0, NotFound
+}
+
+func (s *InMemorySortedSet) Add(data []byte, score int64) error {
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+	entries := s.entries()
+	for i, entry := range entries {
+		if bytes.Equal(entry.Data, data) {
+			entries = append(entries[:i], entries[i+1:]...)
+			break
+		}
+	}
+	entry := &services.SortedSetEntry{Score: score, Data: cp(data)}
+	i := sort.Search(len(entries), func(i int) bool {
+		if entries[i].Score != score {
+			return entries[i].Score > score
+		}
+		return bytes.Compare(entries[i].Data, data) > 0
+	})
+	entries = append(entries, nil)
+	copy(entries[i+1:], entries[i:])
+	entries[i] = entry
+	s.store(entries)
+	return nil
+}
+
+func (s *InMemorySortedSet) Del(data []byte) (bool, error) {
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+	entries := s.entries()
+	for i, entry := range entries {
+		if bytes.Equal(entry.Data, data) {
+			s.store(append(entries[:i], entries[i+1:]...))
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *InMemorySortedSet) Range(from, to int64) ([]*services.SortedSetEntry, error) {
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+	entries := s.entries()
+	i, j := rangeBounds(from, to, int64(len(entries)))
+	return copyEntries(entries[i:j]), nil
+}
+
+func (s *InMemorySortedSet) RangeByScore(from, to int64) ([]*services.SortedSetEntry, error) {
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+	result := []*services.SortedSetEntry{}
+	for _, entry := range s.entries() {
+		if entry.Score >= from && entry.Score <= to {
+			result = append(result, entry)
+		}
+	}
+	return copyEntries(result), nil
+}
+
+func (s *InMemorySortedSet) At(index int64) (*services.SortedSetEntry, error) {
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+	entries := s.entries()
+	i, j := rangeBounds(index, index, int64(len(entries)))
+	if i == j {
+		return nil, NotFound
+	}
+	return copyEntries(entries[i:j])[0], nil
+}
+
+func (s *InMemorySortedSet) PopMin(n int64) ([]*services.SortedSetEntry, error) {
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+	entries := s.entries()
+	if n > int64(len(entries)) {
+		n = int64(len(entries))
+	}
+	result := copyEntries(entries[:n])
+	s.store(entries[n:])
+	return result, nil
+}
+
+func (s *InMemorySortedSet) RemoveRangeByScore(from, to int64) error {
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+	entries := s.entries()
+	remaining := make([]*services.SortedSetEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Score < from || entry.Score > to {
+			remaining = append(remaining, entry)
+		}
+	}
+	s.store(remaining)
 	return nil
 }
@@ -60,9 +60,16 @@ func MakeRedisLock(ctx context.Context, lockKey string, client redis.UniversalCl
 	}
 }
 
+// locks expire automatically after this time, so that a crashed process
+// can't block others forever
+var LockTTL = 2 * time.Second
+
 func (r *RedisLock) Lock() error {
 
-	lock, err := r.dLockClient.Obtain(r.ctx, r.lockKey, 100*time.Millisecond, nil)
+	lock, err := r.dLockClient.Obtain(r.ctx, r.lockKey, LockTTL, &redislock.Options{
+		// if the lock is taken we retry until it would have expired anyway
+		RetryStrategy: redislock.LimitRetry(redislock.LinearBackoff(10*time.Millisecond), int(LockTTL/(10*time.Millisecond))),
+	})
 
 	if err != nil {
 		return err
@@ -573,6 +580,21 @@ func (r *RedisInteger) Del() error {
 	return r.db.Client(r.fullKey).Del(r.db.Ctx, string(r.fullKey)).Err()
 }
 
+func (r *RedisInteger) TTL() (time.Duration, error) {
+	ttl, err := r.db.Client(r.fullKey).TTL(r.db.Ctx, string(r.fullKey)).Result()
+	if err != nil {
+		return 0, err
+	}
+	// Redis returns -2 for missing keys and -1 for keys without a TTL
+	switch ttl {
+	case -2:
+		return 0, NotFound
+	case -1:
+		return 0, nil
+	}
+	return ttl, nil
+}
+
 type RedisValue struct {
 	db      *Redis
 	fullKey string
@@ -593,6 +615,21 @@ func (r *RedisValue) Get() ([]byte, error) {
 	return []byte(result), nil
 }
 
+func (r *RedisValue) TTL() (time.Duration, error) {
+	ttl, err := r.db.Client(r.fullKey).TTL(r.db.Ctx, string(r.fullKey)).Result()
+	if err != nil {
+		return 0, err
+	}
+	// Redis returns -2 for missing keys and -1 for keys without a TTL
+	switch ttl {
+	case -2:
+		return 0, NotFound
+	case -1:
+		return 0, nil
+	}
+	return ttl, nil
+}
+
 func (r *RedisValue) Del() error {
 	return r.db.Client(r.fullKey).Del(r.db.Ctx, string(r.fullKey)).Err()
 }
@@ -0,0 +1,811 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package databases
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiprotect/go-helpers/forms"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQL implements the database interface on top of a relational database.
+// We support PostgreSQL for production use as well as SQLite, which can run
+// embedded (e.g. in-memory) and hence requires no outside services.
+type SQL struct {
+	db      *sql.DB
+	dialect *SQLDialect
+}
+
+type SQLSettings struct {
+	Driver string `json:"driver"`
+	DSN    string `json:"dsn"`
+}
+
+type SQLDialect struct {
+	// the name of the database/sql driver
+	Driver string
+	// the type we use for binary data
+	Blob string
+	// whether placeholders are numbered ($1, $2, ...) instead of '?'
+	Numbered bool
+	// the maximum number of open connections (0 means unlimited)
+	MaxOpenConns int
+}
+
+var SQLDialects = map[string]*SQLDialect{
+	"postgres": &SQLDialect{
+		Driver:   "postgres",
+		Blob:     "BYTEA",
+		Numbered: true,
+	},
+	"sqlite": &SQLDialect{
+		Driver: "sqlite",
+		Blob:   "BLOB",
+		// SQLite only supports a single writer, in addition every connection
+		// to an in-memory database would get its own database otherwise
+		MaxOpenConns: 1,
+	},
+}
+
+var SQLForm = forms.Form{
+	ErrorMsg: "invalid data encountered in the SQL config form",
+	Fields: []forms.Field{
+		{
+			Name: "driver",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: "sqlite"},
+				forms.IsIn{Choices: []interface{}{"postgres", "sqlite"}},
+			},
+		},
+		{
+			Name: "dsn",
+			Validators: []forms.Validator{
+				// by default we use an embedded in-memory database
+				forms.IsOptional{Default: ":memory:"},
+				forms.IsString{},
+			},
+		},
+	},
+}
+
+// Schema migrations, which get applied in order when opening the database.
+// Never modify an existing migration, always add a new one instead. '{blob}'
+// gets replaced by the binary data type of the given dialect.
+var SQLMigrations = [][]string{
+	{
+		`CREATE TABLE kv_values (key {blob} PRIMARY KEY, value {blob} NOT NULL)`,
+		`CREATE TABLE kv_integers (key {blob} PRIMARY KEY, value BIGINT NOT NULL)`,
+		`CREATE TABLE kv_maps (key {blob} NOT NULL, field {blob} NOT NULL, value {blob} NOT NULL, PRIMARY KEY (key, field))`,
+		`CREATE TABLE kv_sets (key {blob} NOT NULL, member {blob} NOT NULL, PRIMARY KEY (key, member))`,
+		`CREATE TABLE kv_sorted_sets (key {blob} NOT NULL, member {blob} NOT NULL, score BIGINT NOT NULL, PRIMARY KEY (key, member))`,
+		`CREATE INDEX kv_sorted_sets_score ON kv_sorted_sets (key, score, member)`,
+		`CREATE TABLE kv_expiry (key {blob} PRIMARY KEY, expires_at BIGINT NOT NULL)`,
+		`CREATE INDEX kv_expiry_expires_at ON kv_expiry (expires_at)`,
+		`CREATE TABLE kv_locks (key TEXT PRIMARY KEY, token {blob} NOT NULL, expires_at BIGINT NOT NULL)`,
+	},
+}
+
+// all tables that contain data for a given key
+var sqlDataTables = []string{"kv_values", "kv_integers", "kv_maps", "kv_sets", "kv_sorted_sets"}
+
+func ValidateSQLSettings(settings map[string]interface{}) (interface{}, error) {
+	if params, err := SQLForm.Validate(settings); err != nil {
+		return nil, err
+	} else {
+		sqlSettings := &SQLSettings{}
+		if err := SQLForm.Coerce(sqlSettings, params); err != nil {
+			return nil, err
+		}
+		return sqlSettings, nil
+	}
+}
+
+func MakeSQL(settings interface{}) (*SQL, error) {
+	sqlSettings := settings.(*SQLSettings)
+
+	dialect, ok := SQLDialects[sqlSettings.Driver]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown SQL driver: '%s'", sqlSettings.Driver)
+	}
+
+	db, err := sql.Open(dialect.Driver, sqlSettings.DSN)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if dialect.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(dialect.MaxOpenConns)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	services.Log.Infof("Creating %s database", sqlSettings.Driver)
+
+	return &SQL{
+		db:      db,
+		dialect: dialect,
+	}, nil
+}
+
+func MakeSQLAsDatabase(settings interface{}) (services.Database, error) {
+	var db services.Database
+	var err error
+
+	db, err = MakeSQL(settings)
+
+	return db, err
+}
+
+// Makes sure, that SQL implements Database
+var _ services.Database = &SQL{}
+
+// converts a query into the format of the dialect
+func (d *SQL) q(query string) string {
+	query = strings.ReplaceAll(query, "{blob}", d.dialect.Blob)
+	if !d.dialect.Numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// Applies all schema migrations that have not been applied yet
+func (d *SQL) Migrate() error {
+
+	if _, err := d.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return err
+	}
+
+	var version int
+
+	if err := d.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(SQLMigrations); i++ {
+		services.Log.Infof("Applying SQL migration %d", i+1)
+		if err := d.withTx(func(tx *sql.Tx) error {
+			for _, statement := range SQLMigrations[i] {
+				if _, err := tx.Exec(d.q(statement)); err != nil {
+					return err
+				}
+			}
+			_, err := tx.Exec(d.q(`INSERT INTO schema_migrations (version) VALUES (?)`), i+1)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runs the given function in a transaction, which is rolled back if the
+// function returns an error
+func (d *SQL) withTx(f func(tx *sql.Tx) error) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *SQL) Reset() error {
+	return d.withTx(func(tx *sql.Tx) error {
+		for _, table := range append(sqlDataTables, "kv_expiry", "kv_locks") {
+			if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s`, table)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *SQL) Open() error {
+	return d.Migrate()
+}
+
+func (d *SQL) Close() error {
+	return d.db.Close()
+}
+
+type SQLLock struct {
+	db      *SQL
+	lockKey string
+	token   []byte
+}
+
+// Obtains the lock, retrying until it would have expired anyway (like the
+// Redis lock)
+func (d *SQL) Lock(lockKey string) (services.Lock, error) {
+
+	token := make([]byte, 16)
+
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(LockTTL)
+
+	for {
+		now := time.Now()
+		// we only take over an existing lock if it has expired
+		if result, err := d.db.Exec(d.q(`INSERT INTO kv_locks (key, token, expires_at) VALUES (?, ?, ?)
+			ON CONFLICT (key) DO UPDATE SET token = excluded.token, expires_at = excluded.expires_at
+			WHERE kv_locks.expires_at < ?`), lockKey, token, now.Add(LockTTL).UnixNano(), now.UnixNano()); err != nil {
+			return nil, err
+		} else if n, err := result.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 1 {
+			return &SQLLock{
+				db:      d,
+				lockKey: lockKey,
+				token:   token,
+			}, nil
+		}
+		if now.After(deadline) {
+			return nil, fmt.Errorf("cannot obtain lock %s", lockKey)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (l *SQLLock) Release() error {
+	if result, err := l.db.db.Exec(l.db.q(`DELETE FROM kv_locks WHERE key = ? AND token = ?`), l.lockKey, l.token); err != nil {
+		return err
+	} else if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		services.Log.Errorf("Unable to release lock %s, which is not held anymore.", l.lockKey)
+		return errors.New("no lock")
+	}
+	return nil
+}
+
+// deletes all data for the given key
+func (d *SQL) delete(tx *sql.Tx, key []byte) error {
+	for _, table := range append(sqlDataTables, "kv_expiry") {
+		if _, err := tx.Exec(d.q(fmt.Sprintf(`DELETE FROM %s WHERE key = ?`, table)), key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removes the data of the given key if it has expired, we call this before
+// every operation on a key so that expired data is never visible
+func (d *SQL) expire(key []byte) error {
+	var expiresAt int64
+	if err := d.db.QueryRow(d.q(`SELECT expires_at FROM kv_expiry WHERE key = ?`), key).Scan(&expiresAt); err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if expiresAt > time.Now().UnixNano() {
+		return nil
+	}
+	return d.withTx(func(tx *sql.Tx) error {
+		return d.delete(tx, key)
+	})
+}
+
+// sets the TTL of the given key, a zero TTL removes the expiration
+func (d *SQL) setTTL(tx *sql.Tx, key []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		_, err := tx.Exec(d.q(`DELETE FROM kv_expiry WHERE key = ?`), key)
+		return err
+	}
+	_, err := tx.Exec(d.q(`INSERT INTO kv_expiry (key, expires_at) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET expires_at = excluded.expires_at`), key, time.Now().Add(ttl).UnixNano())
+	return err
+}
+
+// like in Redis, collections are removed (with their TTL) once they are empty
+func (d *SQL) deleteIfEmpty(tx *sql.Tx, table string, key []byte) error {
+	_, err := tx.Exec(d.q(fmt.Sprintf(`DELETE FROM kv_expiry WHERE key = ? AND NOT EXISTS (SELECT 1 FROM %s WHERE key = ?)`, table)), key, key)
+	return err
+}
+
+func (d *SQL) Expire(table string, key []byte, ttl time.Duration) error {
+	fullKey := d.fullKey(table, key)
+	if err := d.expire(fullKey); err != nil {
+		return err
+	}
+	// like Redis we ignore keys that do not exist
+	queries := make([]string, len(sqlDataTables))
+	args := make([]interface{}, len(sqlDataTables))
+	for i, table := range sqlDataTables {
+		queries[i] = fmt.Sprintf(`SELECT 1 FROM %s WHERE key = ?`, table)
+		args[i] = fullKey
+	}
+	var exists int
+	if err := d.db.QueryRow(d.q(strings.Join(queries, " UNION ALL ")+" LIMIT 1"), args...).Scan(&exists); err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return d.withTx(func(tx *sql.Tx) error {
+		if ttl <= 0 {
+			return d.delete(tx, fullKey)
+		}
+		return d.setTTL(tx, fullKey, ttl)
+	})
+}
+
+func (d *SQL) Set(table string, key []byte) services.Set {
+	return &SQLSet{
+		db:      d,
+		fullKey: d.fullKey(table, key),
+	}
+}
+
+func (d *SQL) SortedSet(table string, key []byte) services.SortedSet {
+	return &SQLSortedSet{
+		db:      d,
+		fullKey: d.fullKey(table, key),
+	}
+}
+
+func (d *SQL) List(table string, key []byte) services.List {
+	return nil
+}
+
+func (d *SQL) Map(table string, key []byte) services.Map {
+	return &SQLMap{
+		db:      d,
+		fullKey: d.fullKey(table, key),
+	}
+}
+
+func (d *SQL) Value(table string, key []byte) services.Value {
+	return &SQLValue{
+		db:      d,
+		fullKey: d.fullKey(table, key),
+	}
+}
+
+func (d *SQL) Integer(table string, key []byte) services.Integer {
+	return &SQLInteger{
+		db:      d,
+		fullKey: d.fullKey(table, key),
+	}
+}
+
+func (d *SQL) fullKey(table string, key []byte) []byte {
+	return []byte(fmt.Sprintf("%s::%s", table, string(key)))
+}
+
+type SQLMap struct {
+	db      *SQL
+	fullKey []byte
+}
+
+func (m *SQLMap) Del(key []byte) error {
+	if err := m.db.expire(m.fullKey); err != nil {
+		return err
+	}
+	return m.db.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(m.db.q(`DELETE FROM kv_maps WHERE key = ? AND field = ?`), m.fullKey, key); err != nil {
+			return err
+		}
+		return m.db.deleteIfEmpty(tx, "kv_maps", m.fullKey)
+	})
+}
+
+func (m *SQLMap) GetAll() (map[string][]byte, error) {
+	if err := m.db.expire(m.fullKey); err != nil {
+		return nil, err
+	}
+	rows, err := m.db.db.Query(m.db.q(`SELECT field, value FROM kv_maps WHERE key = ?`), m.fullKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byteMap := map[string][]byte{}
+	for rows.Next() {
+		var field, value []byte
+		if err := rows.Scan(&field, &value); err != nil {
+			return nil, err
+		}
+		byteMap[string(field)] = value
+	}
+	return byteMap, rows.Err()
+}
+
+func (m *SQLMap) Get(key []byte) ([]byte, error) {
+	if err := m.db.expire(m.fullKey); err != nil {
+		return nil, err
+	}
+	var value []byte
+	if err := m.db.db.QueryRow(m.db.q(`SELECT value FROM kv_maps WHERE key = ? AND field = ?`), m.fullKey, key).Scan(&value); err == sql.ErrNoRows {
+		return nil, NotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (m *SQLMap) Set(key []byte, value []byte) error {
+	if err := m.db.expire(m.fullKey); err != nil {
+		return err
+	}
+	_, err := m.db.db.Exec(m.db.q(`INSERT INTO kv_maps (key, field, value) VALUES (?, ?, ?)
+		ON CONFLICT (key, field) DO UPDATE SET value = excluded.value`), m.fullKey, key, value)
+	return err
+}
+
+type SQLSet struct {
+	db      *SQL
+	fullKey []byte
+}
+
+func (s *SQLSet) Add(data []byte) error {
+	if err := s.db.expire(s.fullKey); err != nil {
+		return err
+	}
+	_, err := s.db.db.Exec(s.db.q(`INSERT INTO kv_sets (key, member) VALUES (?, ?)
+		ON CONFLICT (key, member) DO NOTHING`), s.fullKey, data)
+	return err
+}
+
+func (s *SQLSet) Has(data []byte) (bool, error) {
+	if err := s.db.expire(s.fullKey); err != nil {
+		return false, err
+	}
+	var exists int
+	if err := s.db.db.QueryRow(s.db.q(`SELECT 1 FROM kv_sets WHERE key = ? AND member = ?`), s.fullKey, data).Scan(&exists); err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *SQLSet) Del(data []byte) error {
+	if err := s.db.expire(s.fullKey); err != nil {
+		return err
+	}
+	return s.db.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(s.db.q(`DELETE FROM kv_sets WHERE key = ? AND member = ?`), s.fullKey, data); err != nil {
+			return err
+		}
+		return s.db.deleteIfEmpty(tx, "kv_sets", s.fullKey)
+	})
+}
+
+func (s *SQLSet) Members() ([]*services.SetEntry, error) {
+	if err := s.db.expire(s.fullKey); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.db.Query(s.db.q(`SELECT member FROM kv_sets WHERE key = ?`), s.fullKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*services.SetEntry
+
+	for rows.Next() {
+		var member []byte
+		if err := rows.Scan(&member); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &services.SetEntry{
+			Data: member,
+		})
+	}
+	return entries, rows.Err()
+}
+
+type SQLInteger struct {
+	db      *SQL
+	fullKey []byte
+}
+
+func (i *SQLInteger) Set(value int64, ttl time.Duration) error {
+	if err := i.db.expire(i.fullKey); err != nil {
+		return err
+	}
+	return i.db.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(i.db.q(`INSERT INTO kv_integers (key, value) VALUES (?, ?)
+			ON CONFLICT (key) DO UPDATE SET value = excluded.value`), i.fullKey, value); err != nil {
+			return err
+		}
+		return i.db.setTTL(tx, i.fullKey, ttl)
+	})
+}
+
+func (i *SQLInteger) IncrBy(value int64) (int64, error) {
+	if err := i.db.expire(i.fullKey); err != nil {
+		return 0, err
+	}
+	var result int64
+	if err := i.db.db.QueryRow(i.db.q(`INSERT INTO kv_integers (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = kv_integers.value + excluded.value
+		RETURNING value`), i.fullKey, value).Scan(&result); err != nil {
+		return 0, err
+	}
+	return result, nil
+}
+
+func (i *SQLInteger) Get() (int64, error) {
+	if err := i.db.expire(i.fullKey); err != nil {
+		return 0, err
+	}
+	var value int64
+	if err := i.db.db.QueryRow(i.db.q(`SELECT value FROM kv_integers WHERE key = ?`), i.fullKey).Scan(&value); err == sql.ErrNoRows {
+		return 0, NotFound
+	} else if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+func (i *SQLInteger) Del() error {
+	return i.db.withTx(func(tx *sql.Tx) error {
+		return i.db.delete(tx, i.fullKey)
+	})
+}
+
+func (i *SQLInteger) TTL() (time.Duration, error) {
+	if err := i.db.expire(i.fullKey); err != nil {
+		return 0, err
+	}
+	var exists int
+	if err := i.db.db.QueryRow(i.db.q(`SELECT 1 FROM kv_integers WHERE key = ?`), i.fullKey).Scan(&exists); err == sql.ErrNoRows {
+		return 0, NotFound
+	} else if err != nil {
+		return 0, err
+	}
+	var expiresAt int64
+	if err := i.db.db.QueryRow(i.db.q(`SELECT expires_at FROM kv_expiry WHERE key = ?`), i.fullKey).Scan(&expiresAt); err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return time.Until(time.Unix(0, expiresAt)), nil
+}
+
+type SQLValue struct {
+	db      *SQL
+	fullKey []byte
+}
+
+func (v *SQLValue) Set(data []byte, ttl time.Duration) error {
+	if err := v.db.expire(v.fullKey); err != nil {
+		return err
+	}
+	return v.db.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(v.db.q(`INSERT INTO kv_values (key, value) VALUES (?, ?)
+			ON CONFLICT (key) DO UPDATE SET value = excluded.value`), v.fullKey, data); err != nil {
+			return err
+		}
+		return v.db.setTTL(tx, v.fullKey, ttl)
+	})
+}
+
+func (v *SQLValue) Get() ([]byte, error) {
+	if err := v.db.expire(v.fullKey); err != nil {
+		return nil, err
+	}
+	var value []byte
+	if err := v.db.db.QueryRow(v.db.q(`SELECT value FROM kv_values WHERE key = ?`), v.fullKey).Scan(&value); err == sql.ErrNoRows {
+		return nil, NotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (v *SQLValue) TTL() (time.Duration, error) {
+	if err := v.db.expire(v.fullKey); err != nil {
+		return 0, err
+	}
+	var exists int
+	if err := v.db.db.QueryRow(v.db.q(`SELECT 1 FROM kv_values WHERE key = ?`), v.fullKey).Scan(&exists); err == sql.ErrNoRows {
+		return 0, NotFound
+	} else if err != nil {
+		return 0, err
+	}
+	var expiresAt int64
+	if err := v.db.db.QueryRow(v.db.q(`SELECT expires_at FROM kv_expiry WHERE key = ?`), v.fullKey).Scan(&expiresAt); err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return time.Until(time.Unix(0, expiresAt)), nil
+}
+
+func (v *SQLValue) Del() error {
+	return v.db.withTx(func(tx *sql.Tx) error {
+		return v.db.delete(tx, v.fullKey)
+	})
+}
+
+type SQLSortedSet struct {
+	db      *SQL
+	fullKey []byte
+}
+
+func (s *SQLSortedSet) entries(query string, args ...interface{}) ([]*services.SortedSetEntry, error) {
+	rows, err := s.db.db.Query(s.db.q(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*services.SortedSetEntry{}
+
+	for rows.Next() {
+		entry := &services.SortedSetEntry{}
+		if err := rows.Scan(&entry.Data, &entry.Score); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SQLSortedSet) Score(data []byte) (int64, error) {
+	if err := s.db.expire(s.fullKey); err != nil {
+		return 0, err
+	}
+	var score int64
+	if err := s.db.db.QueryRow(s.db.q(`SELECT score FROM kv_sorted_sets WHERE key = ? AND member = ?`), s.fullKey, data).Scan(&score); err == sql.ErrNoRows {
+		return 0, NotFound
+	} else if err != nil {
+		return 0, err
+	}
+	return score, nil
+}
+
+func (s *SQLSortedSet) Add(data []byte, score int64) error {
+	if err := s.db.expire(s.fullKey); err != nil {
+		return err
+	}
+	_, err := s.db.db.Exec(s.db.q(`INSERT INTO kv_sorted_sets (key, member, score) VALUES (?, ?, ?)
+		ON CONFLICT (key, member) DO UPDATE SET score = excluded.score`), s.fullKey, data, score)
+	return err
+}
+
+func (s *SQLSortedSet) Del(data []byte) (bool, error) {
+	if err := s.db.expire(s.fullKey); err != nil {
+		return false, err
+	}
+	var n int64
+	err := s.db.withTx(func(tx *sql.Tx) error {
+		if result, err := tx.Exec(s.db.q(`DELETE FROM kv_sorted_sets WHERE key = ? AND member = ?`), s.fullKey, data); err != nil {
+			return err
+		} else if n, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		return s.db.deleteIfEmpty(tx, "kv_sorted_sets", s.fullKey)
+	})
+	return n > 0, err
+}
+
+// converts Redis-style (possibly negative) indexes to a limit and offset
+func (s *SQLSortedSet) limits(from, to int64) (int64, int64, error) {
+	var n int64
+	if err := s.db.db.QueryRow(s.db.q(`SELECT COUNT(*) FROM kv_sorted_sets WHERE key = ?`), s.fullKey).Scan(&n); err != nil {
+		return 0, 0, err
+	}
+	i, j := rangeBounds(from, to, n)
+	return j - i, i, nil
+}
+
+func (s *SQLSortedSet) Range(from, to int64) ([]*services.SortedSetEntry, error) {
+	if err := s.db.expire(s.fullKey); err != nil {
+		return nil, err
+	}
+	limit, offset, err := s.limits(from, to)
+	if err != nil {
+		return nil, err
+	}
+	if limit == 0 {
+		return []*services.SortedSetEntry{}, nil
+	}
+	return s.entries(`SELECT member, score FROM kv_sorted_sets WHERE key = ?
+		ORDER BY score, member LIMIT ? OFFSET ?`, s.fullKey, limit, offset)
+}
+
+func (s *SQLSortedSet) RangeByScore(from, to int64) ([]*services.SortedSetEntry, error) {
+	if err := s.db.expire(s.fullKey); err != nil {
+		return nil, err
+	}
+	return s.entries(`SELECT member, score FROM kv_sorted_sets WHERE key = ? AND score >= ? AND score <= ?
+		ORDER BY score, member`, s.fullKey, from, to)
+}
+
+func (s *SQLSortedSet) At(index int64) (*services.SortedSetEntry, error) {
+	if entries, err := s.Range(index, index); err != nil {
+		return nil, err
+	} else if len(entries) == 0 {
+		return nil, NotFound
+	} else {
+		return entries[0], nil
+	}
+}
+
+func (s *SQLSortedSet) PopMin(n int64) ([]*services.SortedSetEntry, error) {
+	if err := s.db.expire(s.fullKey); err != nil {
+		return nil, err
+	}
+	entries, err := s.entries(`SELECT member, score FROM kv_sorted_sets WHERE key = ?
+		ORDER BY score, member LIMIT ?`, s.fullKey, n)
+	if err != nil {
+		return nil, err
+	}
+	popped := []*services.SortedSetEntry{}
+	err = s.db.withTx(func(tx *sql.Tx) error {
+		for _, entry := range entries {
+			// we only return entries that no one else has popped in the meantime
+			if result, err := tx.Exec(s.db.q(`DELETE FROM kv_sorted_sets WHERE key = ? AND member = ?`), s.fullKey, entry.Data); err != nil {
+				return err
+			} else if n, err := result.RowsAffected(); err != nil {
+				return err
+			} else if n > 0 {
+				popped = append(popped, entry)
+			}
+		}
+		return s.db.deleteIfEmpty(tx, "kv_sorted_sets", s.fullKey)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return popped, nil
+}
+
+func (s *SQLSortedSet) RemoveRangeByScore(from, to int64) error {
+	if err := s.db.expire(s.fullKey); err != nil {
+		return err
+	}
+	return s.db.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(s.db.q(`DELETE FROM kv_sorted_sets WHERE key = ? AND score >= ? AND score <= ?`), s.fullKey, from, to); err != nil {
+			return err
+		}
+		return s.db.deleteIfEmpty(tx, "kv_sorted_sets", s.fullKey)
+	})
+}
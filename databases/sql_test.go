@@ -0,0 +1,61 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package databases
+
+import (
+	"testing"
+)
+
+func makeSQLite(t *testing.T) *SQL {
+	db, err := MakeSQL(&SQLSettings{Driver: "sqlite", DSN: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSQLSortedSet(t *testing.T) {
+	db := makeSQLite(t)
+	defer db.Close()
+	testSortedSet(t, db)
+}
+
+func TestSQLTTL(t *testing.T) {
+	db := makeSQLite(t)
+	defer db.Close()
+	testTTL(t, db)
+}
+
+func TestSQLLock(t *testing.T) {
+	db := makeSQLite(t)
+	defer db.Close()
+	testLock(t, db)
+}
+
+func TestSQLMigrate(t *testing.T) {
+	db := makeSQLite(t)
+	defer db.Close()
+	// applying the migrations again should be a no-op
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -24,7 +24,6 @@ import (
 	"github.com/kiebitz-oss/services"
 	"github.com/kiprotect/go-helpers/forms"
 	"regexp"
-	"strings"
 	"time"
 )
 
@@ -71,36 +70,173 @@ func (j JSON) Validate(value interface{}, values map[string]interface{}) (interf
 	return jsonValue, nil
 }
 
-type IsValidVaccine struct {
+// Validates appointment properties against the property schema given in
+// the settings. Unknown properties are rejected. Properties of stored
+// appointments (marked by a 'stored' context value) are only checked to be
+// a map, as the schema might have changed since they were published.
+type IsValidAppointmentProperties struct {
 }
 
-func (f IsValidVaccine) Validate(input interface{}, inputs map[string]interface{}) (interface{}, error) {
-	return nil, fmt.Errorf("cannot validate vaccine without context")
+func (f IsValidAppointmentProperties) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+
+func (f IsValidAppointmentProperties) Validate(input interface{}, inputs map[string]interface{}) (interface{}, error) {
+	return nil, fmt.Errorf("cannot validate properties without context")
 }
 
-func (f IsValidVaccine) ValidateWithContext(input interface{}, inputs map[string]interface{}, context map[string]interface{}) (interface{}, error) {
+func (f IsValidAppointmentProperties) ValidateWithContext(input interface{}, inputs map[string]interface{}, context map[string]interface{}) (interface{}, error) {
 	settings, ok := context["settings"].(*services.ValidateSettings)
 	if !ok {
 		return nil, fmt.Errorf("expected a 'settings' context")
 	}
-	vaccines := settings.Vaccines
 
-	found := false
-	for _, v := range vaccines {
-		if input == v {
-			found = true
-			break
+	properties, ok := input.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a map")
+	}
+
+	if stored, _ := context["stored"].(bool); stored {
+		return properties, nil
+	}
+
+	schemas := settings.PropertySchemas()
+	validatedProperties := make(map[string]interface{})
+
+	for _, schema := range schemas {
+		value, found := properties[schema.Name]
+		if !found || value == nil {
+			if schema.Required {
+				return nil, fmt.Errorf("property '%s' is required", schema.Name)
+			}
+			continue
+		}
+		for _, validator := range propertyValidators(schema) {
+			var err error
+			if value, err = validator.Validate(value, properties); err != nil {
+				return nil, fmt.Errorf("%s: %v", schema.Name, err)
+			}
 		}
+		validatedProperties[schema.Name] = value
 	}
 
-	if !found {
-		return nil, fmt.Errorf(
-			"unknown vaccines, must be one of: %s", strings.Join(vaccines, ", "))
+	for name, value := range properties {
+		if _, ok := validatedProperties[name]; !ok && value != nil {
+			return nil, fmt.Errorf("unknown property '%s'", name)
+		}
 	}
 
-	return input, nil
+	return validatedProperties, nil
+}
+
+func propertyValidators(schema *services.PropertySchema) []forms.Validator {
+	switch schema.Type {
+	case "enum":
+		choices := make([]interface{}, len(schema.Values))
+		for i, value := range schema.Values {
+			choices[i] = value
+		}
+		return []forms.Validator{
+			forms.IsString{},
+			forms.IsIn{Choices: choices},
+		}
+	case "boolean":
+		return []forms.Validator{
+			forms.IsBoolean{},
+		}
+	case "integer":
+		validator := forms.IsInteger{}
+		// bounds only apply if the schema defines them
+		if schema.Min != nil {
+			validator.HasMin = true
+			validator.Min = *schema.Min
+		}
+		if schema.Max != nil {
+			validator.HasMax = true
+			validator.Max = *schema.Max
+		}
+		return []forms.Validator{validator}
+	}
+	return nil
+}
+
+// Validates a filter on appointment properties against the property schema.
+// As GET requests can only pass strings, the filter can also be given as a
+// JSON-encoded map.
+type IsValidPropertyFilter struct {
+}
+
+func (f IsValidPropertyFilter) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+
+func (f IsValidPropertyFilter) Validate(input interface{}, inputs map[string]interface{}) (interface{}, error) {
+	return nil, fmt.Errorf("cannot validate properties without context")
+}
+
+func (f IsValidPropertyFilter) ValidateWithContext(input interface{}, inputs map[string]interface{}, context map[string]interface{}) (interface{}, error) {
+	settings, ok := context["settings"].(*services.ValidateSettings)
+	if !ok {
+		return nil, fmt.Errorf("expected a 'settings' context")
+	}
+
+	if str, ok := input.(string); ok {
+		if err := json.Unmarshal([]byte(str), &input); err != nil {
+			return nil, err
+		}
+	}
+
+	properties, ok := input.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a map")
+	}
+
+	schemas := make(map[string]*services.PropertySchema)
+	for _, schema := range settings.PropertySchemas() {
+		schemas[schema.Name] = schema
+	}
+
+	validatedProperties := make(map[string]interface{})
+
+	for name, value := range properties {
+		schema, ok := schemas[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown property '%s'", name)
+		}
+		for _, validator := range propertyValidators(schema) {
+			var err error
+			if value, err = validator.Validate(value, properties); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+		}
+		validatedProperties[name] = value
+	}
+
+	return validatedProperties, nil
+}
+
+// Accepts booleans as well as "true" and "false" strings, as GET requests
+// can only pass strings.
+type IsQueryBoolean struct {
+}
+
+func (f IsQueryBoolean) Validate(input interface{}, inputs map[string]interface{}) (interface{}, error) {
+	switch value := input.(type) {
+	case bool:
+		return value, nil
+	case string:
+		if value == "true" {
+			return true, nil
+		} else if value == "false" {
+			return false, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a boolean")
 }
 
+func (f IsQueryBoolean) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{"type": "boolean"}
+}
 
 type IsValidProviderTimeWindow struct {
 }
@@ -185,6 +321,34 @@ func (f IsValidAnonAggregatedTimeWindow) ValidateWithContext(input interface{},
 	return input, nil
 }
 
+type IsValidWaitlistTimeWindow struct {
+}
+
+func (f IsValidWaitlistTimeWindow) Validate(input interface{}, inputs map[string]interface{}) (interface{}, error) {
+	return nil, fmt.Errorf("cannot validate time window without context")
+}
+
+func (f IsValidWaitlistTimeWindow) ValidateWithContext(input interface{}, inputs map[string]interface{}, context map[string]interface{}) (interface{}, error) {
+	settings, ok := context["settings"].(*services.ValidateSettings)
+	if !ok {
+		return nil, fmt.Errorf("expected a 'settings' context")
+	}
+
+	timeWindow := settings.WaitlistMaxTimeWindow
+
+	from := inputs["from"].(time.Time)
+	to := inputs["to"].(time.Time)
+
+	if from.After(to) {
+		return nil, fmt.Errorf("'from' value is after 'to' value")
+	}
+	if from.AddDate(0, 0, int(timeWindow)).Before(to) {
+		return nil, fmt.Errorf("date span exceeds %d days", timeWindow)
+	}
+
+	return input, nil
+}
+
 var PublicKeyValidators = []forms.Validator{
 	forms.IsBytes{
 		Encoding:  "base64",
@@ -235,6 +399,31 @@ var ProviderIDField = forms.Field{
 	},
 }
 
+var CursorField = forms.Field{
+	Name:        "cursor",
+	Global:      true,
+	Description: "A cursor returned with a previous page of results.",
+	Validators: []forms.Validator{
+		forms.IsOptional{},
+		forms.IsString{MaxLength: 1000},
+	},
+}
+
+var LimitField = forms.Field{
+	Name:        "limit",
+	Global:      true,
+	Description: "Number of results to return at most. If a limit or cursor is given, the results are returned as a page along with the cursor for the next page.",
+	Validators: []forms.Validator{
+		forms.IsOptional{},
+		forms.IsInteger{
+			HasMin: true,
+			HasMax: true,
+			Min:    1,
+			Max:    10000,
+		},
+	},
+}
+
 var TimestampField = forms.Field{
 	Name:        "timestamp",
 	Global:      true,
@@ -481,6 +670,140 @@ var MediatorKeyDataForm = forms.Form{
 	},
 }
 
+var RevokeMediatorPublicKeyForm = forms.Form{
+	Name:   "revokeMediatorPublicKey",
+	Fields: SignedDataFields(&RevokeMediatorPublicKeyDataForm),
+}
+
+var RevokeMediatorPublicKeyDataForm = forms.Form{
+	Name: "revokeMediatorPublicKeyData",
+	Fields: []forms.Field{
+		{
+			Name:        "signing",
+			Description: "Public signing key of the mediator to revoke.",
+			Validators:  PublicKeyValidators,
+		},
+		TimestampField,
+	},
+}
+
+var GetAuditLogForm = forms.Form{
+	Name:   "getAuditLog",
+	Fields: SignedDataFields(&GetAuditLogDataForm),
+}
+
+var GetAuditLogDataForm = forms.Form{
+	Name: "getAuditLogData",
+	Fields: []forms.Field{
+		TimestampField,
+		{
+			Name:        "from",
+			Description: "Number of the first entry to return.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 1},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+		{
+			Name:        "limit",
+			Description: "Number of entries to return at most.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 1000},
+				forms.IsInteger{
+					HasMin: true,
+					HasMax: true,
+					Min:    1,
+					Max:    10000,
+				},
+			},
+		},
+	},
+}
+
+var AuditEntryForm = forms.Form{
+	Name: "auditEntry",
+	Fields: []forms.Field{
+		{
+			Name:        "n",
+			Description: "Number of the entry in the log.",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+		{
+			Name:        "endpoint",
+			Description: "The endpoint that has been called.",
+			Validators: []forms.Validator{
+				forms.IsString{},
+			},
+		},
+		{
+			Name:        "publicKey",
+			Description: "Public signing key of the actor that called the endpoint.",
+			Validators:  PublicKeyValidators,
+		},
+		{
+			Name:        "timestamp",
+			Description: "Timestamp of the signed request.",
+			Validators: []forms.Validator{
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name:        "data",
+			Description: "The signed request data.",
+			Validators: []forms.Validator{
+				forms.IsString{},
+			},
+		},
+		{
+			Name:        "signature",
+			Description: "Signature of the request.",
+			Validators:  PublicKeyValidators,
+		},
+		{
+			Name:        "ids",
+			Description: "IDs of the affected providers or mediators.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsList{
+					Validators: []forms.Validator{
+						ID,
+					},
+				},
+			},
+		},
+		{
+			Name:        "createdAt",
+			Description: "The time the entry has been recorded.",
+			Validators: []forms.Validator{
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name:        "prevHash",
+			Description: "Hash of the previous entry (empty for the first one).",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsBytes{Encoding: "base64"},
+			},
+		},
+		{
+			Name:        "hash",
+			Description: "Hash of this entry, covering all other fields.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+	},
+}
+
 // admin endpoints
 
 var AddCodesForm = forms.Form{
@@ -670,9 +993,67 @@ var TokenDataForm = forms.Form{
 	},
 }
 
+// Optional filters and sorting options for appointment searches.
+var AppointmentFilterFields = []forms.Field{
+	{
+		Name:        "properties",
+		Description: "Only return appointments with the given property values (either a map or a JSON-encoded map).",
+		Validators: []forms.Validator{
+			forms.IsOptional{},
+			IsValidPropertyFilter{},
+		},
+	},
+	{
+		Name:        "accessible",
+		Description: "Only return appointments of accessible providers.",
+		Validators: []forms.Validator{
+			forms.IsOptional{Default: false},
+			IsQueryBoolean{},
+		},
+	},
+	{
+		Name:        "timeFrom",
+		Description: "The earliest time of day (HH:MM) of appointments to return.",
+		Validators: []forms.Validator{
+			forms.IsOptional{},
+			forms.MatchesRegex{Regexp: regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)},
+		},
+	},
+	{
+		Name:        "timeTo",
+		Description: "The latest time of day (HH:MM) of appointments to return.",
+		Validators: []forms.Validator{
+			forms.IsOptional{},
+			forms.MatchesRegex{Regexp: regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)},
+		},
+	},
+	{
+		Name:        "minSlots",
+		Description: "The minimum number of free slots of appointments to return.",
+		Validators: []forms.Validator{
+			forms.IsOptional{Default: 1},
+			forms.IsInteger{
+				HasMin:  true,
+				HasMax:  true,
+				Min:     1,
+				Max:     100,
+				Convert: true,
+			},
+		},
+	},
+	{
+		Name:        "sortBy",
+		Description: "Order of the returned providers, either by 'distance' or by their 'earliest' appointment.",
+		Validators: []forms.Validator{
+			forms.IsOptional{Default: "distance"},
+			forms.IsIn{Choices: []interface{}{"distance", "earliest"}},
+		},
+	},
+}
+
 var GetAppointmentsAggregatedForm = forms.Form{
 	Name: "getAppointmentsByZipCode",
-	Fields: []forms.Field{
+	Fields: append([]forms.Field{
 		{
 			Name:        "radius",
 			Description: "The radius around the given zip code for which to show appointments.",
@@ -712,12 +1093,14 @@ var GetAppointmentsAggregatedForm = forms.Form{
 				IsValidAnonAggregatedTimeWindow{}, // needs to come after from and to
 			},
 		},
-	},
+		LimitField,
+		CursorField,
+	}, AppointmentFilterFields...),
 }
 
 var GetAppointmentsByZipCodeForm = forms.Form{
 	Name: "getAppointmentsByZipCode",
-	Fields: []forms.Field{
+	Fields: append([]forms.Field{
 		{
 			Name:        "radius",
 			Description: "The radius around the given zip code for which to show appointments.",
@@ -757,7 +1140,9 @@ var GetAppointmentsByZipCodeForm = forms.Form{
 				IsValidAnonTimeWindow{}, // needs to come after from and to
 			},
 		},
-	},
+		LimitField,
+		CursorField,
+	}, AppointmentFilterFields...),
 }
 
 var GetProvidersByZipCodeForm = forms.Form{
@@ -783,6 +1168,8 @@ var GetProvidersByZipCodeForm = forms.Form{
 				},
 			},
 		},
+		LimitField,
+		CursorField,
 	},
 }
 
@@ -846,68 +1233,169 @@ var PublishAppointmentsDataForm = forms.Form{
 	},
 }
 
-var AppointmentPropertiesForm = forms.Form{
-	Name: "appointmentProperties",
+var PublishAppointmentSeriesForm = forms.Form{
+	Name:   "publishAppointmentSeries",
+	Fields: SignedDataFields(&PublishAppointmentSeriesDataForm),
+}
+
+var PublishAppointmentSeriesDataForm = forms.Form{
+	Name: "publishAppointmentSeriesData",
 	Fields: []forms.Field{
+		TimestampField,
 		{
-			Name:        "vaccine",
-			Description: "The vaccine type used.",
+			Name:        "series",
+			Description: "The appointment series to publish.",
 			Validators: []forms.Validator{
-				forms.IsString{},
-				IsValidVaccine{},
+				forms.IsStringMap{
+					Form: &AppointmentSeriesForm,
+				},
 			},
 		},
 	},
 }
 
-var BookingForm = forms.Form{
-	Name: "booking",
+var AppointmentSeriesForm = forms.Form{
+	Name: "appointmentSeries",
 	Fields: []forms.Field{
 		IDField,
-		PublicKeyField,
 		{
-			Name:        "token",
-			Description: "The token used for this booking.",
+			Name:        "interval",
+			Description: "How often the appointment recurs.",
 			Validators: []forms.Validator{
-				ID,
+				forms.IsString{},
+				forms.IsIn{Choices: []interface{}{"daily", "weekly"}},
 			},
 		},
 		{
-			Name:        "encryptedData",
-			Description: "Encrypted data for the provider.",
+			Name:        "start",
+			Description: "Time of the first appointment of the series.",
 			Validators: []forms.Validator{
-				forms.IsStringMap{
-					Form: &ECDHEncryptedDataForm,
-				},
+				forms.IsTime{Format: "rfc3339"},
 			},
 		},
-	},
-}
-
-var SignedAppointmentForm = forms.Form{
-	Name: "signedAppointment",
-	Fields: append(SignedDataFields(&AppointmentDataForm), []forms.Field{
 		{
-			Name:        "updatedAt",
-			Description: "Time the appointment has last been updated.",
+			Name:        "end",
+			Description: "No appointments of the series take place after this time.",
 			Validators: []forms.Validator{
-				forms.IsOptional{}, // only for reading, not for submitting
-				forms.IsTime{
-					Format: "rfc3339",
-				},
+				forms.IsTime{Format: "rfc3339"},
 			},
 		},
 		{
-			Name:        "bookedSlots",
-			Description: "Booked slots associated with the appointment (visible to users).",
+			Name:        "duration",
+			Description: "Duration of the appointments.",
 			Validators: []forms.Validator{
-				forms.IsOptional{}, // only for reading, not for submitting
-				forms.IsList{
-					Validators: []forms.Validator{
-						forms.IsStringMap{
-							Form: &SlotForm,
-						},
-					},
+				forms.IsInteger{
+					HasMin: true,
+					HasMax: true,
+					Min:    5,
+					Max:    300,
+				},
+			},
+		},
+		{
+			Name:        "slots",
+			Description: "Number of slots per appointment.",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					HasMax: true,
+					Min:    1,
+					Max:    50,
+				},
+			},
+		},
+		{
+			Name:        "properties",
+			Description: "Properties of the appointments.",
+			Validators: []forms.Validator{
+				IsValidAppointmentProperties{},
+			},
+		},
+		PublicKeyField,
+		{
+			Name:        "expandedUntil",
+			Description: "Time up to which the series has been expanded into appointments.",
+			Validators: []forms.Validator{
+				forms.IsOptional{}, // only for reading, not for submitting
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+	},
+}
+
+var GetAppointmentSeriesForm = forms.Form{
+	Name:   "getAppointmentSeries",
+	Fields: SignedDataFields(&GetAppointmentSeriesDataForm),
+}
+
+var GetAppointmentSeriesDataForm = forms.Form{
+	Name: "getAppointmentSeriesData",
+	Fields: []forms.Field{
+		TimestampField,
+	},
+}
+
+var DeleteAppointmentSeriesForm = forms.Form{
+	Name:   "deleteAppointmentSeries",
+	Fields: SignedDataFields(&DeleteAppointmentSeriesDataForm),
+}
+
+var DeleteAppointmentSeriesDataForm = forms.Form{
+	Name: "deleteAppointmentSeriesData",
+	Fields: []forms.Field{
+		TimestampField,
+		IDField,
+	},
+}
+
+var BookingForm = forms.Form{
+	Name: "booking",
+	Fields: []forms.Field{
+		IDField,
+		PublicKeyField,
+		{
+			Name:        "token",
+			Description: "The token used for this booking.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "encryptedData",
+			Description: "Encrypted data for the provider.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &ECDHEncryptedDataForm,
+				},
+			},
+		},
+	},
+}
+
+var SignedAppointmentForm = forms.Form{
+	Name: "signedAppointment",
+	Fields: append(SignedDataFields(&AppointmentDataForm), []forms.Field{
+		{
+			Name:        "updatedAt",
+			Description: "Time the appointment has last been updated.",
+			Validators: []forms.Validator{
+				forms.IsOptional{}, // only for reading, not for submitting
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+		{
+			Name:        "bookedSlots",
+			Description: "Booked slots associated with the appointment (visible to users).",
+			Validators: []forms.Validator{
+				forms.IsOptional{}, // only for reading, not for submitting
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &SlotForm,
+						},
+					},
 				},
 			},
 		},
@@ -948,13 +1436,19 @@ var AppointmentDataForm = forms.Form{
 			Name:        "properties",
 			Description: "Properties of the appointment.",
 			Validators: []forms.Validator{
-				forms.IsStringMap{
-					Form: &AppointmentPropertiesForm,
-				},
+				IsValidAppointmentProperties{},
 			},
 		},
 		PublicKeyField,
 		IDField,
+		{
+			Name:        "seriesID",
+			Description: "ID of the series the appointment has been generated from.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				ID,
+			},
+		},
 		{
 			Name:        "slotData",
 			Description: "Appointment slots.",
@@ -982,6 +1476,53 @@ var GetBookedAppointmentsDataForm = forms.Form{
 	Name: "getBookedAppointmentsData",
 	Fields: []forms.Field{
 		TimestampField,
+		{
+			Name:        "signedTokenData",
+			Description: "Signed token data of the user.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &SignedTokenDataForm,
+				},
+			},
+		},
+	},
+}
+
+var BookedAppointmentForm = forms.Form{
+	Name: "bookedAppointment",
+	Fields: []forms.Field{
+		ProviderIDField,
+		{
+			Name:        "appointmentID",
+			Description: "The ID of the booked appointment.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "slotID",
+			Description: "The ID of the booked slot.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "timestamp",
+			Description: "The time of the booked appointment.",
+			Validators: []forms.Validator{
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name:        "appointment",
+			Description: "The signed appointment, which allows the user to verify the booking.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &SignedAppointmentForm,
+				},
+			},
+		},
 	},
 }
 var GetBookedAppointmentsForm = forms.Form{
@@ -1021,6 +1562,52 @@ var BookAppointmentDataForm = forms.Form{
 	},
 }
 
+var RescheduleAppointmentForm = forms.Form{
+	Name:   "rescheduleAppointment",
+	Fields: SignedDataFields(&RescheduleAppointmentDataForm),
+}
+
+var RescheduleAppointmentDataForm = forms.Form{
+	Name: "rescheduleAppointmentData",
+	Fields: []forms.Field{
+		ProviderIDField,
+		IDField,
+		TimestampField,
+		{
+			Name:        "newProviderID",
+			Description: "The ID of the provider of the new appointment.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "newID",
+			Description: "The ID of the new appointment.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "signedTokenData",
+			Description: "Signed token data of the user.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &SignedTokenDataForm,
+				},
+			},
+		},
+		{
+			Name:        "encryptedData",
+			Description: "Encrypted data for the provider of the new appointment.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &ECDHEncryptedDataForm,
+				},
+			},
+		},
+	},
+}
+
 var GetAppointmentForm = forms.Form{
 	Name: "getAppointment",
 	Fields: []forms.Field{
@@ -1052,6 +1639,239 @@ var CancelAppointmentDataForm = forms.Form{
 	},
 }
 
+var CancelBookingForm = forms.Form{
+	Name:   "cancelBooking",
+	Fields: SignedDataFields(&CancelBookingDataForm),
+}
+
+var CancelBookingDataForm = forms.Form{
+	Name: "cancelBookingData",
+	Fields: []forms.Field{
+		IDField,
+		TimestampField,
+		{
+			Name:        "bookingID",
+			Description: "The ID of the booked slot.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "encryptedReason",
+			Description: "The reason for the cancellation, encrypted for the user.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &ECDHEncryptedDataForm,
+				},
+			},
+		},
+	},
+}
+
+var GetBookingCancellationsForm = forms.Form{
+	Name:   "getBookingCancellations",
+	Fields: SignedDataFields(&GetBookingCancellationsDataForm),
+}
+
+var GetBookingCancellationsDataForm = forms.Form{
+	Name: "getBookingCancellationsData",
+	Fields: []forms.Field{
+		TimestampField,
+		{
+			Name:        "signedTokenData",
+			Description: "Signed token data of the user.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &SignedTokenDataForm,
+				},
+			},
+		},
+	},
+}
+
+var BookingCancellationForm = forms.Form{
+	Name: "bookingCancellation",
+	Fields: []forms.Field{
+		ProviderIDField,
+		{
+			Name:        "appointmentID",
+			Description: "The ID of the appointment.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "bookingID",
+			Description: "The ID of the booked slot.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "timestamp",
+			Description: "The time of the cancelled appointment.",
+			Validators: []forms.Validator{
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name:        "cancelledAt",
+			Description: "The time the booking has been cancelled.",
+			Validators: []forms.Validator{
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name:        "encryptedReason",
+			Description: "The reason for the cancellation, encrypted for the user.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &ECDHEncryptedDataForm,
+				},
+			},
+		},
+	},
+}
+
+var JoinWaitlistForm = forms.Form{
+	Name:   "joinWaitlist",
+	Fields: SignedDataFields(&JoinWaitlistDataForm),
+}
+
+var JoinWaitlistDataForm = forms.Form{
+	Name: "joinWaitlistData",
+	Fields: []forms.Field{
+		ProviderIDField,
+		TimestampField,
+		{
+			Name:        "from",
+			Description: "The earliest time of an appointment the user wants to be booked into.",
+			Validators: []forms.Validator{
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name:        "to",
+			Description: "The latest time of an appointment the user wants to be booked into.",
+			Validators: []forms.Validator{
+				forms.IsTime{Format: "rfc3339"},
+				IsValidWaitlistTimeWindow{}, // needs to come after from and to
+			},
+		},
+		{
+			Name:        "signedTokenData",
+			Description: "Signed token data of the user.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &SignedTokenDataForm,
+				},
+			},
+		},
+		{
+			Name:        "encryptedData",
+			Description: "Encrypted data for the provider, which will be used for the booking.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &ECDHEncryptedDataForm,
+				},
+			},
+		},
+	},
+}
+
+var GetWaitlistForm = forms.Form{
+	Name:   "getWaitlist",
+	Fields: SignedDataFields(&WaitlistDataForm),
+}
+
+var LeaveWaitlistForm = forms.Form{
+	Name:   "leaveWaitlist",
+	Fields: SignedDataFields(&WaitlistDataForm),
+}
+
+var WaitlistDataForm = forms.Form{
+	Name: "waitlistData",
+	Fields: []forms.Field{
+		ProviderIDField,
+		TimestampField,
+		{
+			Name:        "signedTokenData",
+			Description: "Signed token data of the user.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &SignedTokenDataForm,
+				},
+			},
+		},
+	},
+}
+
+var WaitlistEntryForm = forms.Form{
+	Name: "waitlistEntry",
+	Fields: []forms.Field{
+		PublicKeyField,
+		{
+			Name:        "token",
+			Description: "The token of the waiting user.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "n",
+			Description: "The priority of the token.",
+			Validators: []forms.Validator{
+				forms.IsInteger{HasMin: true, Min: 0},
+			},
+		},
+		{
+			Name:        "from",
+			Description: "The earliest time of an appointment the user wants to be booked into.",
+			Validators: []forms.Validator{
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name:        "to",
+			Description: "The latest time of an appointment the user wants to be booked into.",
+			Validators: []forms.Validator{
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name:        "createdAt",
+			Description: "The time the user joined the waitlist.",
+			Validators: []forms.Validator{
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name:        "encryptedData",
+			Description: "Encrypted data for the provider.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &ECDHEncryptedDataForm,
+				},
+			},
+		},
+		{
+			Name:        "appointmentID",
+			Description: "The ID of the appointment the user has been booked into.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				ID,
+			},
+		},
+		{
+			Name:        "position",
+			Description: "The position in the waitlist, or 0 if a slot has been assigned.",
+			Validators: []forms.Validator{
+				forms.IsInteger{HasMin: true, Min: 0},
+			},
+		},
+	},
+}
+
 var CheckProviderDataForm = forms.Form{
 	Name:   "checkProviderData",
 	Fields: SignedDataFields(&CheckProviderDataDataForm),
@@ -1113,9 +1933,9 @@ var GetPendingProviderDataDataForm = forms.Form{
 		TimestampField,
 		{
 			Name:        "limit",
-			Description: "Number of entries to return at most.",
+			Description: "Number of entries to return at most. If a limit or cursor is given, the entries are returned as a page along with the cursor for the next page.",
 			Validators: []forms.Validator{
-				forms.IsOptional{Default: 1000},
+				forms.IsOptional{},
 				forms.IsInteger{
 					HasMin: true,
 					HasMax: true,
@@ -1124,6 +1944,7 @@ var GetPendingProviderDataDataForm = forms.Form{
 				},
 			},
 		},
+		CursorField,
 	},
 }
 
@@ -1138,9 +1959,9 @@ var GetVerifiedProviderDataDataForm = forms.Form{
 		TimestampField,
 		{
 			Name:        "limit",
-			Description: "Number of entries to return at most.",
+			Description: "Number of entries to return at most. If a limit or cursor is given, the entries are returned as a page along with the cursor for the next page.",
 			Validators: []forms.Validator{
-				forms.IsOptional{Default: 1000},
+				forms.IsOptional{},
 				forms.IsInteger{
 					HasMin: true,
 					HasMax: true,
@@ -1149,6 +1970,30 @@ var GetVerifiedProviderDataDataForm = forms.Form{
 				},
 			},
 		},
+		CursorField,
+	},
+}
+
+var SuspendProviderForm = forms.Form{
+	Name:   "suspendProvider",
+	Fields: SignedDataFields(&ManageProviderDataForm),
+}
+
+var ReactivateProviderForm = forms.Form{
+	Name:   "reactivateProvider",
+	Fields: SignedDataFields(&ManageProviderDataForm),
+}
+
+var DeleteProviderForm = forms.Form{
+	Name:   "deleteProvider",
+	Fields: SignedDataFields(&ManageProviderDataForm),
+}
+
+var ManageProviderDataForm = forms.Form{
+	Name: "manageProviderData",
+	Fields: []forms.Field{
+		TimestampField,
+		ProviderIDField,
 	},
 }
 
@@ -69,6 +69,30 @@ var JSONRPCServerSettingsForm = forms.Form{
 				},
 			},
 		},
+		{
+			Name: "max_batch_size",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 50},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    1000,
+				},
+			},
+		},
+		// the maximum size of a request body in bytes (0 means no limit). For
+		// the storage server it is derived from the storage limits if unset.
+		{
+			Name: "max_body_size",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 0},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    0,
+				},
+			},
+		},
 	},
 }
 
@@ -34,5 +34,17 @@ var RESTServerSettingsForm = forms.Form{
 				},
 			},
 		},
+		// the maximum size of a request body in bytes (0 means no limit). For
+		// the storage server it is derived from the storage limits if unset.
+		{
+			Name: "max_body_size",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 0},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    0,
+				},
+			},
+		},
 	},
 }
@@ -40,6 +40,52 @@ var BookAppointmentRVV = []forms.Validator{
 	},
 }
 
+var GetBookedAppointmentsRVV = []forms.Validator{
+	forms.IsList{
+		Validators: []forms.Validator{
+			forms.IsStringMap{
+				Form: &BookedAppointmentForm,
+			},
+		},
+	},
+}
+
+var GetBookingCancellationsRVV = []forms.Validator{
+	forms.IsList{
+		Validators: []forms.Validator{
+			forms.IsStringMap{
+				Form: &BookingCancellationForm,
+			},
+		},
+	},
+}
+
+var GetAuditLogRVV = []forms.Validator{
+	forms.IsList{
+		Validators: []forms.Validator{
+			forms.IsStringMap{
+				Form: &AuditEntryForm,
+			},
+		},
+	},
+}
+
+var WaitlistEntryRVV = []forms.Validator{
+	forms.IsStringMap{
+		Form: &WaitlistEntryForm,
+	},
+}
+
+var GetAppointmentSeriesRVV = []forms.Validator{
+	forms.IsList{
+		Validators: []forms.Validator{
+			forms.IsStringMap{
+				Form: &AppointmentSeriesForm,
+			},
+		},
+	},
+}
+
 var GetProviderAppointmentsRVV = []forms.Validator{
 	forms.IsStringMap{
 		Form: &ProviderAppointmentsForm,
@@ -52,7 +98,7 @@ var CheckProviderDataRVV = []forms.Validator{
 	},
 }
 
-var GetProviderDataRVV = []forms.Validator{
+var GetProviderDataRVV = PageRVV(
 	forms.IsList{
 		Validators: []forms.Validator{
 			forms.IsStringMap{
@@ -60,7 +106,7 @@ var GetProviderDataRVV = []forms.Validator{
 			},
 		},
 	},
-}
+)
 
 var StatsValueForm = forms.Form{
 	Name: "statsValue",
@@ -108,6 +154,76 @@ var StatsValueForm = forms.Form{
 	},
 }
 
+// Accepts either a bare result list (returned if the client did not ask for
+// paging) or a page of results, which includes the cursor for the next page.
+func PageRVV(validators ...forms.Validator) []forms.Validator {
+	return []forms.Validator{
+		forms.Or{
+			Options: [][]forms.Validator{
+				validators,
+				{
+					forms.IsStringMap{
+						Form: &forms.Form{
+							Name: "page",
+							Fields: []forms.Field{
+								{
+									Name:        "results",
+									Description: "The results on this page.",
+									Validators:  validators,
+								},
+								{
+									Name:        "cursor",
+									Description: "Cursor for the next page (only if there are more results).",
+									Validators: []forms.Validator{
+										forms.IsOptional{},
+										forms.IsString{},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+var GetSettingsRVV = []forms.Validator{
+	forms.IsStringMap{
+		Form: &SettingsRecordForm,
+	},
+}
+
+var StoreSettingsRVV = []forms.Validator{
+	forms.IsStringMap{
+		Form: &SettingsVersionForm,
+	},
+}
+
+var PairingCodeRVV = []forms.Validator{
+	forms.IsStringMap{
+		Form: &PairingCodeForm,
+	},
+}
+
+var PairingSessionRVV = []forms.Validator{
+	forms.IsStringMap{
+		Form: &PairingSessionForm,
+	},
+}
+
+var BlobManifestRVV = []forms.Validator{
+	forms.IsStringMap{
+		Form: &BlobManifestForm,
+	},
+}
+
+var BlobChunkRVV = []forms.Validator{
+	forms.IsStringMap{
+		Form: &BlobChunkForm,
+	},
+}
+
 var IsAcknowledgeRVV = []forms.Validator{
 	forms.IsIn{Choices: []interface{}{"ok"}},
 }
@@ -140,6 +256,85 @@ var KeysForm = forms.Form{
 			Description: "Public token key.",
 			Validators:  PublicKeyValidators,
 		},
+		{
+			Name:        "appointmentKey",
+			Description: "Public key used to sign appointments generated from series.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsBytes{
+					Encoding:  "base64",
+					MaxLength: 128,
+					MinLength: 64,
+				},
+			},
+		},
+		{
+			Name:        "versions",
+			Description: "All versions of the provider data, root, token and appointment keys.",
+			Validators: []forms.Validator{
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &KeyVersionForm,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "revokedMediators",
+			Description: "Mediator keys that have been revoked.",
+			Validators: []forms.Validator{
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &ActorKeyForm,
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+var KeyVersionForm = forms.Form{
+	Name: "keyVersion",
+	Fields: []forms.Field{
+		{
+			Name:        "name",
+			Description: "Name of the key.",
+			Validators: []forms.Validator{
+				forms.IsString{},
+			},
+		},
+		{
+			Name:        "publicKey",
+			Description: "The public key.",
+			Validators:  PublicKeyValidators,
+		},
+		{
+			Name:        "validFrom",
+			Description: "Start of the validity period of the key.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name:        "validUntil",
+			Description: "End of the validity period of the key.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name:        "status",
+			Description: "Status of the key: 'current' keys are used for signing, 'valid' keys are still accepted, 'pending' keys will become valid in the future and 'retired' keys are no longer accepted.",
+			Validators: []forms.Validator{
+				forms.IsIn{Choices: []interface{}{"current", "valid", "pending", "retired"}},
+			},
+		},
 	},
 }
 
@@ -155,7 +350,7 @@ var GetConfigurablesRVV = []forms.Validator{
 	},
 }
 
-var GetAppointmentsAggregatedRVV = []forms.Validator{
+var GetAppointmentsAggregatedRVV = PageRVV(
 	forms.IsList{
 		Validators: []forms.Validator{
 			forms.IsStringMap{
@@ -163,9 +358,9 @@ var GetAppointmentsAggregatedRVV = []forms.Validator{
 			},
 		},
 	},
-}
+)
 
-var GetAppointmentsByZipCodeRVV = []forms.Validator{
+var GetAppointmentsByZipCodeRVV = PageRVV(
 	forms.IsList{
 		Validators: []forms.Validator{
 			forms.IsStringMap{
@@ -173,9 +368,9 @@ var GetAppointmentsByZipCodeRVV = []forms.Validator{
 			},
 		},
 	},
-}
+)
 
-var GetProvidersByZipCodeRVV = []forms.Validator{
+var GetProvidersByZipCodeRVV = PageRVV(
 	forms.IsList{
 		Validators: []forms.Validator{
 			forms.IsStringMap{
@@ -183,7 +378,7 @@ var GetProvidersByZipCodeRVV = []forms.Validator{
 			},
 		},
 	},
-}
+)
 
 var ActorKeyForm = forms.Form{
 	Name:   "actorKey",
@@ -239,6 +239,146 @@ var StorageForm = forms.Form{
 				},
 			},
 		},
+		// whether reading settings resets their TTL
+		{
+			Name: "sliding_settings_ttl",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: false},
+				forms.IsBoolean{},
+			},
+		},
+		// the maximum size of the data of a settings record in bytes
+		{
+			Name: "max_data_size",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 65536},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    10485760,
+				},
+			},
+		},
+		// how many settings records a single key may own
+		{
+			Name: "max_records_per_key",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 10},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    10000,
+				},
+			},
+		},
+		// how many writes a single key may make per quota window
+		{
+			Name: "key_write_quota",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 100},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+		// how many writes a single IP address may make per quota window
+		{
+			Name: "ip_write_quota",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 1000},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+		// how many settings records without an owner a single IP address may
+		// claim per quota window
+		{
+			Name: "claim_quota",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 10},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+		// the time window in which writes are counted against the quotas
+		{
+			Name: "quota_window_minutes",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 60},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    1440,
+				},
+			},
+		},
+		// how long pairing sessions stay open
+		{
+			Name: "pairing_ttl_minutes",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 5},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    60,
+				},
+			},
+		},
+		// how many invalid pairing codes an IP address may try per quota window
+		{
+			Name: "max_pairing_attempts",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 10},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+		// the size of the chunks that blobs are uploaded in
+		{
+			Name: "blob_chunk_size",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 262144},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1024,
+					HasMax: true,
+					Max:    4194304,
+				},
+			},
+		},
+		// the maximum size of a blob in bytes
+		{
+			Name: "max_blob_size",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 67108864},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+		// how many bytes of blobs a single key may own
+		{
+			Name: "max_blob_bytes_per_key",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 268435456},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
 	},
 }
 
@@ -303,6 +443,20 @@ var KeyForm = forms.Form{
 				},
 			},
 		},
+		{
+			Name: "validFrom",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name: "validUntil",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
 		{
 			Name: "params",
 			Validators: []forms.Validator{
@@ -327,6 +481,7 @@ var ValidateForm = forms.Form{
 		{
 			Name: "vaccines",
 			Validators: []forms.Validator{
+				forms.IsOptional{},
 				forms.IsStringList{},
 			},
 		},
@@ -357,6 +512,77 @@ var ValidateForm = forms.Form{
 				},
 			},
 		},
+		{
+			Name: "waitlist_max_time_window",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 14},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+		{
+			Name: "properties",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &PropertySchemaForm,
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+var PropertySchemaForm = forms.Form{
+	Name: "propertySchema",
+	Fields: []forms.Field{
+		{
+			Name: "name",
+			Validators: []forms.Validator{
+				forms.IsString{},
+			},
+		},
+		{
+			Name: "type",
+			Validators: []forms.Validator{
+				forms.IsIn{Choices: []interface{}{"enum", "boolean", "integer"}},
+			},
+		},
+		{
+			Name: "required",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: false},
+				forms.IsBoolean{},
+			},
+		},
+		// the allowed values of "enum" properties
+		{
+			Name: "values",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringList{},
+			},
+		},
+		// the (inclusive) range of "integer" properties, unbounded if not given
+		{
+			Name: "min",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsInteger{},
+			},
+		},
+		{
+			Name: "max",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsInteger{},
+			},
+		},
 	},
 }
 
@@ -383,7 +609,7 @@ var AppointmentsForm = forms.Form{
 				},
 			},
 		},
-		// how long we want to store settings
+		// how long we keep appointments and their bookings after they took place
 		{
 			Name: "data_ttl_days",
 			Validators: []forms.Validator{
@@ -396,6 +622,45 @@ var AppointmentsForm = forms.Form{
 				},
 			},
 		},
+		// how long we keep used tokens, after which they can be used again
+		{
+			Name: "token_ttl_days",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 60},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    365,
+				},
+			},
+		},
+		// how often we remove expired data
+		{
+			Name: "retention_interval_minutes",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 60},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    1440,
+				},
+			},
+		},
+		// how far into the future we expand appointment series
+		{
+			Name: "series_horizon_days",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 28},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    90,
+				},
+			},
+		},
 		{
 			Name: "provider_codes_enabled",
 			Validators: []forms.Validator{
@@ -29,8 +29,14 @@ func (a IsAnything) Validate(value interface{}, values map[string]interface{}) (
 }
 
 var StoreSettingsForm = forms.Form{
-	Name: "storeSettings",
+	Name:   "storeSettings",
+	Fields: SignedDataFields(&StoreSettingsDataForm),
+}
+
+var StoreSettingsDataForm = forms.Form{
+	Name: "storeSettingsData",
 	Fields: []forms.Field{
+		TimestampField,
 		{
 			Name:        "id",
 			Description: "ID under which to store settings.",
@@ -45,6 +51,7 @@ var StoreSettingsForm = forms.Form{
 				IsAnything{},
 			},
 		},
+		SettingsVersionField,
 	},
 }
 
@@ -62,8 +69,14 @@ var GetSettingsForm = forms.Form{
 }
 
 var DeleteSettingsForm = forms.Form{
-	Name: "deleteSettings",
+	Name:   "deleteSettings",
+	Fields: SignedDataFields(&DeleteSettingsDataForm),
+}
+
+var DeleteSettingsDataForm = forms.Form{
+	Name: "deleteSettingsData",
 	Fields: []forms.Field{
+		TimestampField,
 		{
 			Name:        "id",
 			Description: "ID for which to delete settings.",
@@ -71,5 +84,396 @@ var DeleteSettingsForm = forms.Form{
 				ID,
 			},
 		},
+		SettingsVersionField,
+	},
+}
+
+var SettingsVersionField = forms.Field{
+	Name:        "version",
+	Description: "Current version of the settings, which is 0 if no settings have been stored yet. The request fails if the settings have been modified in the meantime.",
+	Validators: []forms.Validator{
+		forms.IsOptional{Default: 0},
+		forms.IsInteger{
+			HasMin: true,
+			Min:    0,
+		},
+	},
+}
+
+var SettingsRecordForm = forms.Form{
+	Name: "settingsRecord",
+	Fields: []forms.Field{
+		{
+			Name:        "data",
+			Description: "The stored settings.",
+			Validators: []forms.Validator{
+				IsAnything{},
+			},
+		},
+		{
+			Name:        "version",
+			Description: "Current version of the settings.",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					Min:    0,
+				},
+			},
+		},
+		SettingsExpiresAtField,
+	},
+}
+
+var SettingsVersionForm = forms.Form{
+	Name: "settingsVersion",
+	Fields: []forms.Field{
+		{
+			Name:        "version",
+			Description: "New version of the settings.",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+		SettingsExpiresAtField,
+	},
+}
+
+var SettingsExpiresAtField = forms.Field{
+	Name:        "expiresAt",
+	Description: "Time at which the settings expire unless they are stored again. If the storage uses a sliding TTL, reading the settings extends it as well.",
+	Validators: []forms.Validator{
+		forms.IsOptional{},
+		forms.IsTime{Format: "rfc3339"},
+	},
+}
+
+var CreatePairingForm = forms.Form{
+	Name:   "createPairing",
+	Fields: SignedDataFields(&CreatePairingDataForm),
+}
+
+var CreatePairingDataForm = forms.Form{
+	Name: "createPairingData",
+	Fields: []forms.Field{
+		TimestampField,
+		{
+			Name:        "publicKey",
+			Description: "ECDH public key of the device that creates the pairing session.",
+			Validators:  PublicKeyValidators,
+		},
+	},
+}
+
+var JoinPairingForm = forms.Form{
+	Name: "joinPairing",
+	Fields: []forms.Field{
+		PairingCodeField,
+		{
+			Name:        "publicKey",
+			Description: "ECDH public key of the device that joins the pairing session.",
+			Validators:  PublicKeyValidators,
+		},
+	},
+}
+
+var GetPairingForm = forms.Form{
+	Name: "getPairing",
+	Fields: []forms.Field{
+		{
+			Name:        "id",
+			Description: "ID of the pairing session.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+	},
+}
+
+var CompletePairingForm = forms.Form{
+	Name:   "completePairing",
+	Fields: SignedDataFields(&CompletePairingDataForm),
+}
+
+var CompletePairingDataForm = forms.Form{
+	Name: "completePairingData",
+	Fields: []forms.Field{
+		TimestampField,
+		{
+			Name:        "id",
+			Description: "ID of the pairing session.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "encryptedData",
+			Description: "Data encrypted for the device that joined the pairing session.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &ECDHEncryptedDataForm,
+				},
+			},
+		},
+	},
+}
+
+var PairingCodeField = forms.Field{
+	Name:        "code",
+	Description: "Human-readable code of the pairing session. Case, dashes and spaces are ignored.",
+	Validators: []forms.Validator{
+		forms.IsString{
+			MinLength: 1,
+			MaxLength: 32,
+		},
+	},
+}
+
+var PairingCodeForm = forms.Form{
+	Name: "pairingCode",
+	Fields: []forms.Field{
+		{
+			Name:        "id",
+			Description: "ID of the pairing session, which should only be shared with the device that joins it.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		PairingCodeField,
+		PairingExpiresAtField,
+	},
+}
+
+var PairingSessionForm = forms.Form{
+	Name: "pairingSession",
+	Fields: []forms.Field{
+		{
+			Name:        "id",
+			Description: "ID of the pairing session.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "publicKey",
+			Description: "ECDH public key of the device that created the pairing session.",
+			Validators:  PublicKeyValidators,
+		},
+		{
+			Name:        "peerPublicKey",
+			Description: "ECDH public key of the device that joined the pairing session, if any.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				PublicKeyValidators[0],
+			},
+		},
+		{
+			Name:        "encryptedData",
+			Description: "Data encrypted for the device that joined the pairing session, if any.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &ECDHEncryptedDataForm,
+				},
+			},
+		},
+		PairingExpiresAtField,
+	},
+}
+
+var PairingExpiresAtField = forms.Field{
+	Name:        "expiresAt",
+	Description: "Time at which the pairing session expires.",
+	Validators: []forms.Validator{
+		forms.IsTime{Format: "rfc3339"},
+	},
+}
+
+var CreateBlobForm = forms.Form{
+	Name:   "createBlob",
+	Fields: SignedDataFields(&CreateBlobDataForm),
+}
+
+var CreateBlobDataForm = forms.Form{
+	Name: "createBlobData",
+	Fields: []forms.Field{
+		TimestampField,
+		BlobIDField,
+		{
+			Name:        "size",
+			Description: "Size of the encrypted blob in bytes.",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+	},
+}
+
+var UploadBlobChunkForm = forms.Form{
+	Name:   "uploadBlobChunk",
+	Fields: SignedDataFields(&UploadBlobChunkDataForm),
+}
+
+var UploadBlobChunkDataForm = forms.Form{
+	Name: "uploadBlobChunkData",
+	Fields: []forms.Field{
+		TimestampField,
+		BlobIDField,
+		BlobChunkIndexField,
+		BlobChunkDataField,
+		BlobChunkHashField,
+	},
+}
+
+var BlobForm = forms.Form{
+	Name:   "blob",
+	Fields: SignedDataFields(&BlobDataForm),
+}
+
+var BlobDataForm = forms.Form{
+	Name: "blobData",
+	Fields: []forms.Field{
+		TimestampField,
+		BlobIDField,
+	},
+}
+
+var GetBlobForm = forms.Form{
+	Name: "getBlob",
+	Fields: []forms.Field{
+		BlobIDField,
+	},
+}
+
+var GetBlobChunkForm = forms.Form{
+	Name: "getBlobChunk",
+	Fields: []forms.Field{
+		BlobIDField,
+		BlobChunkIndexField,
+	},
+}
+
+var BlobIDField = forms.Field{
+	Name:        "id",
+	Description: "ID of the blob.",
+	Validators: []forms.Validator{
+		ID,
+	},
+}
+
+var BlobChunkIndexField = forms.Field{
+	Name:        "index",
+	Description: "Index of the chunk, starting at 0.",
+	Validators: []forms.Validator{
+		forms.IsInteger{
+			HasMin:  true,
+			Min:     0,
+			Convert: true,
+		},
+	},
+}
+
+var BlobChunkDataField = forms.Field{
+	Name:        "data",
+	Description: "The encrypted data of the chunk. All chunks but the last one need to have the chunk size of the blob.",
+	Validators: []forms.Validator{
+		forms.IsBytes{
+			Encoding:  "base64",
+			MinLength: 1,
+			MaxLength: 4194304,
+		},
+	},
+}
+
+var BlobChunkHashField = forms.Field{
+	Name:        "hash",
+	Description: "SHA-256 hash of the encrypted data of the chunk.",
+	Validators: []forms.Validator{
+		forms.IsBytes{
+			Encoding:  "base64",
+			MinLength: 32,
+			MaxLength: 32,
+		},
+	},
+}
+
+var BlobChunkHashForm = forms.Form{
+	Name: "blobChunkHash",
+	Fields: []forms.Field{
+		BlobChunkIndexField,
+		BlobChunkHashField,
+	},
+}
+
+var BlobChunkForm = forms.Form{
+	Name: "blobChunk",
+	Fields: []forms.Field{
+		BlobChunkIndexField,
+		BlobChunkDataField,
+		BlobChunkHashField,
+	},
+}
+
+var BlobManifestForm = forms.Form{
+	Name: "blobManifest",
+	Fields: []forms.Field{
+		BlobIDField,
+		{
+			Name:        "size",
+			Description: "Size of the blob in bytes.",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+		{
+			Name:        "chunkSize",
+			Description: "Size of the chunks of the blob in bytes.",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+		{
+			Name:        "chunks",
+			Description: "Indexes and hashes of the chunks that have been uploaded.",
+			Validators: []forms.Validator{
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &BlobChunkHashForm,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "complete",
+			Description: "Whether the upload has been finalized.",
+			Validators: []forms.Validator{
+				forms.IsBoolean{},
+			},
+		},
+		{
+			Name:        "hash",
+			Description: "SHA-256 hash of the concatenated chunk hashes, once the upload has been finalized.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsBytes{
+					Encoding:  "base64",
+					MinLength: 32,
+					MaxLength: 32,
+				},
+			},
+		},
 	},
 }
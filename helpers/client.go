@@ -20,6 +20,7 @@ package helpers
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"github.com/kiebitz-oss/services"
@@ -146,10 +147,12 @@ func Request(url, method string, params interface{}, key *crypto.Key, client *ht
 
 	}
 
+	// requests without an ID are notifications, which would not get a response
 	jsonrpcRequest := map[string]interface{}{
 		"method":  method,
 		"jsonrpc": "2.0",
 		"params":  params,
+		"id":      1,
 	}
 
 	jsonData, err := json.Marshal(jsonrpcRequest)
@@ -199,6 +202,14 @@ func (a *AppointmentsClient) GetKeys() (*Response, error) {
 	return a.requester("getKeys", nil, nil)
 }
 
+func (a *AppointmentsClient) GetConfigurables() (*Response, error) {
+	return a.requester("getConfigurables", nil, nil)
+}
+
+func (a *AppointmentsClient) GetOpenAPI() (*Response, error) {
+	return a.requester("_openapi", nil, nil)
+}
+
 func (a *AppointmentsClient) ResetDB() (*Response, error) {
 	signingKey := a.settings.Admin.Signing.Key("root")
 
@@ -241,6 +252,37 @@ func (a *AppointmentsClient) AddMediatorPublicKeys(mediator *crypto.Actor) (*Res
 
 }
 
+func (a *AppointmentsClient) RevokeMediatorPublicKey(mediator *crypto.Actor) (*Response, error) {
+	rootKey := a.settings.Admin.Signing.Key("root")
+
+	if rootKey == nil {
+		return nil, fmt.Errorf("root key missing")
+	}
+
+	params := &services.RevokeMediatorPublicKeyParams{
+		Timestamp: time.Now(),
+		Signing:   mediator.SigningKey.PublicKey,
+	}
+
+	return a.requester("revokeMediatorPublicKey", params, rootKey)
+}
+
+func (a *AppointmentsClient) GetAuditLog(from, limit int64) (*Response, error) {
+	rootKey := a.settings.Admin.Signing.Key("root")
+
+	if rootKey == nil {
+		return nil, fmt.Errorf("root key missing")
+	}
+
+	params := &services.GetAuditLogParams{
+		Timestamp: time.Now(),
+		From:      from,
+		Limit:     limit,
+	}
+
+	return a.requester("getAuditLog", params, rootKey)
+}
+
 type Provider struct {
 	Actor      *crypto.Actor
 	DataKey    *crypto.Key
@@ -319,24 +361,220 @@ func (a *AppointmentsClient) GetAppointmentsByZipCode(params *services.GetAppoin
 	return a.requester("getAppointmentsByZipCode", params, nil)
 }
 
-func (a *AppointmentsClient) GetProviderAppointments(params *services.GetProviderAppointmentsParams) (*Response, error) {
-	return nil, nil
+func (a *AppointmentsClient) GetAppointmentsAggregated(params *services.GetAppointmentsByZipCodeParams) (*Response, error) {
+	return a.requester("getAppointmentsAggregated", params, nil)
+}
+
+func (a *AppointmentsClient) GetProvidersByZipCode(params *services.GetProvidersByZipCodeParams) (*Response, error) {
+	return a.requester("getProvidersByZipCode", params, nil)
+}
+
+func (a *AppointmentsClient) GetProviderAppointments(params *services.GetProviderAppointmentsParams, provider *Provider) (*Response, error) {
+	return a.requester("getProviderAppointments", params, provider.Actor.SigningKey)
 }
 
 func (a *AppointmentsClient) PublishAppointments(params *services.PublishAppointmentsParams, provider *Provider) (*Response, error) {
 	return a.requester("publishAppointments", params, provider.Actor.SigningKey)
 }
 
-func (a *AppointmentsClient) BookAppointment(params interface{}) (*Response, error) {
-	return nil, nil
+func (a *AppointmentsClient) PublishAppointmentSeries(series *services.AppointmentSeries, provider *Provider) (*Response, error) {
+
+	params := &services.PublishAppointmentSeriesParams{
+		Timestamp: time.Now(),
+		Series:    series,
+	}
+
+	return a.requester("publishAppointmentSeries", params, provider.Actor.SigningKey)
 }
 
-func (a *AppointmentsClient) CancelAppointment(params interface{}) (*Response, error) {
-	return nil, nil
+func (a *AppointmentsClient) GetAppointmentSeries(provider *Provider) (*Response, error) {
+
+	params := &services.GetAppointmentSeriesParams{
+		Timestamp: time.Now(),
+	}
+
+	return a.requester("getAppointmentSeries", params, provider.Actor.SigningKey)
 }
 
-func (a *AppointmentsClient) GetToken(params interface{}) (*Response, error) {
-	return nil, nil
+func (a *AppointmentsClient) DeleteAppointmentSeries(provider *Provider, id []byte) (*Response, error) {
+
+	params := &services.DeleteAppointmentSeriesParams{
+		Timestamp: time.Now(),
+		ID:        id,
+	}
+
+	return a.requester("deleteAppointmentSeries", params, provider.Actor.SigningKey)
+}
+
+type User struct {
+	Actor           *crypto.Actor
+	SignedTokenData *services.SignedTokenData
+}
+
+func (a *AppointmentsClient) BookAppointment(user *User, providerID []byte, appointment *services.SignedAppointment) (*Response, error) {
+
+	ephemeralKey, err := crypto.GenerateWebKey("ephemeral-user", "ecdh")
+
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedData, err := ephemeralKey.Encrypt([]byte("test"), &crypto.Key{PublicKey: appointment.Data.PublicKey})
+
+	if err != nil {
+		return nil, err
+	}
+
+	params := &services.BookAppointmentParams{
+		Timestamp:       time.Now(),
+		ProviderID:      providerID,
+		ID:              appointment.Data.ID,
+		EncryptedData:   encryptedData,
+		SignedTokenData: user.SignedTokenData,
+	}
+
+	return a.requester("bookAppointment", params, user.Actor.SigningKey)
+}
+
+func (a *AppointmentsClient) CancelAppointment(user *User, providerID []byte, appointment *services.SignedAppointment) (*Response, error) {
+
+	params := &services.CancelAppointmentParams{
+		Timestamp:       time.Now(),
+		ProviderID:      providerID,
+		ID:              appointment.Data.ID,
+		SignedTokenData: user.SignedTokenData,
+	}
+
+	return a.requester("cancelAppointment", params, user.Actor.SigningKey)
+}
+
+func (a *AppointmentsClient) CancelBooking(provider *Provider, appointmentID, bookingID, encryptionKey []byte, reason string) (*Response, error) {
+
+	encryptedReason, err := provider.Actor.EncryptionKey.Encrypt([]byte(reason), &crypto.Key{PublicKey: encryptionKey})
+
+	if err != nil {
+		return nil, err
+	}
+
+	params := &services.CancelBookingParams{
+		Timestamp:       time.Now(),
+		ID:              appointmentID,
+		BookingID:       bookingID,
+		EncryptedReason: encryptedReason,
+	}
+
+	return a.requester("cancelBooking", params, provider.Actor.SigningKey)
+}
+
+func (a *AppointmentsClient) GetBookingCancellations(user *User) (*Response, error) {
+
+	params := &services.GetBookingCancellationsParams{
+		Timestamp:       time.Now(),
+		SignedTokenData: user.SignedTokenData,
+	}
+
+	return a.requester("getBookingCancellations", params, user.Actor.SigningKey)
+}
+
+func (a *AppointmentsClient) JoinWaitlist(user *User, providerID, encryptionKey []byte, from, to time.Time) (*Response, error) {
+
+	ephemeralKey, err := crypto.GenerateWebKey("ephemeral-user", "ecdh")
+
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedData, err := ephemeralKey.Encrypt([]byte("test"), &crypto.Key{PublicKey: encryptionKey})
+
+	if err != nil {
+		return nil, err
+	}
+
+	params := &services.JoinWaitlistParams{
+		Timestamp:       time.Now(),
+		ProviderID:      providerID,
+		From:            from,
+		To:              to,
+		EncryptedData:   encryptedData,
+		SignedTokenData: user.SignedTokenData,
+	}
+
+	return a.requester("joinWaitlist", params, user.Actor.SigningKey)
+}
+
+func (a *AppointmentsClient) GetWaitlist(user *User, providerID []byte) (*Response, error) {
+
+	params := &services.WaitlistParams{
+		Timestamp:       time.Now(),
+		ProviderID:      providerID,
+		SignedTokenData: user.SignedTokenData,
+	}
+
+	return a.requester("getWaitlist", params, user.Actor.SigningKey)
+}
+
+func (a *AppointmentsClient) LeaveWaitlist(user *User, providerID []byte) (*Response, error) {
+
+	params := &services.WaitlistParams{
+		Timestamp:       time.Now(),
+		ProviderID:      providerID,
+		SignedTokenData: user.SignedTokenData,
+	}
+
+	return a.requester("leaveWaitlist", params, user.Actor.SigningKey)
+}
+
+func (a *AppointmentsClient) RescheduleAppointment(user *User, providerID []byte, appointment *services.SignedAppointment, newProviderID []byte, newAppointment *services.SignedAppointment) (*Response, error) {
+
+	ephemeralKey, err := crypto.GenerateWebKey("ephemeral-user", "ecdh")
+
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedData, err := ephemeralKey.Encrypt([]byte("test"), &crypto.Key{PublicKey: newAppointment.Data.PublicKey})
+
+	if err != nil {
+		return nil, err
+	}
+
+	params := &services.RescheduleAppointmentParams{
+		Timestamp:       time.Now(),
+		ProviderID:      providerID,
+		ID:              appointment.Data.ID,
+		NewProviderID:   newProviderID,
+		NewID:           newAppointment.Data.ID,
+		EncryptedData:   encryptedData,
+		SignedTokenData: user.SignedTokenData,
+	}
+
+	return a.requester("rescheduleAppointment", params, user.Actor.SigningKey)
+}
+
+func (a *AppointmentsClient) GetBookedAppointments(user *User) (*Response, error) {
+
+	params := &services.GetBookedAppointmentsParams{
+		Timestamp:       time.Now(),
+		SignedTokenData: user.SignedTokenData,
+	}
+
+	return a.requester("getBookedAppointments", params, user.Actor.SigningKey)
+}
+
+func (a *AppointmentsClient) GetToken(user *User) (*Response, error) {
+
+	hash, err := crypto.RandomBytes(32)
+
+	if err != nil {
+		return nil, err
+	}
+
+	params := &services.GetTokenParams{
+		Hash:      hash,
+		PublicKey: user.Actor.SigningKey.PublicKey,
+	}
+
+	return a.requester("getToken", params, nil)
 }
 
 type ConfirmProviderData struct {
@@ -396,12 +634,33 @@ func (a *AppointmentsClient) CheckProviderData(provider *Provider) (*Response, e
 	return a.requester("checkProviderData", params, provider.Actor.SigningKey)
 }
 
-func (a *AppointmentsClient) GetPendingProviderData(params interface{}) (*Response, error) {
-	return nil, nil
+func (a *AppointmentsClient) GetPendingProviderData(params *services.GetPendingProviderDataParams, mediator *crypto.Actor) (*Response, error) {
+	return a.requester("getPendingProviderData", params, mediator.SigningKey)
 }
 
-func (a *AppointmentsClient) GetVerifiedProviderData(params interface{}) (*Response, error) {
-	return nil, nil
+func (a *AppointmentsClient) GetVerifiedProviderData(params *services.GetVerifiedProviderDataParams, mediator *crypto.Actor) (*Response, error) {
+	return a.requester("getVerifiedProviderData", params, mediator.SigningKey)
+}
+
+func (a *AppointmentsClient) SuspendProvider(providerID []byte, mediator *crypto.Actor) (*Response, error) {
+	return a.requester("suspendProvider", &services.ManageProviderParams{
+		Timestamp:  time.Now(),
+		ProviderID: providerID,
+	}, mediator.SigningKey)
+}
+
+func (a *AppointmentsClient) ReactivateProvider(providerID []byte, mediator *crypto.Actor) (*Response, error) {
+	return a.requester("reactivateProvider", &services.ManageProviderParams{
+		Timestamp:  time.Now(),
+		ProviderID: providerID,
+	}, mediator.SigningKey)
+}
+
+func (a *AppointmentsClient) DeleteProvider(providerID []byte, mediator *crypto.Actor) (*Response, error) {
+	return a.requester("deleteProvider", &services.ManageProviderParams{
+		Timestamp:  time.Now(),
+		ProviderID: providerID,
+	}, mediator.SigningKey)
 }
 
 type StorageClient struct {
@@ -430,3 +689,100 @@ func (a *StorageClient) ResetDB() (*Response, error) {
 	return a.requester("resetDB", data, signingKey)
 
 }
+
+func (a *StorageClient) StoreSettings(id []byte, data interface{}, version int64, key *crypto.Key) (*Response, error) {
+	return a.requester("storeSettings", &services.StoreSettingsParams{
+		Timestamp: time.Now(),
+		ID:        id,
+		Data:      data,
+		Version:   version,
+	}, key)
+}
+
+func (a *StorageClient) GetSettings(id []byte) (*Response, error) {
+	return a.requester("getSettings", &services.GetSettingsParams{
+		ID: id,
+	}, nil)
+}
+
+func (a *StorageClient) DeleteSettings(id []byte, version int64, key *crypto.Key) (*Response, error) {
+	return a.requester("deleteSettings", &services.DeleteSettingsParams{
+		Timestamp: time.Now(),
+		ID:        id,
+		Version:   version,
+	}, key)
+}
+
+func (a *StorageClient) CreatePairing(key, signingKey *crypto.Key) (*Response, error) {
+	return a.requester("createPairing", &services.CreatePairingParams{
+		Timestamp: time.Now(),
+		PublicKey: key.PublicKey,
+	}, signingKey)
+}
+
+func (a *StorageClient) JoinPairing(code string, key *crypto.Key) (*Response, error) {
+	return a.requester("joinPairing", &services.JoinPairingParams{
+		Code:      code,
+		PublicKey: key.PublicKey,
+	}, nil)
+}
+
+func (a *StorageClient) GetPairing(id []byte) (*Response, error) {
+	return a.requester("getPairing", &services.GetPairingParams{
+		ID: id,
+	}, nil)
+}
+
+func (a *StorageClient) CompletePairing(id []byte, encryptedData *crypto.ECDHEncryptedData, signingKey *crypto.Key) (*Response, error) {
+	return a.requester("completePairing", &services.CompletePairingParams{
+		Timestamp:     time.Now(),
+		ID:            id,
+		EncryptedData: encryptedData,
+	}, signingKey)
+}
+
+func (a *StorageClient) CreateBlob(id []byte, size int64, key *crypto.Key) (*Response, error) {
+	return a.requester("createBlob", &services.CreateBlobParams{
+		Timestamp: time.Now(),
+		ID:        id,
+		Size:      size,
+	}, key)
+}
+
+func (a *StorageClient) UploadBlobChunk(id []byte, index int64, data []byte, key *crypto.Key) (*Response, error) {
+	hash := sha256.Sum256(data)
+	return a.requester("uploadBlobChunk", &services.UploadBlobChunkParams{
+		Timestamp: time.Now(),
+		ID:        id,
+		Index:     index,
+		Data:      data,
+		Hash:      hash[:],
+	}, key)
+}
+
+func (a *StorageClient) FinalizeBlob(id []byte, key *crypto.Key) (*Response, error) {
+	return a.requester("finalizeBlob", &services.BlobParams{
+		Timestamp: time.Now(),
+		ID:        id,
+	}, key)
+}
+
+func (a *StorageClient) GetBlob(id []byte) (*Response, error) {
+	return a.requester("getBlob", &services.GetBlobParams{
+		ID: id,
+	}, nil)
+}
+
+func (a *StorageClient) GetBlobChunk(id []byte, index int64) (*Response, error) {
+	return a.requester("getBlobChunk", &services.GetBlobChunkParams{
+		ID:    id,
+		Index: index,
+	}, nil)
+}
+
+func (a *StorageClient) DeleteBlob(id []byte, key *crypto.Key) (*Response, error) {
+	return a.requester("deleteBlob", &services.BlobParams{
+		Timestamp: time.Now(),
+		ID:        id,
+	}, key)
+}
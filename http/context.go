@@ -21,6 +21,7 @@ package http
 import (
 	"encoding/json"
 	"github.com/kiebitz-oss/services"
+	"net"
 	"net/http"
 )
 
@@ -53,6 +54,28 @@ func (c *Context) Get(key string) interface{} {
 	return v
 }
 
+// Returns the IP address of the client, without the port
+func (c *Context) ClientIP() string {
+	if host, _, err := net.SplitHostPort(c.Request.RemoteAddr); err == nil {
+		return host
+	}
+	return c.Request.RemoteAddr
+}
+
+// Limits the request body to the given number of bytes (if positive). Reading
+// beyond the limit fails with an error for which BodyTooLarge returns true.
+func (c *Context) LimitBody(n int64) {
+	if n > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, n)
+	}
+}
+
+// Returns true if the error was caused by a request body that exceeds the
+// limit set via LimitBody.
+func BodyTooLarge(err error) bool {
+	return err != nil && err.Error() == "http: request body too large"
+}
+
 func (c *Context) Abort() {
 	c.Aborted = true
 }
@@ -62,6 +85,7 @@ func (c *Context) AbortWithStatus(status int) {
 		return
 	}
 	c.Writer.WriteHeader(status)
+	c.HeaderWritten = true
 	c.Abort()
 }
 
@@ -20,7 +20,10 @@ package jsonrpc
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"github.com/kiebitz-oss/services/crypto"
 	"io/ioutil"
 	"net/http"
 )
@@ -35,19 +38,34 @@ func MakeClient(endpoint string) *Client {
 	}
 }
 
-func (c *Client) Call(request *Request) (*Response, error) {
-	data, err := json.Marshal(request)
+// requests without an ID are notifications that the server does not respond
+// to, so we generate one if necessary
+func ensureID(request *Request) error {
+	if request.ID != "" {
+		return nil
+	}
+	if randomID, err := crypto.RandomBytes(16); err != nil {
+		return err
+	} else {
+		request.ID = hex.EncodeToString(randomID)
+	}
+	return nil
+}
+
+func (c *Client) post(data interface{}) (int, []byte, error) {
+
+	jsonData, err := json.Marshal(data)
 
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 
 	client := &http.Client{}
 
-	req, err := http.NewRequest("POST", c.endpoint, bytes.NewReader(data))
+	req, err := http.NewRequest("POST", c.endpoint, bytes.NewReader(jsonData))
 
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 
 	req.Header.Add("Content-Type", "application/json")
@@ -56,13 +74,28 @@ func (c *Client) Call(request *Request) (*Response, error) {
 	resp, err := client.Do(req)
 
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 
-	// to do: sanity checks...
+	defer resp.Body.Close()
 
 	body, err := ioutil.ReadAll(resp.Body)
 
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+func (c *Client) Call(request *Request) (*Response, error) {
+
+	if err := ensureID(request); err != nil {
+		return nil, err
+	}
+
+	_, body, err := c.post(request)
+
 	if err != nil {
 		return nil, err
 	}
@@ -75,3 +108,49 @@ func (c *Client) Call(request *Request) (*Response, error) {
 
 	return response, nil
 }
+
+// Sends a notification, i.e. a request without an ID. The server does not
+// return a response.
+func (c *Client) Notify(request *Request) error {
+
+	notification := *request
+	notification.ID = ""
+
+	if _, _, err := c.post(&notification); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Sends the requests as a single batch. Requests without an ID are sent as
+// notifications, all other requests get a response. As the server may return
+// responses in any order, they should be matched to the requests by their ID.
+func (c *Client) CallBatch(requests []*Request) ([]*Response, error) {
+
+	code, body, err := c.post(requests)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the batch only contained notifications
+	if code == 204 {
+		return []*Response{}, nil
+	}
+
+	responses := []*Response{}
+
+	if err := json.Unmarshal(body, &responses); err != nil {
+		// the batch as a whole was rejected
+		response := &Response{}
+		if err := json.Unmarshal(body, response); err != nil {
+			return nil, err
+		} else if response.Error != nil {
+			return nil, fmt.Errorf("batch rejected: %s", response.Error.Message)
+		}
+		return nil, fmt.Errorf("unexpected batch response")
+	}
+
+	return responses, nil
+}
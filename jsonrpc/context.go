@@ -21,6 +21,7 @@ package jsonrpc
 import (
 	"fmt"
 	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/http"
 	"regexp"
 	"strconv"
 	"strings"
@@ -30,6 +31,7 @@ var idRegexp = regexp.MustCompile(`^n:(-?\d{1,32})$`)
 var idNRegexp = regexp.MustCompile(`^(n+):(-?\d{1,32})$`)
 
 type Context struct {
+	HTTP    *http.Context
 	Request *Request
 }
 
@@ -75,6 +77,13 @@ func (c *Context) Error(code int, message string, data interface{}) services.Res
 	}
 }
 
+func (c *Context) ClientIP() string {
+	if c.HTTP == nil {
+		return ""
+	}
+	return c.HTTP.ClientIP()
+}
+
 func (c *Context) Params() map[string]interface{} {
 	return c.Request.Params
 }
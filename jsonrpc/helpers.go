@@ -19,11 +19,9 @@
 package jsonrpc
 
 import (
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/kiebitz-oss/services"
-	"github.com/kiebitz-oss/services/crypto"
 	"github.com/kiebitz-oss/services/http"
 	"regexp"
 	"strings"
@@ -31,75 +29,131 @@ import (
 
 var jsonContentTypeRegexp = regexp.MustCompile("(?i)^application/json(?:;.*)?$")
 
-// extracts the request data from
-// known limitations: very large numerical ID values will be truncated due to
-// the fact that Golang converts JSON numbers to float64 values...
-func ExtractJSONRequest(c *http.Context) {
-	services.Log.Debugf("Extracting JSON data...")
+var invalidJSONResponse = Response{JSONRPC: "2.0", Error: &Error{Code: -32700, Message: "JSON required"}}
+var serverErrorResponse = Response{JSONRPC: "2.0", Error: &Error{Code: -32603, Message: "internal server error"}}
 
-	invalidJSONResponse := Response{JSONRPC: "2.0,", Error: &Error{Code: -32700, Message: "JSON required"}}
-	invalidRequestResponse := func(err error) *Response {
-		return &Response{JSONRPC: "2.0,", Error: &Error{Code: -32600, Message: "invalid request", Data: err}}
-	}
-	serverErrorResponse := Response{JSONRPC: "2.0,", Error: &Error{Code: -32603, Message: "internal server error"}}
+func invalidRequestResponse(err error) *Response {
+	return &Response{JSONRPC: "2.0", Error: &Error{Code: -32600, Message: "invalid request", Data: err}}
+}
+
+// parses a single request object, returning an error response if the request
+// is invalid
+func parseRequest(jsonData interface{}) (*Request, *Response) {
+
+	mapData, ok := jsonData.(map[string]interface{})
 
-	if c.Request.Method != "POST" {
-		c.JSON(405, Response{JSONRPC: "2.0", Error: &Error{Code: -1, Message: "method not allowed"}})
-		return
+	if !ok {
+		return nil, invalidRequestResponse(fmt.Errorf("expected an object"))
 	}
 
-	if !jsonContentTypeRegexp.MatchString(c.Request.Header.Get("content-type")) {
-		c.JSON(400, invalidJSONResponse)
-		return
+	validJSON, err := JSONRPCRequestForm.Validate(mapData)
+
+	if err != nil {
+		// validation errors are safe to pass back to the client
+		return nil, invalidRequestResponse(err)
 	}
 
-	var jsonData map[string]interface{}
+	var request Request
 
-	decoder := json.NewDecoder(c.Request.Body)
+	id, ok := validJSON["id"]
 
-	if err := decoder.Decode(&jsonData); err != nil {
-		c.JSON(400, invalidJSONResponse)
-		return
-	}
+	// requests without an ID are notifications, which we do not respond to
+	notification := !ok || id == nil
 
-	if validJSON, err := JSONRPCRequestForm.Validate(jsonData); err != nil {
-		// validation errors are safe to pass back to the client
-		c.JSON(400, invalidRequestResponse(err))
-		return
+	if notification {
+		validJSON["id"] = ""
 	} else {
-		var request Request
+		switch v := id.(type) {
+		case int64:
+			// we convert numbers to strings
+			validJSON["id"] = fmt.Sprintf("n:%d", v)
+		case string:
+			if matches := idNRegexp.FindStringSubmatch(v); matches != nil {
+				// we need to escape the string IDs that match our custom format...
+				validJSON["id"] = fmt.Sprintf("%s:%s", strings.Repeat("n", 2*len(matches[1])), matches[2])
+			}
+		}
+	}
+
+	// this should never happen if the form validation is correct...
+	if err := JSONRPCRequestForm.Coerce(&request, validJSON); err != nil {
+		services.Log.Error(err)
+		return nil, &serverErrorResponse
+	}
+
+	request.Notification = notification
+
+	return &request, nil
+}
+
+// extracts the request data from the HTTP body, which can either contain a
+// single request object or a batch (i.e. an array) of request objects.
+// Bodies larger than maxBodySize (if positive) are rejected before decoding.
+// known limitations: very large numerical ID values will be truncated due to
+// the fact that Golang converts JSON numbers to float64 values...
+func ExtractJSONRequest(maxBatchSize, maxBodySize int64) http.Handler {
+	return func(c *http.Context) {
+		services.Log.Debugf("Extracting JSON data...")
+
+		if c.Request.Method != "POST" {
+			c.JSON(405, Response{JSONRPC: "2.0", Error: &Error{Code: -1, Message: "method not allowed"}})
+			return
+		}
+
+		if !jsonContentTypeRegexp.MatchString(c.Request.Header.Get("content-type")) {
+			c.JSON(400, invalidJSONResponse)
+			return
+		}
+
+		var jsonData interface{}
+
+		c.LimitBody(maxBodySize)
 
-		id, ok := validJSON["id"]
+		decoder := json.NewDecoder(c.Request.Body)
+
+		if err := decoder.Decode(&jsonData); http.BodyTooLarge(err) {
+			c.JSON(413, Response{JSONRPC: "2.0", Error: &Error{Code: 413, Message: "request too large"}})
+			return
+		} else if err != nil {
+			c.JSON(400, invalidJSONResponse)
+			return
+		}
+
+		batchData, ok := jsonData.([]interface{})
 
-		// if no ID is contained we generate a random UUID
 		if !ok {
-			if randomID, err := crypto.RandomBytes(16); err != nil {
-				c.JSON(500, serverErrorResponse)
-				return
-			} else {
-				validJSON["id"] = hex.EncodeToString(randomID)
-			}
-		} else {
-			switch v := id.(type) {
-			case int64:
-				// we convert numbers to strings
-				validJSON["id"] = fmt.Sprintf("n:%d", v)
-			case string:
-				if matches := idNRegexp.FindStringSubmatch(v); matches != nil {
-					// we need to escape the string IDs that match our custom format...
-					validJSON["id"] = fmt.Sprintf("%s:%s", strings.Repeat("n", 2*len(matches[1])), matches[2])
+			if request, response := parseRequest(jsonData); response != nil {
+				if response.Error.Code == serverErrorResponse.Error.Code {
+					c.JSON(500, response)
+				} else {
+					c.JSON(400, response)
 				}
+			} else {
+				c.Set("request", request)
 			}
+			return
 		}
 
-		// this should never happen if the form validation is correct...
-		if err := JSONRPCRequestForm.Coerce(&request, validJSON); err != nil {
-			services.Log.Error(err)
-			c.JSON(500, serverErrorResponse)
+		if len(batchData) == 0 {
+			c.JSON(400, invalidRequestResponse(fmt.Errorf("empty batch")))
 			return
 		}
 
-		c.Set("request", &request)
-	}
+		if maxBatchSize > 0 && int64(len(batchData)) > maxBatchSize {
+			c.JSON(400, invalidRequestResponse(fmt.Errorf("batch too large (at most %d requests allowed)", maxBatchSize)))
+			return
+		}
 
+		batch := make([]*BatchEntry, len(batchData))
+
+		for i, entryData := range batchData {
+			request, response := parseRequest(entryData)
+			batch[i] = &BatchEntry{
+				Request:  request,
+				Response: response,
+			}
+		}
+
+		c.Set("batch", batch)
+	}
 }
@@ -38,43 +38,92 @@ type JSONRPCServer struct {
 	handler       Handler
 }
 
-func (s *JSONRPCServer) JSONRPC(handler Handler) http.Handler {
+// handles a single request and records its duration by method and code
+func (s *JSONRPCServer) handle(c *http.Context, handler Handler, request *Request) (*Response, int) {
 
-	return func(c *http.Context) {
+	startTime := time.Now()
 
-		startTime := time.Now()
+	context := &Context{
+		HTTP:    c,
+		Request: request,
+	}
 
-		// the request data has been validated by the 'ExtractJSONRequest' handler
-		request := c.Get("request").(*Request)
+	response := handler(context)
 
-		context := &Context{
-			Request: request,
-		}
+	if response == nil {
+		response = context.Nil().(*Response)
+	}
+
+	// people will forget this so we add it here in that case
+	if response.JSONRPC == "" {
+		response.JSONRPC = "2.0"
+	}
+
+	code := 200
+
+	// if there was an error we return a 400 status instead of 200
+	if response.Error != nil {
+		code = 400
+	}
+
+	elapsedTime := time.Since(startTime)
+	codeString := strconv.Itoa(code)
+
+	s.httpDurations.WithLabelValues(request.Method, codeString).Observe(elapsedTime.Seconds())
+
+	return response, code
+}
+
+// handles a batch of requests in order. Errors are returned per entry, so the
+// batch itself always succeeds. If the batch only contains notifications we
+// return an empty response.
+func (s *JSONRPCServer) handleBatch(c *http.Context, handler Handler, batch []*BatchEntry) {
 
-		response := handler(context)
+	responses := make([]*Response, 0, len(batch))
 
-		if response == nil {
-			response = context.Nil().(*Response)
+	for _, entry := range batch {
+
+		if entry.Response != nil {
+			responses = append(responses, entry.Response)
+			continue
 		}
 
-		// people will forget this so we add it here in that case
-		if response.JSONRPC == "" {
-			response.JSONRPC = "2.0"
+		response, _ := s.handle(c, handler, entry.Request)
+
+		if !entry.Request.Notification {
+			responses = append(responses, response)
 		}
+	}
+
+	if len(responses) == 0 {
+		c.AbortWithStatus(204)
+		return
+	}
+
+	c.JSON(200, responses)
+}
+
+func (s *JSONRPCServer) JSONRPC(handler Handler) http.Handler {
 
-		code := 200
+	return func(c *http.Context) {
 
-		// if there was an error we return a 400 status instead of 200
-		if response.Error != nil {
-			code = 400
+		// the request data has been validated by the 'ExtractJSONRequest' handler
+		if batch, ok := c.Get("batch").([]*BatchEntry); ok {
+			s.handleBatch(c, handler, batch)
+			return
 		}
 
-		c.JSON(code, response)
+		request := c.Get("request").(*Request)
+
+		response, code := s.handle(c, handler, request)
 
-		elapsedTime := time.Since(startTime)
-		codeString := strconv.Itoa(code)
+		// notifications are fire-and-forget
+		if request.Notification {
+			c.AbortWithStatus(204)
+			return
+		}
 
-		s.httpDurations.WithLabelValues(request.Method, codeString).Observe(elapsedTime.Seconds())
+		c.JSON(code, response)
 	}
 }
 
@@ -95,7 +144,7 @@ func MakeJSONRPCServer(settings *services.JSONRPCServerSettings, handler Handler
 				{
 					Pattern: "^/jsonrpc$",
 					Handlers: []http.Handler{
-						ExtractJSONRequest,
+						ExtractJSONRequest(settings.MaxBatchSize, settings.MaxBodySize),
 						server.JSONRPC(handler),
 					},
 				},
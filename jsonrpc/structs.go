@@ -26,7 +26,16 @@ type Request struct {
 	JSONRPC string                 `json:"jsonrpc"`
 	Method  string                 `json:"method"`
 	Params  map[string]interface{} `json:"params"`
-	ID      string                 `json:"id"`
+	ID      string                 `json:"id,omitempty"`
+	// notifications are requests without an ID, we do not respond to them
+	Notification bool `json:"-"`
+}
+
+// An entry of a batch request. Entries that are invalid contain an error
+// response instead of a request.
+type BatchEntry struct {
+	Request  *Request
+	Response *Response
 }
 
 func MakeRequest(method, id string, params map[string]interface{}) *Request {
@@ -54,6 +54,13 @@ func (c *Context) Params() map[string]interface{} {
 	return c.Request.Params
 }
 
+func (c *Context) ClientIP() string {
+	if c.HTTP == nil {
+		return ""
+	}
+	return c.HTTP.ClientIP()
+}
+
 func (c *Context) NotFound() services.Response {
 	return c.Error(404, "not found", nil)
 }
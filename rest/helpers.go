@@ -21,6 +21,7 @@ package rest
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/kiebitz-oss/services/http"
 	"net/url"
 	"regexp"
 )
@@ -50,7 +51,9 @@ func ExtractRESTRequest(c *Context, methods map[string]*Method) (*Request, *Resp
 		}
 
 		decoder := json.NewDecoder(c.HTTP.Request.Body)
-		if err := decoder.Decode(&params); err != nil {
+		if err := decoder.Decode(&params); http.BodyTooLarge(err) {
+			return nil, c.Error(413, "request too large", nil).(*Response)
+		} else if err != nil {
 			return nil, c.Error(400, "invalid JSON", nil).(*Response)
 		}
 	} else {
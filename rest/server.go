@@ -43,12 +43,20 @@ func (s *RESTServer) REST(handler Handler) http.Handler {
 
 	return func(c *http.Context) {
 
+		// another route (e.g. the OpenAPI specification) already responded
+		if c.HeaderWritten {
+			return
+		}
+
 		startTime := time.Now()
 
 		context := &Context{
 			HTTP: c,
 		}
 
+		// the body is decoded by the handler, so we limit it here
+		c.LimitBody(s.settings.MaxBodySize)
+
 		response := handler(context)
 
 		if response == nil {
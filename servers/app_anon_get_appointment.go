@@ -40,6 +40,19 @@ func (c *Appointments) getAppointment(context services.Context, params *services
 		return context.InternalError()
 	}
 
+	// unknown or flagged providers have no key
+	if providerKey == nil {
+		return context.NotFound()
+	}
+
+	// suspended providers are hidden from users
+	if suspended, err := c.backend.SuspendedProviders().Has(params.ProviderID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if suspended {
+		return context.NotFound()
+	}
+
 	// fetch the full public data of the provider
 	providerData, err := publicProviderData.Get(params.ProviderID)
 
@@ -20,158 +20,61 @@ package servers
 
 import (
 	"github.com/kiebitz-oss/services"
-	"github.com/kiebitz-oss/services/crypto"
-	"github.com/kiebitz-oss/services/databases"
-	"time"
 )
 
 func (c *Appointments) getAppointmentsAggregated(context services.Context, params *services.GetAppointmentsByZipCodeParams) services.Response {
 
-	// get all provider keys
-	keys, err := c.getActorKeys()
+	// the cursor is bound to the query without the cursor itself
+	query := *params
+	query.Cursor = ""
+
+	position, err := c.decodeCursor("getAppointmentsAggregated", &query, params.Cursor)
 
 	if err != nil {
-		services.Log.Error(err)
-		return context.InternalError()
+		return context.Error(400, "invalid cursor", nil)
 	}
 
-	// get all neighboring zip codes for the given zip code
-	neighbors := c.backend.Neighbors("zipCode", params.ZipCode)
-	// public provider data structure
-	publicProviderData := c.backend.PublicProviderData()
+	matches, nextPosition, err := c.searchAppointments(params, position, pageSize(params.Limit, c.settings.AggregatedMaxProvider), c.settings.AggregatedMaxAppointment)
 
-	allNeighbors, err := neighbors.Range(0, -1)
 	if err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
 	}
 
-	distances := map[string]int64{}
-
-	for _, neighbor := range allNeighbors {
-		distances[string(neighbor.Data)] = neighbor.Score
-	}
-
 	providerAppointmentsList := []*services.AggregatedProviderAppointments{}
 
-	for _, providerKey := range keys.Providers {
-
-		if int64(len(providerAppointmentsList)) >= c.settings.AggregatedMaxProvider {
-			break
-		}
-
-		pkd, err := providerKey.ProviderKeyData()
-
-		if err != nil {
-			services.Log.Error(err)
-			continue
-		}
-
-		if pkd.QueueData.ZipCode != params.ZipCode {
-			// check the distance of the zip codes don't match
-			if distance, ok := distances[pkd.QueueData.ZipCode]; !ok {
-				continue
-			} else if distance > params.Radius {
-				continue
-			}
-		}
-
-		// the provider "ID" is the hash of the signing key
-		hash := crypto.Hash(pkd.Signing)
+	for _, match := range matches {
 
-		// fetch the full public data of the provider
-		providerData, err := publicProviderData.Get(hash)
+		appointments := make([]*services.AppointmentAggregated, len(match.Appointments))
 
-		if err != nil {
-			if err != databases.NotFound {
-				services.Log.Error(err)
+		for i, signedAppointment := range match.Appointments {
+			appointments[i] = &services.AppointmentAggregated{
+				ID:         signedAppointment.Data.ID,
+				Duration:   signedAppointment.Data.Duration,
+				Properties: signedAppointment.Data.Properties,
+				SlotN:      len(signedAppointment.Data.SlotData) - len(signedAppointment.Bookings),
+				Timestamp:  signedAppointment.Data.Timestamp,
 			}
-			services.Log.Warning("provider data not found")
-			continue
-		}
-
-		// appointments are stored in a provider-specific key
-		appointmentDatesByID := c.backend.AppointmentDatesByID(hash)
-		// complexity: O(n) where n is the number of appointments of the provider
-		allDates, err := appointmentDatesByID.GetAll()
-
-		if err != nil {
-			services.Log.Error(err)
-			return context.InternalError()
-		}
-
-		appointments := make([]*services.AppointmentAggregated, 0)
-
-		visitedDates := make(map[string]bool)
-
-	getAppointments:
-		for _, dateStr := range allDates {
-
-			if _, ok := visitedDates[string(dateStr)]; ok {
-				continue
-			} else {
-				visitedDates[string(dateStr)] = true
-			}
-
-			date, err := time.Parse("2006-01-02", string(dateStr))
-			if err != nil {
-				services.Log.Error(err)
-				continue
-			}
-
-			if date.Before(params.From) || date.After(params.To) {
-				continue
-			}
-
-			appointmentsByDate := c.backend.AppointmentsByDate(hash, string(dateStr))
-			allAppointments, err := appointmentsByDate.GetAll(c.settings.Validate)
-
-			if err != nil {
-				services.Log.Error(err)
-				return context.InternalError()
-			}
-
-			for _, signedAppointment := range allAppointments {
-
-				slotN := len(signedAppointment.Data.SlotData) - len(signedAppointment.Bookings)
-
-				// if all slots are booked we do not return the appointment
-				if slotN <= 1 {
-					continue
-				}
-
-				appointment := &services.AppointmentAggregated{
-					ID:         signedAppointment.Data.ID,
-					Duration:   signedAppointment.Data.Duration,
-					Properties: signedAppointment.Data.Properties,
-					SlotN:      slotN,
-					Timestamp:  signedAppointment.Data.Timestamp,
-				}
-
-				appointments = append(appointments, appointment)
-
-				if int64(len(appointments)) >= c.settings.AggregatedMaxAppointment {
-					break getAppointments
-				}
-			}
-		}
-
-		if len(appointments) == 0 {
-			continue
 		}
 
 		// we add the hash for convenience
-		providerData.Data.ID = hash
+		match.Data.Data.ID = match.ID
 
 		providerAppointments := &services.AggregatedProviderAppointments{
-			Provider:     providerData.Data,
+			Provider:     match.Data.Data,
 			Appointments: appointments,
 		}
 
-		providerAppointmentsList = append( providerAppointmentsList, providerAppointments)
+		providerAppointmentsList = append(providerAppointmentsList, providerAppointments)
 
 	}
 
-	return context.Result(providerAppointmentsList)
-}
+	cursor, err := c.encodeCursor("getAppointmentsAggregated", &query, nextPosition)
 
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Result(pageResult(params.Limit > 0 || params.Cursor != "", providerAppointmentsList, cursor))
+}
@@ -20,164 +20,69 @@ package servers
 
 import (
 	"github.com/kiebitz-oss/services"
-	"github.com/kiebitz-oss/services/crypto"
-	"github.com/kiebitz-oss/services/databases"
-	"time"
 )
 
 func (c *Appointments) getAppointmentsByZipCode(context services.Context, params *services.GetAppointmentsByZipCodeParams) services.Response {
 
-	// get all provider keys
-	keys, err := c.getActorKeys()
+	// the cursor is bound to the query without the cursor itself
+	query := *params
+	query.Cursor = ""
+
+	position, err := c.decodeCursor("getAppointmentsByZipCode", &query, params.Cursor)
 
 	if err != nil {
-		services.Log.Error(err)
-		return context.InternalError()
+		return context.Error(400, "invalid cursor", nil)
 	}
 
-	// get all neighboring zip codes for the given zip code
-	neighbors := c.backend.Neighbors("zipCode", params.ZipCode)
-	// public provider data structure
-	publicProviderData := c.backend.PublicProviderData()
+	matches, nextPosition, err := c.searchAppointments(params, position, pageSize(params.Limit, c.settings.ResponseMaxProvider), c.settings.ResponseMaxAppointment)
 
-	allNeighbors, err := neighbors.Range(0, -1)
 	if err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
 	}
 
-	distances := map[string]int64{}
+	mediatorKeys, err := c.backend.Keys("mediators").GetAll()
 
-	for _, neighbor := range allNeighbors {
-		distances[string(neighbor.Data)] = neighbor.Score
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
 	}
 
 	providerAppointmentsList := []*services.ProviderAppointments{}
 
-	for _, providerKey := range keys.Providers {
-
-		if int64(len(providerAppointmentsList)) >= c.settings.ResponseMaxProvider {
-			break
-		}
+	for _, match := range matches {
 
-		pkd, err := providerKey.ProviderKeyData()
+		mediatorKey, err := findActorKey(mediatorKeys, match.Key.PublicKey)
 
 		if err != nil {
 			services.Log.Error(err)
 			continue
 		}
 
-		if pkd.QueueData.ZipCode != params.ZipCode {
-			// check the distance of the zip codes don't match
-			if distance, ok := distances[pkd.QueueData.ZipCode]; !ok {
-				continue
-			} else if distance > params.Radius {
-				continue
-			}
-		}
-
-		// the provider "ID" is the hash of the signing key
-		hash := crypto.Hash(pkd.Signing)
+		for _, signedAppointment := range match.Appointments {
 
-		// fetch the full public data of the provider
-		providerData, err := publicProviderData.Get(hash)
+			slots := make([]*services.Slot, len(signedAppointment.Bookings))
 
-		if err != nil {
-			if err != databases.NotFound {
-				services.Log.Error(err)
+			for i, booking := range signedAppointment.Bookings {
+				slots[i] = &services.Slot{ID: booking.ID}
 			}
-			services.Log.Warning("provider data not found")
-			continue
-		}
 
-		// appointments are stored in a provider-specific key
-		appointmentDatesByID := c.backend.AppointmentDatesByID(hash)
-		// complexity: O(n) where n is the number of appointments of the provider
-		allDates, err := appointmentDatesByID.GetAll()
-
-		if err != nil {
-			services.Log.Error(err)
-			return context.InternalError()
-		}
-
-		signedAppointments := make([]*services.SignedAppointment, 0)
-
-		visitedDates := make(map[string]bool)
-
-	getAppointments:
-		for _, dateStr := range allDates {
-
-			if _, ok := visitedDates[string(dateStr)]; ok {
-				continue
-			} else {
-				visitedDates[string(dateStr)] = true
-			}
-
-			date, err := time.Parse("2006-01-02", string(dateStr))
-			if err != nil {
-				services.Log.Error(err)
-				continue
-			}
-
-			if date.Before(params.From) || date.After(params.To) {
-				continue
-			}
-
-			appointmentsByDate := c.backend.AppointmentsByDate(hash, string(dateStr))
-			allAppointments, err := appointmentsByDate.GetAll(c.settings.Validate)
-
-			if err != nil {
-				services.Log.Error(err)
-				return context.InternalError()
-			}
-
-			for _, signedAppointment := range allAppointments {
-
-				slots := make([]*services.Slot, len(signedAppointment.Bookings))
-
-				for i, booking := range signedAppointment.Bookings {
-					slots[i] = &services.Slot{ID: booking.ID}
-				}
-
-				// if all slots are booked we do not return the appointment
-				if len(slots) == len(signedAppointment.Data.SlotData) {
-					continue
-				}
-
-				// we remove the bookings as the user is not allowed to see them
-				signedAppointment.Bookings = nil
-				signedAppointment.BookedSlots = slots
-
-				signedAppointments = append(signedAppointments, signedAppointment)
-
-				if int64(len(signedAppointments)) >= c.settings.ResponseMaxAppointment {
-					break getAppointments
-				}
-			}
-		}
-
-		if len(signedAppointments) == 0 {
-			continue
-		}
-
-		mediatorKey, err := findActorKey(keys.Mediators, providerKey.PublicKey)
-
-		if err != nil {
-			services.Log.Error(err)
-			continue
+			// we remove the bookings as the user is not allowed to see them
+			signedAppointment.Bookings = nil
+			signedAppointment.BookedSlots = slots
 		}
 
 		keyChain := &services.KeyChain{
-			Provider: providerKey,
+			Provider: match.Key,
 			Mediator: mediatorKey,
 		}
 
 		// we add the hash for convenience
-		providerData.ID = hash
+		match.Data.ID = match.ID
 
 		providerAppointments := &services.ProviderAppointments{
-			Provider:     providerData,
-			Appointments: signedAppointments,
+			Provider:     match.Data,
+			Appointments: match.Appointments,
 			KeyChain:     keyChain,
 		}
 
@@ -185,5 +90,12 @@ func (c *Appointments) getAppointmentsByZipCode(context services.Context, params
 
 	}
 
-	return context.Result(providerAppointmentsList)
+	cursor, err := c.encodeCursor("getAppointmentsByZipCode", &query, nextPosition)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Result(pageResult(params.Limit > 0 || params.Cursor != "", providerAppointmentsList, cursor))
 }
@@ -60,6 +60,25 @@ func BenchmarkGetAppointmentsByZipCode(b *testing.B) {
 				},
 			},
 		}, "providersAndAppointments"},
+
+		// providers outside of the search radius, which should not slow down the search
+		at.FC{af.ProvidersAndAppointments{
+			Providers: 100,
+			BaseProvider: af.Provider{
+				ZipCode:   "80331",
+				StoreData: true,
+				Confirm:   true,
+			},
+			BaseAppointments: af.Appointments{
+				N:        100,
+				Start:    af.TS("2022-10-01T12:00:00Z"),
+				Duration: 30,
+				Slots:    20,
+				Properties: map[string]interface{}{
+					"vaccine": "moderna",
+				},
+			},
+		}, "otherProvidersAndAppointments"},
 	}
 
 	fixtures, err := at.SetupFixtures(fixturesConfig)
@@ -78,6 +97,8 @@ func BenchmarkGetAppointmentsByZipCode(b *testing.B) {
 		if _, err := client.Appointments.GetAppointmentsByZipCode(&services.GetAppointmentsByZipCodeParams{
 			ZipCode: "10707",
 			Radius:  20,
+			From:    af.TS("2022-10-01T00:00:00Z"),
+			To:      af.TS("2022-10-03T00:00:00Z"),
 		}); err != nil {
 			b.Fatal(err)
 		}
@@ -19,12 +19,14 @@
 package servers_test
 
 import (
+	"encoding/json"
 	"github.com/kiebitz-oss/services"
 	"github.com/kiebitz-oss/services/definitions"
 	"github.com/kiebitz-oss/services/helpers"
 	at "github.com/kiebitz-oss/services/testing"
 	af "github.com/kiebitz-oss/services/testing/fixtures"
 	"testing"
+	"time"
 )
 
 func TestGetAppointmentsByZipCode(t *testing.T) {
@@ -85,3 +87,440 @@ func TestGetAppointmentsByZipCode(t *testing.T) {
 	}
 
 }
+
+func getAppointmentsByZipCode(t *testing.T, client *helpers.Client, params *services.GetAppointmentsByZipCodeParams) ([]*services.ProviderAppointments, string) {
+
+	resp, err := client.Appointments.GetAppointmentsByZipCode(params)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Result json.RawMessage `json:"result"`
+	}
+
+	if data, err := resp.Bytes(); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	var page services.Page
+	var results []*services.ProviderAppointments
+
+	// clients that do not ask for paging get a bare result list
+	if params.Limit == 0 && params.Cursor == "" {
+		if err := json.Unmarshal(result.Result, &results); err != nil {
+			t.Fatalf("expected a result list: %v", err)
+		}
+	} else {
+		page.Results = &results
+		if err := json.Unmarshal(result.Result, &page); err != nil {
+			t.Fatalf("expected a page of results: %v", err)
+		}
+	}
+
+	for _, providerAppointments := range results {
+		for _, appointment := range providerAppointments.Appointments {
+			if err := json.Unmarshal([]byte(appointment.JSON), &appointment.Data); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	return results, page.Cursor
+}
+
+func TestGetAppointmentsByZipCodeFilters(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// an accessible provider with morning appointments
+		at.FC{af.ProvidersAndAppointments{
+			Providers: 1,
+			BaseProvider: af.Provider{
+				ZipCode:    "10707",
+				StoreData:  true,
+				Confirm:    true,
+				Accessible: true,
+			},
+			BaseAppointments: af.Appointments{
+				N:        4,
+				Start:    af.TS("2022-10-01T09:00:00Z"),
+				Duration: 30,
+				Slots:    2,
+				Properties: map[string]interface{}{
+					"vaccine": "moderna",
+					"minAge":  18,
+				},
+			},
+		}, "morningProvider"},
+
+		// a provider with earlier appointments and more slots
+		at.FC{af.ProvidersAndAppointments{
+			Providers: 1,
+			BaseProvider: af.Provider{
+				ZipCode:   "10707",
+				StoreData: true,
+				Confirm:   true,
+			},
+			BaseAppointments: af.Appointments{
+				N:        4,
+				Start:    af.TS("2022-10-01T06:00:00Z"),
+				Duration: 30,
+				Slots:    5,
+				Properties: map[string]interface{}{
+					"vaccine": "biontech",
+				},
+			},
+		}, "earlyProvider"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+
+	search := func(params services.GetAppointmentsByZipCodeParams) []*services.ProviderAppointments {
+		params.ZipCode = "10707"
+		params.Radius = 20
+		params.From = af.TS("2022-10-01T00:00:00Z")
+		params.To = af.TS("2022-10-02T00:00:00Z")
+		results, _ := getAppointmentsByZipCode(t, client, &params)
+		return results
+	}
+
+	count := func(results []*services.ProviderAppointments) (int, int) {
+		n := 0
+		for _, providerAppointments := range results {
+			n += len(providerAppointments.Appointments)
+		}
+		return len(results), n
+	}
+
+	for _, tc := range []struct {
+		name         string
+		params       services.GetAppointmentsByZipCodeParams
+		providers    int
+		appointments int
+	}{
+		{"no filters", services.GetAppointmentsByZipCodeParams{}, 2, 8},
+		{"vaccine", services.GetAppointmentsByZipCodeParams{Properties: map[string]interface{}{"vaccine": "biontech"}}, 1, 4},
+		{"minimum age", services.GetAppointmentsByZipCodeParams{Properties: map[string]interface{}{"minAge": 18}}, 1, 4},
+		{"accessible", services.GetAppointmentsByZipCodeParams{Accessible: true}, 1, 4},
+		{"time from", services.GetAppointmentsByZipCodeParams{TimeFrom: "10:00"}, 1, 2},
+		{"time to", services.GetAppointmentsByZipCodeParams{TimeTo: "06:30"}, 1, 2},
+		{"minimum slots", services.GetAppointmentsByZipCodeParams{MinSlots: 3}, 1, 4},
+	} {
+		if providers, appointments := count(search(tc.params)); providers != tc.providers || appointments != tc.appointments {
+			t.Fatalf("%s: expected %d providers with %d appointments, got %d with %d", tc.name, tc.providers, tc.appointments, providers, appointments)
+		}
+	}
+
+	// the provider with the earliest appointment comes first
+	results := search(services.GetAppointmentsByZipCodeParams{SortBy: "earliest"})
+
+	if len(results) != 2 || results[0].Appointments[0].Data.Properties["vaccine"] != "biontech" {
+		t.Fatalf("expected the early provider to come first")
+	}
+
+	// filters are validated against the property schema
+	if resp, err := client.Appointments.GetAppointmentsByZipCode(&services.GetAppointmentsByZipCodeParams{
+		ZipCode:    "10707",
+		Radius:     20,
+		From:       af.TS("2022-10-01T00:00:00Z"),
+		To:         af.TS("2022-10-02T00:00:00Z"),
+		Properties: map[string]interface{}{"vaccine": "sputnik"},
+	}); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 400 {
+		t.Fatalf("expected a 400 status code, got %d", resp.StatusCode)
+	}
+
+	// the aggregated endpoint supports the same filters
+	if resp, err := client.Appointments.GetAppointmentsAggregated(&services.GetAppointmentsByZipCodeParams{
+		ZipCode:    "10707",
+		Radius:     20,
+		From:       af.TS("2022-10-01T00:00:00Z"),
+		To:         af.TS("2022-10-02T00:00:00Z"),
+		Properties: map[string]interface{}{"vaccine": "moderna"},
+	}); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	} else {
+		var result struct {
+			Result []*services.AggregatedProviderAppointments `json:"result"`
+		}
+		if data, err := resp.Bytes(); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal(data, &result); err != nil {
+			t.Fatal(err)
+		} else if len(result.Result) != 1 || len(result.Result[0].Appointments) != 4 {
+			t.Fatalf("expected one provider with 4 appointments")
+		}
+	}
+}
+
+func TestGetAppointmentsByZipCodePagination(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// more providers and appointments than fit on a single page
+		at.FC{af.ProvidersAndAppointments{
+			Providers: 12,
+			BaseProvider: af.Provider{
+				ZipCode:   "10707",
+				StoreData: true,
+				Confirm:   true,
+			},
+			BaseAppointments: af.Appointments{
+				N:        15,
+				Start:    af.TS("2022-10-01T08:00:00Z"),
+				Duration: 30,
+				Slots:    2,
+				Properties: map[string]interface{}{
+					"vaccine": "moderna",
+				},
+			},
+		}, "providersAndAppointments"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+
+	for _, sortBy := range []string{"distance", "earliest"} {
+
+		params := &services.GetAppointmentsByZipCodeParams{
+			ZipCode: "10707",
+			Radius:  20,
+			From:    af.TS("2022-10-01T00:00:00Z"),
+			To:      af.TS("2022-10-02T00:00:00Z"),
+			SortBy:  sortBy,
+			Limit:   10,
+		}
+
+		seen := map[string]bool{}
+		providers := map[string]bool{}
+		pages := 0
+
+		for {
+
+			results, cursor := getAppointmentsByZipCode(t, client, params)
+			pages++
+
+			for _, providerAppointments := range results {
+				providers[string(providerAppointments.Provider.ID)] = true
+				if len(providerAppointments.Appointments) > 10 {
+					t.Fatalf("expected at most 10 appointments per provider")
+				}
+				for _, appointment := range providerAppointments.Appointments {
+					if seen[string(appointment.Data.ID)] {
+						t.Fatalf("appointment returned twice")
+					}
+					seen[string(appointment.Data.ID)] = true
+				}
+			}
+
+			if cursor == "" {
+				break
+			}
+
+			if pages > 100 {
+				t.Fatalf("pagination does not terminate")
+			}
+
+			params.Cursor = cursor
+		}
+
+		if len(providers) != 12 || len(seen) != 12*15 {
+			t.Fatalf("expected 12 providers with 180 appointments, got %d and %d", len(providers), len(seen))
+		}
+	}
+
+	params := &services.GetAppointmentsByZipCodeParams{
+		ZipCode: "10707",
+		Radius:  20,
+		From:    af.TS("2022-10-01T00:00:00Z"),
+		To:      af.TS("2022-10-02T00:00:00Z"),
+	}
+
+	// clients that do not ask for paging get the first page as a plain list
+	if results, _ := getAppointmentsByZipCode(t, client, params); len(results) != 1 || len(results[0].Appointments) != 10 {
+		t.Fatalf("expected the first page as a list")
+	}
+
+	params.Limit = 10
+
+	_, cursor := getAppointmentsByZipCode(t, client, params)
+
+	if cursor == "" {
+		t.Fatalf("expected a cursor")
+	}
+
+	for _, testCase := range []struct {
+		name   string
+		cursor string
+		radius int64
+	}{
+		{"tampered cursor", "x" + cursor[1:], 20},
+		{"changed query", cursor, 30},
+	} {
+		params.Cursor = testCase.cursor
+		params.Radius = testCase.radius
+		if resp, err := client.Appointments.GetAppointmentsByZipCode(params); err != nil {
+			t.Fatal(err)
+		} else if resp.StatusCode != 400 {
+			t.Fatalf("%s: expected a 400 status code, got %d", testCase.name, resp.StatusCode)
+		}
+	}
+}
+
+func TestGetAppointmentsByZipCodeCursorStability(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		// more appointments than fit on a single page
+		at.FC{af.Appointments{
+			N:        15,
+			Start:    af.TS("2022-10-01T08:00:00Z"),
+			Duration: 30,
+			Slots:    1,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+
+	params := &services.GetAppointmentsByZipCodeParams{
+		ZipCode: "10707",
+		Radius:  20,
+		From:    af.TS("2022-10-01T00:00:00Z"),
+		To:      af.TS("2022-10-02T00:00:00Z"),
+		Limit:   10,
+	}
+
+	results, cursor := getAppointmentsByZipCode(t, client, params)
+
+	if cursor == "" || len(results) != 1 {
+		t.Fatalf("expected a partial first page")
+	}
+
+	seen := map[string]bool{}
+
+	for _, appointment := range results[0].Appointments {
+		seen[string(appointment.Data.ID)] = true
+	}
+
+	// the provider publishes an appointment before all others
+	appointment, err := services.MakeAppointment(af.TS("2022-10-01T07:00:00Z"), 1, 30)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appointment.PublicKey = provider.Actor.EncryptionKey.PublicKey
+	appointment.Properties = map[string]interface{}{"vaccine": "moderna"}
+
+	signedAppointment, err := appointment.Sign(provider.Actor.SigningKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, err := client.Appointments.PublishAppointments(&services.PublishAppointmentsParams{
+		Timestamp:    time.Now(),
+		Appointments: []*services.SignedAppointment{signedAppointment},
+	}, provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	// the next page continues after the last returned appointment
+	params.Cursor = cursor
+	results, cursor = getAppointmentsByZipCode(t, client, params)
+
+	if cursor != "" || len(results) != 1 {
+		t.Fatalf("expected a single last page")
+	}
+
+	for _, appointment := range results[0].Appointments {
+		if seen[string(appointment.Data.ID)] {
+			t.Fatalf("appointment returned twice")
+		}
+		seen[string(appointment.Data.ID)] = true
+	}
+
+	if len(seen) != 15 {
+		t.Fatalf("expected 15 appointments, got %d", len(seen))
+	}
+}
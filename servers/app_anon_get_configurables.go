@@ -25,6 +25,11 @@ import (
 // return all public keys present in the system
 func (c *Appointments) getConfigurables(context services.Context, params *services.GetConfigurablesParams) services.Response {
 
-	return context.Result(c.settings.Validate)
+	validateSettings := *c.settings.Validate
+	// we always publish the property schema, even if it's derived from the
+	// list of vaccines
+	validateSettings.Properties = validateSettings.PropertySchemas()
+
+	return context.Result(&validateSettings)
 }
 
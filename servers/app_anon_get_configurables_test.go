@@ -0,0 +1,87 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+)
+
+func TestGetConfigurables(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+
+	resp, err := client.Appointments.GetConfigurables()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Result *services.ValidateSettings `json:"result"`
+	}
+
+	if data, err := resp.Bytes(); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	properties := map[string]*services.PropertySchema{}
+
+	for _, property := range result.Result.Properties {
+		properties[property.Name] = property
+	}
+
+	if vaccine, ok := properties["vaccine"]; !ok || vaccine.Type != "enum" || !vaccine.Required || len(vaccine.Values) == 0 {
+		t.Fatalf("expected a required vaccine enum property")
+	}
+
+	if minAge, ok := properties["minAge"]; !ok || minAge.Type != "integer" || minAge.Max == nil || *minAge.Max != 120 {
+		t.Fatalf("expected an integer minAge property")
+	}
+}
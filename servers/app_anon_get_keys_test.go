@@ -0,0 +1,184 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	"github.com/kiebitz-oss/services/servers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func getKeys(t *testing.T, client *helpers.Client) *services.Keys {
+
+	resp, err := client.Appointments.GetKeys()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result struct {
+		Result *services.Keys `json:"result"`
+	}
+
+	if data, err := resp.Bytes(); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	return result.Result
+}
+
+func keyStatus(keys *services.Keys, publicKey []byte) string {
+	for _, version := range keys.Versions {
+		if bytes.Equal(version.PublicKey, publicKey) {
+			return version.Status
+		}
+	}
+	return ""
+}
+
+func TestTokenKeyRotation(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a user (with a token signed by the current token key)
+		at.FC{af.User{}, "user"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := fixtures["settings"].(*services.Settings)
+	client := fixtures["client"].(*helpers.Client)
+	user := fixtures["user"].(*helpers.User)
+
+	oldKey := settings.Appointments.Key("token")
+
+	if keys := getKeys(t, client); keyStatus(keys, oldKey.PublicKey) != services.KeyCurrent {
+		t.Fatalf("expected the token key to be current")
+	}
+
+	// we add a new version of the token key
+	newKey, err := crypto.GenerateWebKey("token", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validFrom := time.Now().Add(-time.Second)
+	newKey.ValidFrom = &validFrom
+
+	settings.Appointments.Keys = append(settings.Appointments.Keys, newKey)
+
+	keys := getKeys(t, client)
+
+	if !bytes.Equal(keys.TokenKey, newKey.PublicKey) {
+		t.Fatalf("expected the new token key to be used")
+	}
+
+	if keyStatus(keys, newKey.PublicKey) != services.KeyCurrent || keyStatus(keys, oldKey.PublicKey) != services.KeyValid {
+		t.Fatalf("expected the new key to be current and the old key to be valid")
+	}
+
+	// tokens signed with the old key are still accepted
+	if resp, err := client.Appointments.GetBookedAppointments(user); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 0 {
+		t.Fatalf("expected no error, got %d", code)
+	}
+
+	// new tokens are signed with the new key
+	newUser := &helpers.User{}
+
+	if newUser.Actor, err = crypto.MakeActor("user"); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, err := client.Appointments.GetToken(newUser); err != nil {
+		t.Fatal(err)
+	} else {
+
+		var result struct {
+			Result *crypto.SignedStringData `json:"result"`
+		}
+
+		if data, err := resp.Bytes(); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal(data, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		if ok, err := newKey.VerifyString(result.Result); err != nil || !ok {
+			t.Fatalf("expected the token to be signed with the new key")
+		}
+	}
+
+	// we retire the old key
+	validUntil := time.Now()
+	oldKey.ValidUntil = &validUntil
+
+	if keys := getKeys(t, client); keyStatus(keys, oldKey.PublicKey) != services.KeyRetired {
+		t.Fatalf("expected the old key to be retired")
+	}
+
+	if resp, err := client.Appointments.GetBookedAppointments(user); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 400 {
+		t.Fatalf("expected a 400 error, got %d", code)
+	}
+
+	// without any valid token key the keys cannot be returned
+	newKey.ValidUntil = &validUntil
+
+	if resp, err := client.Appointments.GetKeys(); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != -32603 {
+		t.Fatalf("expected an internal error, got %d", code)
+	}
+
+	// and the server does not start
+	if appointments, err := servers.MakeAppointments(settings); err != nil {
+		t.Fatal(err)
+	} else if err := appointments.Start(); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+}
@@ -19,8 +19,8 @@
 package servers
 
 import (
+	"bytes"
 	"github.com/kiebitz-oss/services"
-	"github.com/kiebitz-oss/services/crypto"
 	"github.com/kiebitz-oss/services/databases"
 )
 
@@ -28,8 +28,20 @@ func (c *Appointments) getProvidersByZipCode(
 	context services.Context,
 	params *services.GetProvidersByZipCodeParams) services.Response {
 
-	// get all provider keys
-	providerKeys, err := c.backend.Keys("providers").GetAll()
+	// the cursor is bound to the query without the cursor itself
+	query := *params
+	query.Cursor = ""
+
+	position, err := c.decodeCursor("getProvidersByZipCode", &query, params.Cursor)
+
+	if err != nil {
+		return context.Error(400, "invalid cursor", nil)
+	}
+
+	providersByZipCode := c.backend.ProvidersByZipCode()
+
+	// get all zip codes that have providers
+	zipCodes, err := providersByZipCode.ZipCodes()
 	if err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
@@ -40,39 +52,70 @@ func (c *Appointments) getProvidersByZipCode(
 
 	providers := []*services.SignedProviderData{}
 
-	for _, providerKey := range providerKeys {
+	var nextPosition, lastPosition *cursorPosition
 
-		if int64(len(providers)) >= c.settings.ResponseMaxProvider {
-			break
-		}
+	limit := pageSize(params.Limit, c.settings.ResponseMaxProvider)
 
-		pkd, err := providerKey.ProviderKeyData()
-		if pkd.QueueData.ZipCode < params.ZipFrom || pkd.QueueData.ZipCode > params.ZipTo {
+getProviders:
+	for _, zipCode := range zipCodes {
+
+		if zipCode < params.ZipFrom || zipCode > params.ZipTo || zipCode < position.ZipCode {
 			continue
 		}
 
-		// the provider "ID" is the hash of the signing key
-		providerID := crypto.Hash(pkd.Signing)
+		providerIDs, err := providersByZipCode.Get(zipCode)
+		if err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+
+		for _, providerID := range providerIDs {
 
-		// fetch the full public data of the provider
-		providerData, err := publicProviderData.Get(providerID)
+			// we skip providers that were returned on a previous page
+			if zipCode == position.ZipCode && bytes.Compare(providerID, position.After) <= 0 {
+				continue
+			}
 
-		if err != nil {
-			if err != databases.NotFound {
+			// suspended providers are hidden from users
+			if suspended, err := c.backend.SuspendedProviders().Has(providerID); err != nil {
 				services.Log.Error(err)
+				return context.InternalError()
+			} else if suspended {
+				continue
 			}
-			services.Log.Warning("provider data not found")
-			continue
+
+			// fetch the full public data of the provider
+			providerData, err := publicProviderData.Get(providerID)
+
+			if err != nil {
+				if err != databases.NotFound {
+					services.Log.Error(err)
+				}
+				services.Log.Warning("provider data not found")
+				continue
+			}
+
+			if int64(len(providers)) >= limit {
+				nextPosition = lastPosition
+				break getProviders
+			}
+
+			// we add the hash for convenience
+			providerData.ID = providerID
+
+			providers = append(providers, providerData)
+			lastPosition = &cursorPosition{ZipCode: zipCode, After: providerID}
 		}
 
-		// we add the hash for convenience
-		providerData.ID = providerID
+	}
 
-		providers = append(providers, providerData)
+	cursor, err := c.encodeCursor("getProvidersByZipCode", &query, nextPosition)
 
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
 	}
 
-	return context.Result(providers)
+	return context.Result(pageResult(params.Limit > 0 || params.Cursor != "", providers, cursor))
 
 }
-
@@ -0,0 +1,251 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	"github.com/kiebitz-oss/services/servers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+)
+
+func TestGetProvidersByZipCode(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{LogLevel: services.InfoLogLevel, Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		at.FC{af.ProvidersAndAppointments{
+			Providers: 3,
+			BaseProvider: af.Provider{
+				ZipCode:   "10707",
+				StoreData: true,
+				Confirm:   true,
+			},
+			BaseAppointments: af.Appointments{
+				N:        5,
+				Start:    af.TS("2022-10-01T12:00:00Z"),
+				Duration: 30,
+				Slots:    5,
+				Properties: map[string]interface{}{
+					"vaccine": "moderna",
+				},
+			},
+		}, "providersAndAppointments"},
+
+		at.FC{af.ProvidersAndAppointments{
+			Providers: 2,
+			BaseProvider: af.Provider{
+				ZipCode:   "80331",
+				StoreData: true,
+				Confirm:   true,
+			},
+			BaseAppointments: af.Appointments{
+				N:        5,
+				Start:    af.TS("2022-10-01T12:00:00Z"),
+				Duration: 30,
+				Slots:    5,
+				Properties: map[string]interface{}{
+					"vaccine": "moderna",
+				},
+			},
+		}, "otherProvidersAndAppointments"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+
+	for _, testCase := range []struct {
+		zipFrom, zipTo string
+		n              int
+	}{
+		{"10000", "19999", 3},
+		{"80331", "80331", 2},
+		{"10000", "99999", 5},
+		{"20000", "79999", 0},
+	} {
+
+		resp, err := client.Appointments.GetProvidersByZipCode(&services.GetProvidersByZipCodeParams{
+			ZipFrom: testCase.zipFrom,
+			ZipTo:   testCase.zipTo,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != 200 {
+			t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+		}
+
+		var result struct {
+			Result []*services.SignedProviderData `json:"result"`
+		}
+
+		if bytes, err := resp.Bytes(); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal(bytes, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result.Result) != testCase.n {
+			t.Fatalf("expected %d providers between %s and %s, got %d", testCase.n, testCase.zipFrom, testCase.zipTo, len(result.Result))
+		}
+	}
+
+	resp, err := client.Appointments.GetAppointmentsByZipCode(&services.GetAppointmentsByZipCodeParams{
+		ZipCode: "10707",
+		Radius:  20,
+		From:    af.TS("2022-10-01T00:00:00Z"),
+		To:      af.TS("2022-10-02T00:00:00Z"),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result struct {
+		Result []*services.ProviderAppointments `json:"result"`
+	}
+
+	if bytes, err := resp.Bytes(); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(bytes, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	// providers in other zip codes should not show up
+	if len(result.Result) != 3 {
+		t.Fatalf("expected 3 providers, got %d", len(result.Result))
+	}
+
+	for _, providerAppointments := range result.Result {
+		if len(providerAppointments.Appointments) != 5 {
+			t.Fatalf("expected 5 appointments, got %d", len(providerAppointments.Appointments))
+		}
+	}
+
+}
+
+func TestReindex(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		// we create some appointments
+		at.FC{af.Appointments{
+			N:        5,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    5,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := fixtures["settings"].(*services.Settings)
+	server := fixtures["appointmentsServer"].(*servers.Appointments)
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	providerID := crypto.Hash(provider.Actor.SigningKey.PublicKey)
+
+	params := &services.GetAppointmentsByZipCodeParams{
+		ZipCode: "10707",
+		Radius:  20,
+		From:    af.TS("2022-10-01T00:00:00Z"),
+		To:      af.TS("2022-10-02T00:00:00Z"),
+	}
+
+	// we pretend that the data was stored before the indexes existed
+	for _, index := range []struct {
+		table string
+		key   []byte
+	}{
+		{"providerZipCodes", []byte("all")},
+		{"providerZipCodes", []byte("byID")},
+		{"providersByZipCode", []byte("10707")},
+		{"appointmentDates", providerID},
+	} {
+		if err := settings.DatabaseObj.Expire(index.table, index.key, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if results, _ := getAppointmentsByZipCode(t, client, params); len(results) != 0 {
+		t.Fatalf("expected no providers without the indexes, got %d", len(results))
+	}
+
+	if err := server.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+
+	if results, _ := getAppointmentsByZipCode(t, client, params); len(results) != 1 {
+		t.Fatalf("expected one provider, got %d", len(results))
+	} else if len(results[0].Appointments) != 5 {
+		t.Fatalf("expected 5 appointments, got %d", len(results[0].Appointments))
+	}
+
+}
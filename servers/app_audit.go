@@ -0,0 +1,48 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"time"
+)
+
+// Records a privileged operation in the audit log, along with the signed
+// request data and the IDs of the affected providers or mediators. This is
+// called before the operation is carried out, so that no operation can take
+// place without being recorded (an entry might however belong to a request
+// that failed afterwards).
+func (c *Appointments) audit(endpoint string, publicKey []byte, data string, signature []byte, timestamp time.Time, ids ...[]byte) error {
+
+	if lock, err := c.backend.LockAuditLog(); err != nil {
+		return err
+	} else {
+		defer release(lock)
+	}
+
+	return c.backend.AuditLog().Append(&services.AuditEntry{
+		Endpoint:  endpoint,
+		PublicKey: publicKey,
+		Data:      data,
+		Signature: signature,
+		Timestamp: timestamp,
+		IDs:       ids,
+		CreatedAt: time.Now().UTC(),
+	})
+}
@@ -19,10 +19,15 @@
 package servers
 
 import (
+	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
 	"github.com/kiebitz-oss/services/forms"
+	"sort"
+	"strconv"
 	"time"
 )
 
@@ -97,12 +102,136 @@ func (a *AppointmentsBackend) AppointmentDatesByID(providerID []byte) *Appointme
 	}
 }
 
+// Returns the date-sorted appointment index of the given provider, which
+// allows us to look up the dates in a given time window without fetching
+// all appointments of the provider.
+func (a *AppointmentsBackend) AppointmentDates(providerID []byte) *AppointmentDates {
+	return &AppointmentDates{
+		providerID: providerID,
+		db:         a.db,
+		dates:      a.db.SortedSet("appointmentDates", providerID),
+	}
+}
+
+// Returns the index of confirmed providers by zip code, which allows us to
+// find providers in a given area without decoding all provider keys.
+func (a *AppointmentsBackend) ProvidersByZipCode() *ProvidersByZipCode {
+	return &ProvidersByZipCode{
+		db:       a.db,
+		zipCodes: a.db.Set("providerZipCodes", []byte("all")),
+		byID:     a.db.Map("providerZipCodes", []byte("byID")),
+	}
+}
+
+// Returns the waitlist of the given provider, which contains users that
+// want to be booked into the next free slot in a given time window.
+func (a *AppointmentsBackend) Waitlist(providerID []byte) *Waitlist {
+	return &Waitlist{
+		providerID: providerID,
+		db:         a.db,
+		queue:      a.db.SortedSet("waitlist", providerID),
+		entries:    a.db.Map("waitlistEntries", providerID),
+	}
+}
+
+// Returns the appointment series of the given provider.
+func (a *AppointmentsBackend) AppointmentSeries(providerID []byte) *AppointmentSeries {
+	return &AppointmentSeries{
+		providerID: providerID,
+		db:         a.db,
+		dbs:        a.db.Map("appointmentSeries", providerID),
+	}
+}
+
+// Returns the appointments generated from the given series, indexed by the
+// time of their occurrence.
+func (a *AppointmentsBackend) AppointmentSeriesOccurrences(providerID, seriesID []byte) *AppointmentSeriesOccurrences {
+	key := make([]byte, 0, len(providerID)+len(seriesID))
+	key = append(append(key, providerID...), seriesID...)
+	return &AppointmentSeriesOccurrences{
+		key: key,
+		db:  a.db,
+		dbs: a.db.Map("appointmentSeriesOccurrences", key),
+	}
+}
+
+// Returns the index of bookings made with the given token, which allows
+// users to look up their bookings.
+func (a *AppointmentsBackend) BookedAppointments(token []byte) *BookedAppointments {
+	return &BookedAppointments{
+		token: token,
+		db:    a.db,
+		dbs:   a.db.Map("bookedAppointments", token),
+	}
+}
+
+// Returns the cancellations of bookings made with the given token, which
+// allows users to learn why their booking has been cancelled.
+func (a *AppointmentsBackend) BookingCancellations(token []byte) *BookingCancellations {
+	return &BookingCancellations{
+		token:  token,
+		db:     a.db,
+		dbs:    a.db.Map("bookingCancellations", token),
+		tokens: a.db.SortedSet("cancelledTokens", []byte("all")),
+	}
+}
+
+// Returns the tokens that have booking cancellations from before the given
+// time, which allows us to remove expired cancellations.
+func (a *AppointmentsBackend) CancelledTokens(before time.Time) ([][]byte, error) {
+	entries, err := a.db.SortedSet("cancelledTokens", []byte("all")).RangeByScore(0, before.Unix())
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([][]byte, len(entries))
+	for i, entry := range entries {
+		tokens[i] = entry.Data
+	}
+	return tokens, nil
+}
+
+// Returns the set of suspended providers, which are hidden from users and
+// can't publish appointments until a mediator reactivates them.
+func (a *AppointmentsBackend) SuspendedProviders() *SuspendedProviders {
+	return &SuspendedProviders{
+		dbs: a.db.Set("providerStatus", []byte("suspended")),
+	}
+}
+
 func (a *AppointmentsBackend) UsedTokens() *UsedTokens {
 	return &UsedTokens{
-		dbs: a.db.Set("bookings", []byte("tokens")),
+		dbs:   a.db.Set("bookings", []byte("tokens")),
+		usage: a.db.SortedSet("bookings", []byte("tokenUsage")),
+	}
+}
+
+// Locks all appointments of the given provider. The lock needs to be held
+// while reading and modifying appointments or their bookings, as otherwise
+// concurrent requests might e.g. book the same slot twice.
+func (a *AppointmentsBackend) LockProvider(providerID []byte) (services.Lock, error) {
+	return a.db.Lock(fmt.Sprintf("lock::provider::%s", hex.EncodeToString(providerID)))
+}
+
+// Returns the audit log, which records privileged operations.
+func (a *AppointmentsBackend) AuditLog() *AuditLog {
+	return &AuditLog{
+		head:    a.db.Value("audit", []byte("head")),
+		entries: a.db.Map("audit", []byte("entries")),
 	}
 }
 
+// Locks the given user token, which ensures a token can't be used for
+// several bookings at the same time.
+func (a *AppointmentsBackend) LockToken(token []byte) (services.Lock, error) {
+	return a.db.Lock(fmt.Sprintf("lock::token::%s", hex.EncodeToString(token)))
+}
+
+// Locks the audit log. The lock needs to be held while appending entries, as
+// otherwise concurrent requests might fork the chain.
+func (a *AppointmentsBackend) LockAuditLog() (services.Lock, error) {
+	return a.db.Lock("lock::audit")
+}
+
 type PriorityToken struct {
 	token services.Integer
 }
@@ -123,6 +252,10 @@ func (n *Neighbors) Range(from, to int64) ([]*services.SortedSetEntry, error) {
 	return n.neighbors.Range(from, to)
 }
 
+func (n *Neighbors) RangeByScore(from, to int64) ([]*services.SortedSetEntry, error) {
+	return n.neighbors.RangeByScore(from, to)
+}
+
 type Keys struct {
 	keys services.Map
 }
@@ -135,6 +268,10 @@ func (k *Keys) Set(id []byte, key *services.ActorKey) error {
 	}
 }
 
+func (k *Keys) Del(id []byte) error {
+	return k.keys.Del(id)
+}
+
 func (k *Keys) Get(id []byte) (*services.ActorKey, error) {
 	if mk, err := k.keys.Get(id); err != nil {
 		return nil, err
@@ -143,6 +280,7 @@ func (k *Keys) Get(id []byte) (*services.ActorKey, error) {
 		if err := json.Unmarshal(mk, &key); err != nil {
 			return nil, err
 		} else {
+			key.ID = id
 			return key, nil
 		}
 	}
@@ -227,6 +365,10 @@ func (c *ConfirmedProviderData) Get(providerID []byte) (*services.ConfirmedProvi
 	}
 }
 
+func (c *ConfirmedProviderData) Del(providerID []byte) error {
+	return c.dbs.Del(providerID)
+}
+
 type RawProviderData struct {
 	dbs services.Map
 }
@@ -285,9 +427,14 @@ func (c *RawProviderData) GetAll() (map[string]*services.RawProviderData, error)
 
 type UsedTokens struct {
 	dbs services.Set
+	// the time each token has been used, which allows us to prune them
+	usage services.SortedSet
 }
 
 func (t *UsedTokens) Del(token []byte) error {
+	if _, err := t.usage.Del(token); err != nil {
+		return err
+	}
 	return t.dbs.Del(token)
 }
 
@@ -296,9 +443,64 @@ func (t *UsedTokens) Has(token []byte) (bool, error) {
 }
 
 func (t *UsedTokens) Add(token []byte) error {
+	if err := t.usage.Add(token, time.Now().Unix()); err != nil {
+		return err
+	}
 	return t.dbs.Add(token)
 }
 
+// Removes all tokens that have been used before the given time and for which
+// keep returns false, and returns their number. Tokens that were used before
+// we started to record the time of use are treated as if they had been used
+// now.
+func (t *UsedTokens) Prune(before time.Time, keep func(token []byte) (bool, error)) (int64, error) {
+	members, err := t.dbs.Members()
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, member := range members {
+		usedAt, err := t.usage.Score(member.Data)
+		if err == databases.NotFound {
+			if err := t.usage.Add(member.Data, time.Now().Unix()); err != nil {
+				return n, err
+			}
+			continue
+		} else if err != nil {
+			return n, err
+		}
+		if usedAt >= before.Unix() {
+			continue
+		}
+		if ok, err := keep(member.Data); err != nil {
+			return n, err
+		} else if ok {
+			continue
+		}
+		if err := t.Del(member.Data); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+type SuspendedProviders struct {
+	dbs services.Set
+}
+
+func (s *SuspendedProviders) Has(providerID []byte) (bool, error) {
+	return s.dbs.Has(providerID)
+}
+
+func (s *SuspendedProviders) Add(providerID []byte) error {
+	return s.dbs.Add(providerID)
+}
+
+func (s *SuspendedProviders) Del(providerID []byte) error {
+	return s.dbs.Del(providerID)
+}
+
 type AppointmentDatesByID struct {
 	providerID []byte
 	dbs        services.Map
@@ -329,6 +531,476 @@ func (a *AppointmentDatesByID) Del(id []byte) error {
 	return a.dbs.Del(id)
 }
 
+// Removes the index entirely
+func (a *AppointmentDatesByID) Clear() error {
+	return a.db.Expire("appointmentDatesByID", a.providerID, 0)
+}
+
+type AppointmentDates struct {
+	providerID []byte
+	dates      services.SortedSet
+	db         services.Database
+}
+
+// Adds the given date (in 2006-01-02 format) to the index
+func (a *AppointmentDates) Add(date string) error {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return err
+	}
+	// like the ID map the index will auto-delete after one year
+	if err := a.db.Expire("appointmentDates", a.providerID, time.Hour*24*365); err != nil {
+		return err
+	}
+	return a.dates.Add([]byte(date), t.Unix())
+}
+
+func (a *AppointmentDates) Del(date string) error {
+	_, err := a.dates.Del([]byte(date))
+	return err
+}
+
+// Removes the index entirely
+func (a *AppointmentDates) Clear() error {
+	return a.db.Expire("appointmentDates", a.providerID, 0)
+}
+
+// Returns all dates between from and to (inclusive) in ascending order
+func (a *AppointmentDates) Range(from, to time.Time) ([]string, error) {
+	entries, err := a.dates.RangeByScore(from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	dates := make([]string, len(entries))
+	for i, entry := range entries {
+		dates[i] = string(entry.Data)
+	}
+	return dates, nil
+}
+
+type ProvidersByZipCode struct {
+	db       services.Database
+	zipCodes services.Set
+	byID     services.Map
+}
+
+func (p *ProvidersByZipCode) providers(zipCode string) services.Set {
+	return p.db.Set("providersByZipCode", []byte(zipCode))
+}
+
+// Adds the provider to the index, removing it from the index of its previous
+// zip code if that has changed.
+func (p *ProvidersByZipCode) Add(providerID []byte, zipCode string) error {
+	if oldZipCode, err := p.byID.Get(providerID); err == nil {
+		if string(oldZipCode) == zipCode {
+			return nil
+		}
+		if err := p.Del(providerID); err != nil {
+			return err
+		}
+	} else if err != databases.NotFound {
+		return err
+	}
+	if err := p.providers(zipCode).Add(providerID); err != nil {
+		return err
+	}
+	if err := p.zipCodes.Add([]byte(zipCode)); err != nil {
+		return err
+	}
+	return p.byID.Set(providerID, []byte(zipCode))
+}
+
+// Removes the provider from the index
+func (p *ProvidersByZipCode) Del(providerID []byte) error {
+	zipCode, err := p.byID.Get(providerID)
+	if err != nil {
+		if err == databases.NotFound {
+			return nil
+		}
+		return err
+	}
+	providers := p.providers(string(zipCode))
+	if err := providers.Del(providerID); err != nil {
+		return err
+	}
+	if members, err := providers.Members(); err != nil {
+		return err
+	} else if len(members) == 0 {
+		// no providers left in this zip code
+		if err := p.zipCodes.Del(zipCode); err != nil {
+			return err
+		}
+	}
+	return p.byID.Del(providerID)
+}
+
+// Returns the IDs of all providers with the given zip code, in ascending order
+func (p *ProvidersByZipCode) Get(zipCode string) ([][]byte, error) {
+	members, err := p.providers(zipCode).Members()
+	if err != nil {
+		return nil, err
+	}
+	providerIDs := make([][]byte, len(members))
+	for i, member := range members {
+		providerIDs[i] = member.Data
+	}
+	// sets are unordered, so we sort the IDs to make paging stable
+	sort.Slice(providerIDs, func(i, j int) bool {
+		return bytes.Compare(providerIDs[i], providerIDs[j]) < 0
+	})
+	return providerIDs, nil
+}
+
+// Returns all zip codes that have at least one provider, in ascending order
+func (p *ProvidersByZipCode) ZipCodes() ([]string, error) {
+	members, err := p.zipCodes.Members()
+	if err != nil {
+		return nil, err
+	}
+	zipCodes := make([]string, len(members))
+	for i, member := range members {
+		zipCodes[i] = string(member.Data)
+	}
+	sort.Strings(zipCodes)
+	return zipCodes, nil
+}
+
+type Waitlist struct {
+	providerID []byte
+	db         services.Database
+	queue      services.SortedSet
+	entries    services.Map
+}
+
+// Adds the entry to the waitlist, using the priority of the token as score
+func (w *Waitlist) Add(entry *services.WaitlistEntry) error {
+	// the waitlist will auto-delete after one year (purely for storage reasons)
+	for _, table := range []string{"waitlist", "waitlistEntries"} {
+		if err := w.db.Expire(table, w.providerID, time.Hour*24*365); err != nil {
+			return err
+		}
+	}
+	if err := w.Set(entry); err != nil {
+		return err
+	}
+	return w.queue.Add(entry.Token, entry.N)
+}
+
+// Updates the entry without changing its position in the waitlist
+func (w *Waitlist) Set(entry *services.WaitlistEntry) error {
+	if data, err := json.Marshal(entry); err != nil {
+		return err
+	} else {
+		return w.entries.Set(entry.Token, data)
+	}
+}
+
+func (w *Waitlist) Get(token []byte) (*services.WaitlistEntry, error) {
+	if data, err := w.entries.Get(token); err != nil {
+		return nil, err
+	} else {
+		var entry *services.WaitlistEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, err
+		}
+		return entry, nil
+	}
+}
+
+// Removes the entry from the queue while keeping it around, so that users
+// can still see which appointment they have been booked into
+func (w *Waitlist) Dequeue(token []byte) error {
+	_, err := w.queue.Del(token)
+	return err
+}
+
+// Removes the entry entirely
+func (w *Waitlist) Del(token []byte) error {
+	if err := w.Dequeue(token); err != nil {
+		return err
+	}
+	return w.entries.Del(token)
+}
+
+// Removes all entries of the waitlist
+func (w *Waitlist) Clear() error {
+	for _, table := range []string{"waitlist", "waitlistEntries"} {
+		if err := w.db.Expire(table, w.providerID, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the position of the given token in the queue (starting at 1)
+func (w *Waitlist) Position(token []byte) (int64, error) {
+	entries, err := w.queue.Range(0, -1)
+	if err != nil {
+		return 0, err
+	}
+	for i, entry := range entries {
+		if bytes.Equal(entry.Data, token) {
+			return int64(i + 1), nil
+		}
+	}
+	return 0, databases.NotFound
+}
+
+// Returns all entries, including those that have already been assigned a slot
+func (w *Waitlist) GetAll() ([]*services.WaitlistEntry, error) {
+	dataMap, err := w.entries.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*services.WaitlistEntry, 0, len(dataMap))
+	for _, data := range dataMap {
+		var entry *services.WaitlistEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Returns all waiting entries, in order of their priority
+func (w *Waitlist) Waiting() ([]*services.WaitlistEntry, error) {
+	queueEntries, err := w.queue.Range(0, -1)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*services.WaitlistEntry, 0, len(queueEntries))
+	for _, queueEntry := range queueEntries {
+		if entry, err := w.Get(queueEntry.Data); err != nil {
+			if err == databases.NotFound {
+				continue
+			}
+			return nil, err
+		} else {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+type AppointmentSeries struct {
+	providerID []byte
+	db         services.Database
+	dbs        services.Map
+}
+
+func (a *AppointmentSeries) Set(series *services.AppointmentSeries) error {
+	// series will auto-delete after one year (purely for storage reasons)
+	if err := a.db.Expire("appointmentSeries", a.providerID, time.Hour*24*365); err != nil {
+		return err
+	}
+	if data, err := json.Marshal(series); err != nil {
+		return err
+	} else {
+		return a.dbs.Set(series.ID, data)
+	}
+}
+
+func (a *AppointmentSeries) Get(id []byte) (*services.AppointmentSeries, error) {
+	if data, err := a.dbs.Get(id); err != nil {
+		return nil, err
+	} else {
+		var series *services.AppointmentSeries
+		if err := json.Unmarshal(data, &series); err != nil {
+			return nil, err
+		}
+		return series, nil
+	}
+}
+
+func (a *AppointmentSeries) Del(id []byte) error {
+	return a.dbs.Del(id)
+}
+
+// Removes all series of the provider
+func (a *AppointmentSeries) Clear() error {
+	return a.db.Expire("appointmentSeries", a.providerID, 0)
+}
+
+// Returns all series, ordered by their start
+func (a *AppointmentSeries) GetAll() ([]*services.AppointmentSeries, error) {
+	dataMap, err := a.dbs.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	allSeries := make([]*services.AppointmentSeries, 0, len(dataMap))
+	for _, data := range dataMap {
+		var series *services.AppointmentSeries
+		if err := json.Unmarshal(data, &series); err != nil {
+			return nil, err
+		}
+		allSeries = append(allSeries, series)
+	}
+	sort.Slice(allSeries, func(i, j int) bool {
+		return allSeries[i].Start.Before(allSeries[j].Start)
+	})
+	return allSeries, nil
+}
+
+type AppointmentSeriesOccurrences struct {
+	key []byte
+	db  services.Database
+	dbs services.Map
+}
+
+func (a *AppointmentSeriesOccurrences) occurrenceKey(timestamp time.Time) []byte {
+	return []byte(strconv.FormatInt(timestamp.Unix(), 10))
+}
+
+func (a *AppointmentSeriesOccurrences) Set(timestamp time.Time, appointmentID []byte) error {
+	// like the series itself the index will auto-delete after one year
+	if err := a.db.Expire("appointmentSeriesOccurrences", a.key, time.Hour*24*365); err != nil {
+		return err
+	}
+	return a.dbs.Set(a.occurrenceKey(timestamp), appointmentID)
+}
+
+func (a *AppointmentSeriesOccurrences) Del(timestamp time.Time) error {
+	return a.dbs.Del(a.occurrenceKey(timestamp))
+}
+
+// Removes the index entirely
+func (a *AppointmentSeriesOccurrences) Clear() error {
+	return a.db.Expire("appointmentSeriesOccurrences", a.key, 0)
+}
+
+// Returns the IDs of all generated appointments by their time
+func (a *AppointmentSeriesOccurrences) GetAll() (map[time.Time][]byte, error) {
+	dataMap, err := a.dbs.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	occurrences := make(map[time.Time][]byte, len(dataMap))
+	for key, id := range dataMap {
+		if unix, err := strconv.ParseInt(key, 10, 64); err != nil {
+			return nil, err
+		} else {
+			occurrences[time.Unix(unix, 0)] = id
+		}
+	}
+	return occurrences, nil
+}
+
+type BookedAppointments struct {
+	token []byte
+	db    services.Database
+	dbs   services.Map
+}
+
+func (b *BookedAppointments) Add(bookedAppointment *services.BookedAppointment) error {
+	// the index will auto-delete after one year (purely for storage reasons)
+	if err := b.db.Expire("bookedAppointments", b.token, time.Hour*24*365); err != nil {
+		return err
+	}
+	if data, err := json.Marshal(bookedAppointment); err != nil {
+		return err
+	} else {
+		return b.dbs.Set(bookedAppointment.SlotID, data)
+	}
+}
+
+func (b *BookedAppointments) Del(slotID []byte) error {
+	return b.dbs.Del(slotID)
+}
+
+// Returns all booked appointments, ordered by their time
+func (b *BookedAppointments) GetAll() ([]*services.BookedAppointment, error) {
+	dataMap, err := b.dbs.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	bookedAppointments := make([]*services.BookedAppointment, 0, len(dataMap))
+	for _, data := range dataMap {
+		var bookedAppointment *services.BookedAppointment
+		if err := json.Unmarshal(data, &bookedAppointment); err != nil {
+			return nil, err
+		}
+		bookedAppointments = append(bookedAppointments, bookedAppointment)
+	}
+	sort.Slice(bookedAppointments, func(i, j int) bool {
+		return bookedAppointments[i].Timestamp.Before(bookedAppointments[j].Timestamp)
+	})
+	return bookedAppointments, nil
+}
+
+type BookingCancellations struct {
+	token []byte
+	db    services.Database
+	dbs   services.Map
+	// the tokens with cancellations, scored by their oldest cancellation
+	tokens services.SortedSet
+}
+
+func (b *BookingCancellations) Add(cancellation *services.BookingCancellation) error {
+	// cancellations will auto-delete after one year (purely for storage reasons)
+	if err := b.db.Expire("bookingCancellations", b.token, time.Hour*24*365); err != nil {
+		return err
+	}
+	if data, err := json.Marshal(cancellation); err != nil {
+		return err
+	} else if err := b.dbs.Set(cancellation.BookingID, data); err != nil {
+		return err
+	}
+	if score, err := b.tokens.Score(b.token); err == nil && score <= cancellation.CancelledAt.Unix() {
+		return nil
+	} else if err != nil && err != databases.NotFound {
+		return err
+	}
+	return b.tokens.Add(b.token, cancellation.CancelledAt.Unix())
+}
+
+// Removes all cancellations from before the given time and returns their number
+func (b *BookingCancellations) Prune(before time.Time) (int64, error) {
+	cancellations, err := b.GetAll()
+	if err != nil && err != databases.NotFound {
+		return 0, err
+	}
+	var n int64
+	var oldest *time.Time
+	for _, cancellation := range cancellations {
+		if !cancellation.CancelledAt.Before(before) {
+			if oldest == nil || cancellation.CancelledAt.Before(*oldest) {
+				oldest = &cancellation.CancelledAt
+			}
+			continue
+		}
+		if err := b.dbs.Del(cancellation.BookingID); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if oldest == nil {
+		_, err := b.tokens.Del(b.token)
+		return n, err
+	}
+	return n, b.tokens.Add(b.token, oldest.Unix())
+}
+
+// Returns all cancellations, the most recent one first
+func (b *BookingCancellations) GetAll() ([]*services.BookingCancellation, error) {
+	dataMap, err := b.dbs.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	cancellations := make([]*services.BookingCancellation, 0, len(dataMap))
+	for _, data := range dataMap {
+		var cancellation *services.BookingCancellation
+		if err := json.Unmarshal(data, &cancellation); err != nil {
+			return nil, err
+		}
+		cancellations = append(cancellations, cancellation)
+	}
+	sort.Slice(cancellations, func(i, j int) bool {
+		return cancellations[i].CancelledAt.After(cancellations[j].CancelledAt)
+	})
+	return cancellations, nil
+}
+
 type PublicProviderData struct {
 	dbs services.Map
 }
@@ -351,6 +1023,10 @@ func (p *PublicProviderData) Set(id []byte, signedProviderData *services.SignedP
 	}
 }
 
+func (p *PublicProviderData) Del(id []byte) error {
+	return p.dbs.Del(id)
+}
+
 type AppointmentsByDate struct {
 	dbs services.Map
 }
@@ -397,3 +1073,98 @@ func (a *AppointmentsByDate) GetAll(validateSettings *services.ValidateSettings)
 		return signedAppointments, nil
 	}
 }
+
+// The last entry of the audit log
+type AuditHead struct {
+	N    int64  `json:"n"`
+	Hash []byte `json:"hash"`
+}
+
+type AuditLog struct {
+	head    services.Value
+	entries services.Map
+}
+
+func (a *AuditLog) entryKey(n int64) []byte {
+	return []byte(strconv.FormatInt(n, 10))
+}
+
+// Returns the last entry of the log, or an empty head if the log is empty
+func (a *AuditLog) Head() (*AuditHead, error) {
+	head := &AuditHead{}
+	if data, err := a.head.Get(); err != nil {
+		if err == databases.NotFound {
+			return head, nil
+		}
+		return nil, err
+	} else if err := json.Unmarshal(data, head); err != nil {
+		return nil, err
+	}
+	return head, nil
+}
+
+func (a *AuditLog) setHead(head *AuditHead) error {
+	if data, err := json.Marshal(head); err != nil {
+		return err
+	} else {
+		return a.head.Set(data, 0)
+	}
+}
+
+func (a *AuditLog) setEntry(entry *services.AuditEntry) error {
+	if data, err := json.Marshal(entry); err != nil {
+		return err
+	} else {
+		return a.entries.Set(a.entryKey(entry.N), data)
+	}
+}
+
+// Restores the given head and entries, which allows us to keep the log when
+// the database is reset
+func (a *AuditLog) Restore(head *AuditHead, entries []*services.AuditEntry) error {
+	for _, entry := range entries {
+		if err := a.setEntry(entry); err != nil {
+			return err
+		}
+	}
+	return a.setHead(head)
+}
+
+// Appends the entry to the log, linking it to the current head. The caller
+// needs to hold the audit log lock.
+func (a *AuditLog) Append(entry *services.AuditEntry) error {
+	head, err := a.Head()
+	if err != nil {
+		return err
+	}
+	entry.N = head.N + 1
+	entry.PrevHash = head.Hash
+	if entry.Hash, err = entry.ComputeHash(); err != nil {
+		return err
+	}
+	if err := a.setEntry(entry); err != nil {
+		return err
+	}
+	return a.setHead(&AuditHead{N: entry.N, Hash: entry.Hash})
+}
+
+// Returns at most limit entries, starting with entry from
+func (a *AuditLog) Range(from, limit int64) ([]*services.AuditEntry, error) {
+	head, err := a.Head()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*services.AuditEntry, 0)
+	for n := from; n <= head.N && int64(len(entries)) < limit; n++ {
+		if data, err := a.entries.Get(a.entryKey(n)); err != nil {
+			return nil, err
+		} else {
+			var entry *services.AuditEntry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
@@ -24,13 +24,15 @@ import (
 	"github.com/kiebitz-oss/services/forms"
 )
 
+// Loads a stored appointment. Its properties have been validated when it was
+// published and are not checked against the current schema again.
 func SignedAppointment(validateSettings *services.ValidateSettings, data []byte) (*services.SignedAppointment, error) {
 	var mapData map[string]interface{}
 	signedAppointment := &services.SignedAppointment{}
 	signedAppointmentForm := &forms.SignedAppointmentForm
 	if err := json.Unmarshal(data, &mapData); err != nil {
 		return nil, err
-	} else if params, err := signedAppointmentForm.ValidateWithContext(mapData, map[string]interface{}{"settings": validateSettings}); err != nil {
+	} else if params, err := signedAppointmentForm.ValidateWithContext(mapData, map[string]interface{}{"settings": validateSettings, "stored": true}); err != nil {
 		return nil, err
 	} else if err := signedAppointmentForm.Coerce(signedAppointment, params); err != nil {
 		return nil, err
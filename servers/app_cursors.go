@@ -0,0 +1,214 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/kiebitz-oss/services"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The position of a cursor in an ordered result list, given by the key of
+// the last returned entry. For the appointment search this is the sort key,
+// zip code and ID of the provider along with the timestamp and ID of the
+// last returned appointment.
+type cursorPosition struct {
+	SortKey     int64      `json:"s,omitempty"`
+	ZipCode     string     `json:"z,omitempty"`
+	After       []byte     `json:"k,omitempty"`
+	Timestamp   *time.Time `json:"t,omitempty"`
+	Appointment []byte     `json:"a,omitempty"`
+}
+
+type cursorData struct {
+	Query    []byte          `json:"q"`
+	Position *cursorPosition `json:"p"`
+}
+
+// Hashes the endpoint name and the query parameters (without the cursor),
+// which ensures a cursor can only be used with the query it was created for.
+func cursorQuery(endpoint string, query interface{}) ([]byte, error) {
+	data, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write([]byte(endpoint))
+	h.Write(data)
+	return h.Sum(nil)[:16], nil
+}
+
+func (c *Appointments) cursorSignature(payload []byte) []byte {
+	h := hmac.New(sha256.New, c.settings.Secret)
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// Creates an opaque cursor for the given position. Cursors are signed with
+// the service secret so that clients can neither forge nor modify them.
+func (c *Appointments) encodeCursor(endpoint string, query interface{}, position *cursorPosition) (string, error) {
+
+	if position == nil {
+		return "", nil
+	}
+
+	queryHash, err := cursorQuery(endpoint, query)
+
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(&cursorData{
+		Query:    queryHash,
+		Position: position,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(c.cursorSignature(payload)), nil
+}
+
+// Returns the position of the given cursor, or the start position if the
+// cursor is empty.
+func (c *Appointments) decodeCursor(endpoint string, query interface{}, cursor string) (*cursorPosition, error) {
+
+	if cursor == "" {
+		return &cursorPosition{}, nil
+	}
+
+	parts := strings.Split(cursor, ".")
+
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal(signature, c.cursorSignature(payload)) {
+		return nil, fmt.Errorf("invalid cursor signature")
+	}
+
+	var data *cursorData
+
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil, err
+	}
+
+	queryHash, err := cursorQuery(endpoint, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(queryHash, data.Query) || data.Position == nil {
+		return nil, fmt.Errorf("cursor does not match the query")
+	}
+
+	return data.Position, nil
+}
+
+// Returns the number of results to put on a page, which is the limit given
+// by the client but never more than the configured maximum.
+func pageSize(limit, max int64) int64 {
+	if limit > 0 && limit < max {
+		return limit
+	}
+	return max
+}
+
+// Clients only get a page (with the cursor for the next page) if they asked
+// for one by sending a limit or cursor. Otherwise we return the bare result
+// list, which is what clients that predate paging expect.
+func pageResult(paged bool, results interface{}, cursor string) interface{} {
+	if !paged {
+		return results
+	}
+	return &services.Page{
+		Results: results,
+		Cursor:  cursor,
+	}
+}
+
+// Returns the raw provider data for the mediator endpoints, ordered by key.
+// If the mediator sent a limit or cursor, only one page of the data is
+// returned, along with the cursor for the next page.
+func (c *Appointments) providerDataPage(endpoint string, providerDataMap map[string]*services.RawProviderData, params *services.GetPendingProviderDataParams) (interface{}, error) {
+
+	// the cursor is bound to the query without the cursor and timestamp
+	query := *params
+	query.Cursor = ""
+	query.Timestamp = time.Time{}
+
+	position, err := c.decodeCursor(endpoint, &query, params.Cursor)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(providerDataMap))
+
+	for key := range providerDataMap {
+		if position.After != nil && key <= string(position.After) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var nextPosition *cursorPosition
+
+	if params.Limit > 0 && int64(len(keys)) > params.Limit {
+		keys = keys[:params.Limit]
+		nextPosition = &cursorPosition{After: []byte(keys[len(keys)-1])}
+	}
+
+	pdEntries := make([]*services.RawProviderData, len(keys))
+
+	for i, key := range keys {
+		pdEntries[i] = providerDataMap[key]
+	}
+
+	cursor, err := c.encodeCursor(endpoint, &query, nextPosition)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pageResult(params.Limit > 0 || params.Cursor != "", pdEntries, cursor), nil
+}
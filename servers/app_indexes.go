@@ -0,0 +1,98 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+)
+
+// Rebuilds the zip code index of confirmed providers and the date index of
+// their appointments from the provider keys and the appointment IDs. Both
+// indexes are only written when providers are confirmed and appointments
+// are published, so data from before they existed would not be found
+// otherwise. Adding entries that already exist has no effect.
+func (c *Appointments) Reindex() error {
+
+	for _, actor := range []string{"providers", "flaggedProviders"} {
+
+		providerKeys, err := c.backend.Keys(actor).GetAll()
+
+		if err != nil {
+			if err == databases.NotFound {
+				continue
+			}
+			return err
+		}
+
+		for _, providerKey := range providerKeys {
+
+			// flagged providers can't be found by users
+			if actor == "providers" {
+				if pkd, err := providerKey.ProviderKeyData(); err != nil {
+					services.Log.Error(err)
+				} else if pkd.QueueData.ZipCode != "" {
+					if err := c.backend.ProvidersByZipCode().Add(providerKey.ID, pkd.QueueData.ZipCode); err != nil {
+						return err
+					}
+				}
+			}
+
+			datesByID, err := c.backend.AppointmentDatesByID(providerKey.ID).GetAll()
+
+			if err != nil {
+				if err == databases.NotFound {
+					continue
+				}
+				return err
+			}
+
+			appointmentDates := c.backend.AppointmentDates(providerKey.ID)
+
+			for _, date := range datesByID {
+				if err := appointmentDates.Add(string(date)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Rebuilds the indexes once, which makes existing data searchable after an
+// upgrade.
+func (c *Appointments) migrateIndexes() error {
+
+	migration := c.db.Value("migrations", []byte("indexes"))
+
+	if _, err := migration.Get(); err == nil {
+		return nil
+	} else if err != databases.NotFound {
+		return err
+	}
+
+	services.Log.Info("Rebuilding the provider and appointment indexes...")
+
+	if err := c.Reindex(); err != nil {
+		return err
+	}
+
+	return migration.Set([]byte("done"), 0)
+}
@@ -48,11 +48,22 @@ func (c *Appointments) confirmProvider(context services.Context, params *service
 		PublicKey: params.Data.SignedKeyData.PublicKey,
 	}
 
+	if err := c.audit("confirmProvider", params.PublicKey, params.JSON, params.Signature, params.Data.Timestamp, hash); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
 	if err := keys.Set(hash, providerKey); err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
 	}
 
+	// the provider might have been flagged after its previous confirmation
+	if err := c.backend.Keys("flaggedProviders").Del(hash); err != nil && err != databases.NotFound {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
 	unverifiedProviderData := c.backend.UnverifiedProviderData()
 	verifiedProviderData := c.backend.VerifiedProviderData()
 	confirmedProviderData := c.backend.ConfirmedProviderData()
@@ -102,5 +113,13 @@ func (c *Appointments) confirmProvider(context services.Context, params *service
 		}
 	}
 
+	// we index the provider by zip code so that it can be found by users
+	if queueData := params.Data.SignedKeyData.Data.QueueData; queueData != nil {
+		if err := c.backend.ProvidersByZipCode().Add(hash, queueData.ZipCode); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+	}
+
 	return context.Acknowledge()
 }
@@ -0,0 +1,208 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+	"time"
+)
+
+// mediator-only endpoint
+// { providerID }, keyPair
+func (c *Appointments) deleteProvider(context services.Context, params *services.ManageProviderSignedParams) services.Response {
+
+	resp, _ := c.isMediator(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	providerID := params.Data.ProviderID
+
+	if found, err := c.providerExists(providerID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !found {
+		return context.NotFound()
+	}
+
+	if lock, err := c.backend.LockProvider(providerID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		defer release(lock)
+	}
+
+	if err := c.audit("deleteProvider", params.PublicKey, params.JSON, params.Signature, params.Data.Timestamp, providerID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.removeProvider(providerID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Acknowledge()
+}
+
+// Checks whether we know anything about the given provider, i.e. whether it
+// has been confirmed, flagged or has at least submitted its data.
+func (c *Appointments) providerExists(providerID []byte) (bool, error) {
+
+	for _, actor := range []string{"providers", "flaggedProviders"} {
+		if _, err := c.backend.Keys(actor).Get(providerID); err == nil {
+			return true, nil
+		} else if err != databases.NotFound {
+			return false, err
+		}
+	}
+
+	for _, providerData := range []*RawProviderData{c.backend.UnverifiedProviderData(), c.backend.VerifiedProviderData()} {
+		if _, err := providerData.Get(providerID); err == nil {
+			return true, nil
+		} else if err != databases.NotFound {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// Removes all data of the given provider. Bookings are cancelled and the
+// tokens of the affected users are released so that they can book another
+// appointment. The caller needs to hold the provider lock.
+func (c *Appointments) removeProvider(providerID []byte) error {
+
+	appointmentDatesByID := c.backend.AppointmentDatesByID(providerID)
+
+	appointmentDates, err := appointmentDatesByID.GetAll()
+
+	if err != nil && err != databases.NotFound {
+		return err
+	}
+
+	for id, date := range appointmentDates {
+
+		signedAppointment, err := c.backend.AppointmentsByDate(providerID, string(date)).Get(c.settings.Validate, []byte(id))
+
+		if err == databases.NotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		for _, booking := range signedAppointment.Bookings {
+			if err := c.releaseBooking(providerID, signedAppointment, booking); err != nil {
+				return err
+			}
+		}
+
+		if err := c.deleteAppointment(providerID, []byte(id)); err != nil {
+			return err
+		}
+	}
+
+	// users that are still waiting get their tokens back as well
+	waitlist := c.backend.Waitlist(providerID)
+
+	waiting, err := waitlist.Waiting()
+
+	if err != nil && err != databases.NotFound {
+		return err
+	}
+
+	for _, entry := range waiting {
+		if err := c.backend.UsedTokens().Del(entry.Token); err != nil {
+			return err
+		}
+	}
+
+	appointmentSeries := c.backend.AppointmentSeries(providerID)
+
+	allSeries, err := appointmentSeries.GetAll()
+
+	if err != nil && err != databases.NotFound {
+		return err
+	}
+
+	for _, series := range allSeries {
+		if err := c.backend.AppointmentSeriesOccurrences(providerID, series.ID).Clear(); err != nil {
+			return err
+		}
+	}
+
+	for _, clearIndex := range []func() error{
+		waitlist.Clear,
+		appointmentSeries.Clear,
+		appointmentDatesByID.Clear,
+		c.backend.AppointmentDates(providerID).Clear,
+	} {
+		if err := clearIndex(); err != nil {
+			return err
+		}
+	}
+
+	for _, del := range []func([]byte) error{
+		c.backend.PublicProviderData().Del,
+		c.backend.ConfirmedProviderData().Del,
+		c.backend.UnverifiedProviderData().Del,
+		c.backend.VerifiedProviderData().Del,
+		c.backend.Keys("providers").Del,
+		c.backend.Keys("flaggedProviders").Del,
+		c.backend.ProvidersByZipCode().Del,
+		c.backend.SuspendedProviders().Del,
+	} {
+		if err := del(providerID); err != nil && err != databases.NotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Cancels the given booking because the provider has been deleted, and
+// releases the token of the user so that it can be used again.
+func (c *Appointments) releaseBooking(providerID []byte, signedAppointment *services.SignedAppointment, booking *services.Booking) error {
+
+	if err := c.backend.UsedTokens().Del(booking.Token); err != nil {
+		return err
+	}
+
+	if err := c.backend.BookedAppointments(booking.Token).Del(booking.ID); err != nil {
+		return err
+	}
+
+	cancellation := &services.BookingCancellation{
+		ProviderID:    providerID,
+		AppointmentID: signedAppointment.Data.ID,
+		BookingID:     booking.ID,
+		Timestamp:     signedAppointment.Data.Timestamp,
+		CancelledAt:   time.Now(),
+	}
+
+	// we store the cancellation so that the user can learn about it
+	return c.backend.BookingCancellations(booking.Token).Add(cancellation)
+}
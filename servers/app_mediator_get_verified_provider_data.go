@@ -46,12 +46,12 @@ func (c *Appointments) getVerifiedProviderData(context services.Context, params
 		return context.InternalError()
 	}
 
-	pdEntries := []*services.RawProviderData{}
+	page, err := c.providerDataPage("getVerifiedProviderData", providerDataMap, params.Data)
 
-	for _, pd := range providerDataMap {
-		pdEntries = append(pdEntries, pd)
+	if err != nil {
+		return context.Error(400, "invalid cursor", nil)
 	}
 
-	return context.Result(pdEntries)
+	return context.Result(page)
 
 }
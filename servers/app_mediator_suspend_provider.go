@@ -0,0 +1,62 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+)
+
+// mediator-only endpoint
+// { providerID }, keyPair
+func (c *Appointments) suspendProvider(context services.Context, params *services.ManageProviderSignedParams) services.Response {
+
+	resp, _ := c.isMediator(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	if _, err := c.backend.Keys("providers").Get(params.Data.ProviderID); err != nil {
+		if err == databases.NotFound {
+			return context.NotFound()
+		}
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.audit("suspendProvider", params.PublicKey, params.JSON, params.Signature, params.Data.Timestamp, params.Data.ProviderID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// the provider keeps its data and appointments, it just won't show up
+	// for users until it is reactivated
+	if err := c.backend.SuspendedProviders().Add(params.Data.ProviderID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Acknowledge()
+}
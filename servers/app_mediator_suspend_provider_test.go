@@ -0,0 +1,214 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func TestSuspendProvider(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		// we create a single appointment with a single slot
+		at.FC{af.Appointments{
+			N:        1,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    1,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+
+		// we create a user
+		at.FC{af.User{}, "user"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	mediator := fixtures["mediator"].(*crypto.Actor)
+	provider := fixtures["provider"].(*helpers.Provider)
+	user := fixtures["user"].(*helpers.User)
+	appointment := fixtures["appointments"].([]*services.SignedAppointment)[0]
+	providerID := crypto.Hash(provider.Actor.SigningKey.PublicKey)
+
+	visibleProviders := func() int {
+
+		resp, err := client.Appointments.GetProvidersByZipCode(&services.GetProvidersByZipCodeParams{
+			ZipFrom: "10000",
+			ZipTo:   "19999",
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var result struct {
+			Result []*services.SignedProviderData `json:"result"`
+		}
+
+		if bytes, err := resp.Bytes(); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal(bytes, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		return len(result.Result)
+	}
+
+	visibleAppointments := func() int {
+
+		resp, err := client.Appointments.GetAppointmentsByZipCode(&services.GetAppointmentsByZipCodeParams{
+			ZipCode: "10707",
+			Radius:  20,
+			From:    af.TS("2022-10-01T00:00:00Z"),
+			To:      af.TS("2022-10-02T00:00:00Z"),
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var result struct {
+			Result []*services.ProviderAppointments `json:"result"`
+		}
+
+		if bytes, err := resp.Bytes(); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal(bytes, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		return len(result.Result)
+	}
+
+	publish := func() int {
+
+		resp, err := client.Appointments.PublishAppointments(&services.PublishAppointmentsParams{
+			Timestamp:    time.Now(),
+			Appointments: []*services.SignedAppointment{appointment},
+		}, provider)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return errorCode(t, resp)
+	}
+
+	if n := visibleProviders(); n != 1 {
+		t.Fatalf("expected one provider, got %d", n)
+	}
+
+	// unknown providers can't be suspended
+	if resp, err := client.Appointments.SuspendProvider(appointment.Data.ID, mediator); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 404 {
+		t.Fatalf("expected a 404 error code, got %d", code)
+	}
+
+	if resp, err := client.Appointments.SuspendProvider(providerID, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	if n := visibleProviders(); n != 0 {
+		t.Fatalf("expected no providers, got %d", n)
+	}
+
+	if n := visibleAppointments(); n != 0 {
+		t.Fatalf("expected no appointments, got %d", n)
+	}
+
+	if resp, err := client.Appointments.BookAppointment(user, providerID, appointment); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 404 {
+		t.Fatalf("expected a 404 error code, got %d", code)
+	}
+
+	if code := publish(); code != 403 {
+		t.Fatalf("expected a 403 error code, got %d", code)
+	}
+
+	if resp, err := client.Appointments.ReactivateProvider(providerID, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	// the provider isn't suspended anymore
+	if resp, err := client.Appointments.ReactivateProvider(providerID, mediator); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 404 {
+		t.Fatalf("expected a 404 error code, got %d", code)
+	}
+
+	if n := visibleProviders(); n != 1 {
+		t.Fatalf("expected one provider, got %d", n)
+	}
+
+	if n := visibleAppointments(); n != 1 {
+		t.Fatalf("expected one provider with appointments, got %d", n)
+	}
+
+	if code := publish(); code != 0 {
+		t.Fatalf("expected publishing to succeed, got error code %d", code)
+	}
+
+	if resp, err := client.Appointments.BookAppointment(user, providerID, appointment); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,141 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
+	"time"
+)
+
+func (c *Appointments) cancelBooking(context services.Context, params *services.CancelBookingSignedParams) services.Response {
+
+	resp, providerKey := c.isProvider(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	pkd, err := providerKey.ProviderKeyData()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// the provider "ID" is the hash of the signing key
+	hash := crypto.Hash(pkd.Signing)
+
+	if lock, err := c.backend.LockProvider(hash); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		defer release(lock)
+	}
+
+	date, err := c.backend.AppointmentDatesByID(hash).Get(params.Data.ID)
+
+	if err != nil {
+		if err == databases.NotFound {
+			return context.NotFound()
+		}
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	appointmentsByDate := c.backend.AppointmentsByDate(hash, date)
+
+	signedAppointment, err := appointmentsByDate.Get(c.settings.Validate, params.Data.ID)
+
+	if err != nil {
+		services.Log.Errorf("Cannot get appointment by date: %v", err)
+		return context.InternalError()
+	}
+
+	var cancelledBooking *services.Booking
+	newBookings := make([]*services.Booking, 0)
+
+	for _, booking := range signedAppointment.Bookings {
+		if bytes.Equal(booking.ID, params.Data.BookingID) {
+			cancelledBooking = booking
+			continue
+		}
+		newBookings = append(newBookings, booking)
+	}
+
+	if cancelledBooking == nil {
+		return context.NotFound()
+	}
+
+	signedAppointment.Bookings = newBookings
+
+	// we re-enable the token so that the user can book another appointment
+	if err := c.backend.UsedTokens().Del(cancelledBooking.Token); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.backend.BookedAppointments(cancelledBooking.Token).Del(cancelledBooking.ID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// if the booking was assigned through the waitlist we remove the entry
+	if err := c.backend.Waitlist(hash).Del(cancelledBooking.Token); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	cancellation := &services.BookingCancellation{
+		ProviderID:      hash,
+		AppointmentID:   signedAppointment.Data.ID,
+		BookingID:       cancelledBooking.ID,
+		Timestamp:       signedAppointment.Data.Timestamp,
+		CancelledAt:     time.Now(),
+		EncryptedReason: params.Data.EncryptedReason,
+	}
+
+	// we store the cancellation so that the user can learn about it
+	if err := c.backend.BookingCancellations(cancelledBooking.Token).Add(cancellation); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	signedAppointment.UpdatedAt = time.Now()
+
+	// the freed slot goes to the next user on the waitlist
+	if _, err := c.assignWaitlistSlots(hash, signedAppointment); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := appointmentsByDate.Set(signedAppointment); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Acknowledge()
+}
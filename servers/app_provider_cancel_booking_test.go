@@ -0,0 +1,148 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/forms"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+)
+
+func TestCancelBooking(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		// we create a single appointment with a single slot
+		at.FC{af.Appointments{
+			N:        1,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    1,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+
+		// we create a user
+		at.FC{af.User{}, "user"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	user := fixtures["user"].(*helpers.User)
+	appointment := fixtures["appointments"].([]*services.SignedAppointment)[0]
+	providerID := crypto.Hash(provider.Actor.SigningKey.PublicKey)
+
+	booking := &services.Booking{}
+
+	if resp, err := client.Appointments.BookAppointment(user, providerID, appointment); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	} else if err := resp.CoerceResult(booking, &forms.BookingForm); err != nil {
+		t.Fatal(err)
+	}
+
+	// a booking that doesn't exist can't be cancelled
+	if resp, err := client.Appointments.CancelBooking(provider, appointment.Data.ID, appointment.Data.ID, user.Actor.EncryptionKey.PublicKey, "test"); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 404 {
+		t.Fatalf("expected a 404 error code, got %d", code)
+	}
+
+	if resp, err := client.Appointments.CancelBooking(provider, appointment.Data.ID, booking.ID, user.Actor.EncryptionKey.PublicKey, "we are closed"); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	resp, err := client.Appointments.GetBookingCancellations(user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Result []*services.BookingCancellation `json:"result"`
+	}
+
+	if data, err := resp.Bytes(); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Result) != 1 {
+		t.Fatalf("expected one cancellation, got %d", len(result.Result))
+	}
+
+	cancellation := result.Result[0]
+
+	if !bytes.Equal(cancellation.AppointmentID, appointment.Data.ID) || !bytes.Equal(cancellation.BookingID, booking.ID) {
+		t.Fatalf("cancellation does not match the booking")
+	}
+
+	if cancellation.EncryptedReason == nil || len(cancellation.EncryptedReason.Data) == 0 {
+		t.Fatalf("expected an encrypted reason")
+	}
+
+	// the token has been re-enabled, so the user can book again
+	if resp, err := client.Appointments.BookAppointment(user, providerID, appointment); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+}
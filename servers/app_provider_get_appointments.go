@@ -47,9 +47,15 @@ func (c *Appointments) getProviderAppointments(context services.Context, params
 	// the provider "ID" is the hash of the signing key
 	hash := crypto.Hash(pkd.Signing)
 
+	// series are rolled forward by the retention worker, but we make sure
+	// providers always see them expanded to the current horizon
+	if _, err := c.rollProviderAppointmentSeries(hash, time.Now()); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
 	// appointments are stored in a provider-specific key
-	appointmentDatesByID := c.backend.AppointmentDatesByID(hash)
-	allDates, err := appointmentDatesByID.GetAll()
+	dates, err := c.backend.AppointmentDates(hash).Range(params.Data.From, params.Data.To)
 	if err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
@@ -57,20 +63,9 @@ func (c *Appointments) getProviderAppointments(context services.Context, params
 
 	signedAppointments := make([]*services.SignedAppointment, 0)
 
-	for _, dateStr := range allDates {
-
-		date, err := time.Parse("2006-01-02", string(dateStr))
-
-		if err != nil {
-			services.Log.Error(err)
-			continue
-		}
-
-		if date.Before(params.Data.From) || date.After(params.Data.To) {
-			continue
-		}
+	for _, date := range dates {
 
-		appointmentsByDate := c.backend.AppointmentsByDate(hash, string(dateStr))
+		appointmentsByDate := c.backend.AppointmentsByDate(hash, date)
 
 		allAppointments, err := appointmentsByDate.GetAll(c.settings.Validate)
 
@@ -0,0 +1,80 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"time"
+)
+
+func (c *Appointments) publishAppointmentSeries(context services.Context, params *services.PublishAppointmentSeriesSignedParams) services.Response {
+
+	resp, providerKey := c.isProvider(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	series := params.Data.Series
+
+	if !series.End.After(series.Start) {
+		return context.Error(400, "series must end after it starts", nil)
+	}
+
+	pkd, err := providerKey.ProviderKeyData()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// the provider "ID" is the hash of the signing key
+	hash := crypto.Hash(pkd.Signing)
+
+	// suspended providers can't publish appointments until reactivated
+	if suspended, err := c.backend.SuspendedProviders().Has(hash); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if suspended {
+		return context.Error(403, "provider suspended", nil)
+	}
+
+	// we make sure no bookings take place while we update the appointments
+	if lock, err := c.backend.LockProvider(hash); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		defer release(lock)
+	}
+
+	// new and existing series are expanded in the same way, which propagates
+	// any changes to future appointments
+	if err := c.expandAppointmentSeries(hash, series, time.Now()); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Acknowledge()
+}
@@ -0,0 +1,351 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	"github.com/kiebitz-oss/services/servers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"sort"
+	"testing"
+	"time"
+)
+
+func getProviderAppointments(t *testing.T, client *helpers.Client, provider *helpers.Provider, from, to time.Time) []*services.SignedAppointment {
+
+	resp, err := client.Appointments.GetProviderAppointments(&services.GetProviderAppointmentsParams{
+		Timestamp: time.Now(),
+		From:      from,
+		To:        to,
+	}, provider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Result *services.ProviderAppointments `json:"result"`
+	}
+
+	if data, err := resp.Bytes(); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	appointments := result.Result.Appointments
+
+	for _, appointment := range appointments {
+		if err := json.Unmarshal([]byte(appointment.JSON), &appointment.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sort.Slice(appointments, func(i, j int) bool {
+		return appointments[i].Data.Timestamp.Before(appointments[j].Data.Timestamp)
+	})
+
+	return appointments
+}
+
+func TestAppointmentSeries(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		// we create a user
+		at.FC{af.User{}, "user"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	user := fixtures["user"].(*helpers.User)
+	settings := fixtures["settings"].(*services.Settings)
+	providerID := crypto.Hash(provider.Actor.SigningKey.PublicKey)
+
+	id, err := crypto.RandomBytes(32)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	start := now.Truncate(24*time.Hour).AddDate(0, 0, 1).Add(10 * time.Hour)
+
+	series := &services.AppointmentSeries{
+		ID:        id,
+		Interval:  "daily",
+		Start:     start,
+		End:       start.AddDate(0, 0, 9),
+		Duration:  30,
+		Slots:     2,
+		PublicKey: provider.Actor.EncryptionKey.PublicKey,
+		Properties: map[string]interface{}{
+			"vaccine": "moderna",
+		},
+	}
+
+	// a series needs to end after it starts
+	invalidSeries := *series
+	invalidSeries.End = start.Add(-time.Hour)
+
+	if resp, err := client.Appointments.PublishAppointmentSeries(&invalidSeries, provider); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 400 {
+		t.Fatalf("expected a 400 error code, got %d", code)
+	}
+
+	if resp, err := client.Appointments.PublishAppointmentSeries(series, provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	appointments := getProviderAppointments(t, client, provider, now, now.AddDate(0, 0, 13))
+
+	if len(appointments) != 10 {
+		t.Fatalf("expected 10 appointments, got %d", len(appointments))
+	}
+
+	for i, appointment := range appointments {
+		if !appointment.Data.Timestamp.Equal(start.AddDate(0, 0, i)) {
+			t.Fatalf("unexpected appointment time: %v", appointment.Data.Timestamp)
+		}
+		if !bytes.Equal(appointment.Data.SeriesID, id) || len(appointment.Data.SlotData) != 2 {
+			t.Fatalf("appointment does not match the series")
+		}
+		// generated appointments are signed with the appointment key
+		if !bytes.Equal(appointment.PublicKey, settings.Appointments.Key("appointment").PublicKey) {
+			t.Fatalf("expected the appointment to be signed with the appointment key")
+		}
+	}
+
+	firstAppointment := appointments[0]
+
+	if resp, err := client.Appointments.BookAppointment(user, providerID, firstAppointment); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	// we shorten the series, reduce the number of slots and change the
+	// duration and properties of its appointments
+	series.End = start.AddDate(0, 0, 4)
+	series.Slots = 1
+	series.Duration = 15
+	series.Properties = map[string]interface{}{
+		"vaccine": "biontech",
+	}
+
+	if resp, err := client.Appointments.PublishAppointmentSeries(series, provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	appointments = getProviderAppointments(t, client, provider, now, now.AddDate(0, 0, 13))
+
+	if len(appointments) != 5 {
+		t.Fatalf("expected 5 appointments, got %d", len(appointments))
+	}
+
+	// the booked appointment is left untouched
+	if !bytes.Equal(appointments[0].Data.ID, firstAppointment.Data.ID) {
+		t.Fatalf("expected the booked appointment to be preserved")
+	} else if appointments[0].JSON != firstAppointment.JSON || len(appointments[0].Bookings) != 1 {
+		t.Fatalf("expected the booked appointment to be unchanged")
+	}
+
+	// the other appointments are updated
+	for _, appointment := range appointments[1:] {
+		if len(appointment.Data.SlotData) != 1 || appointment.Data.Duration != 15 || appointment.Data.Properties["vaccine"] != "biontech" {
+			t.Fatalf("expected the appointment to match the updated series")
+		}
+	}
+
+	if len(getBookedAppointments(t, client, user)) != 1 {
+		t.Fatalf("expected the booking to be preserved")
+	}
+
+	resp, err := client.Appointments.GetAppointmentSeries(provider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result struct {
+		Result []*services.AppointmentSeries `json:"result"`
+	}
+
+	if data, err := resp.Bytes(); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Result) != 1 || result.Result[0].Slots != 1 {
+		t.Fatalf("expected the updated series")
+	}
+
+	if resp, err := client.Appointments.DeleteAppointmentSeries(provider, id); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	// only the booked appointment remains
+	appointments = getProviderAppointments(t, client, provider, now, now.AddDate(0, 0, 13))
+
+	if len(appointments) != 1 || !bytes.Equal(appointments[0].Data.ID, firstAppointment.Data.ID) {
+		t.Fatalf("expected only the booked appointment to remain")
+	}
+
+	if resp, err := client.Appointments.DeleteAppointmentSeries(provider, id); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 404 {
+		t.Fatalf("expected a 404 error code, got %d", code)
+	}
+}
+
+func TestRollAppointmentSeries(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	settings := fixtures["settings"].(*services.Settings)
+	server := fixtures["appointmentsServer"].(*servers.Appointments)
+
+	id, err := crypto.RandomBytes(32)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	start := now.Truncate(24*time.Hour).AddDate(0, 0, 1).Add(10 * time.Hour)
+	horizon := int(settings.Appointments.SeriesHorizonDays)
+
+	series := &services.AppointmentSeries{
+		ID:        id,
+		Interval:  "daily",
+		Start:     start,
+		End:       start.AddDate(0, 0, horizon*2),
+		Duration:  30,
+		Slots:     1,
+		PublicKey: provider.Actor.EncryptionKey.PublicKey,
+		Properties: map[string]interface{}{
+			"vaccine": "moderna",
+		},
+	}
+
+	if resp, err := client.Appointments.PublishAppointmentSeries(series, provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	// we look at the two weeks following the horizon
+	from := now.AddDate(0, 0, horizon)
+	to := from.AddDate(0, 0, 14)
+
+	before := len(getProviderAppointments(t, client, provider, from, to))
+
+	// the series is already expanded up to the horizon
+	if n, err := server.RollAppointmentSeries(now); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("expected no series to be expanded, got %d", n)
+	}
+
+	// ten days later the worker extends the series without the provider
+	if n, err := server.RollAppointmentSeries(now.AddDate(0, 0, 10)); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("expected one series to be expanded, got %d", n)
+	}
+
+	after := len(getProviderAppointments(t, client, provider, from, to))
+
+	if after <= before {
+		t.Fatalf("expected additional appointments, got %d (before %d)", after, before)
+	}
+}
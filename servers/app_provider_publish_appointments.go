@@ -39,10 +39,6 @@ func (c *Appointments) publishAppointments(context services.Context, params *ser
 		return resp
 	}
 
-	if expired(params.Data.Timestamp) {
-		return context.Error(410, "signature expired", nil)
-	}
-
 	pkd, err := providerKey.ProviderKeyData()
 
 	if err != nil {
@@ -54,79 +50,27 @@ func (c *Appointments) publishAppointments(context services.Context, params *ser
 	hash := crypto.Hash(pkd.Signing)
 	hexUID := hex.EncodeToString(hash)
 
-	// appointments are stored in a provider-specific key
-	appointmentDatesByID := c.backend.AppointmentDatesByID(hash)
-	usedTokens := c.backend.UsedTokens()
+	// suspended providers can't publish appointments until reactivated
+	if suspended, err := c.backend.SuspendedProviders().Has(hash); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if suspended {
+		return context.Error(403, "provider suspended", nil)
+	}
+
+	// we make sure no bookings take place while we update the appointments
+	if lock, err := c.backend.LockProvider(hash); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		defer release(lock)
+	}
 
 	// to do: fix statistics generation
 	var bookedSlots, openSlots int64
 
 	for _, appointment := range params.Data.Appointments {
-
-		// check if there's an existing appointment
-		if date, err := appointmentDatesByID.Get(appointment.Data.ID); err == nil {
-
-			if err := appointmentDatesByID.Del(appointment.Data.ID); err != nil {
-				services.Log.Error(err)
-				return context.InternalError()
-			}
-
-			appointmentsByDate := c.backend.AppointmentsByDate(hash, string(date))
-
-			if existingAppointment, err := appointmentsByDate.Get(c.settings.Validate, appointment.Data.ID); err != nil {
-				services.Log.Error(err)
-				return context.InternalError()
-			} else if err := appointmentsByDate.Del(appointment.Data.ID); err != nil {
-				services.Log.Error(err)
-				return context.InternalError()
-			} else {
-				bookings := make([]*services.Booking, 0)
-				for _, existingSlotData := range existingAppointment.Data.SlotData {
-					found := false
-					for _, slotData := range appointment.Data.SlotData {
-						if bytes.Equal(slotData.ID, existingSlotData.ID) {
-							found = true
-							break
-						}
-					}
-					if found {
-						// this slot has been preserved, if there's any booking for it we migrate it
-						for _, booking := range existingAppointment.Bookings {
-							if bytes.Equal(booking.ID, existingSlotData.ID) {
-								bookings = append(bookings, booking)
-								break
-							}
-						}
-					} else {
-						// this slot has been deleted, if there's any booking for it we delete it
-						for _, booking := range existingAppointment.Bookings {
-							if bytes.Equal(booking.ID, existingSlotData.ID) {
-								// we re-enable the associated token
-								if err := usedTokens.Del(booking.Token); err != nil {
-									services.Log.Error(err)
-									return context.InternalError()
-								}
-								break
-							}
-						}
-					}
-				}
-				appointment.Bookings = bookings
-			}
-		}
-
-		date := appointment.Data.Timestamp.Format("2006-01-02")
-
-		appointmentsByDate := c.backend.AppointmentsByDate(hash, date)
-
-		if err := appointmentDatesByID.Set(appointment.Data.ID, date); err != nil {
-			services.Log.Error(err)
-			return context.InternalError()
-		}
-
-		appointment.UpdatedAt = time.Now()
-
-		if err := appointmentsByDate.Set(appointment); err != nil {
+		if err := c.storeAppointment(hash, appointment); err != nil {
 			services.Log.Error(err)
 			return context.InternalError()
 		}
@@ -175,3 +119,100 @@ func (c *Appointments) publishAppointments(context services.Context, params *ser
 
 	return context.Acknowledge()
 }
+
+// Stores the given appointment, replacing an existing appointment with the
+// same ID. Bookings of preserved slots are migrated to the new appointment,
+// whereas bookings of deleted slots are dropped and their tokens re-enabled.
+// The caller needs to hold the provider lock.
+func (c *Appointments) storeAppointment(providerID []byte, appointment *services.SignedAppointment) error {
+
+	// appointments are stored in a provider-specific key
+	appointmentDatesByID := c.backend.AppointmentDatesByID(providerID)
+	appointmentDates := c.backend.AppointmentDates(providerID)
+	usedTokens := c.backend.UsedTokens()
+
+	// check if there's an existing appointment
+	if date, err := appointmentDatesByID.Get(appointment.Data.ID); err == nil {
+
+		if err := appointmentDatesByID.Del(appointment.Data.ID); err != nil {
+			return err
+		}
+
+		appointmentsByDate := c.backend.AppointmentsByDate(providerID, string(date))
+
+		if existingAppointment, err := appointmentsByDate.Get(c.settings.Validate, appointment.Data.ID); err != nil {
+			return err
+		} else if err := appointmentsByDate.Del(appointment.Data.ID); err != nil {
+			return err
+		} else {
+			bookings := make([]*services.Booking, 0)
+			for _, existingSlotData := range existingAppointment.Data.SlotData {
+				found := false
+				for _, slotData := range appointment.Data.SlotData {
+					if bytes.Equal(slotData.ID, existingSlotData.ID) {
+						found = true
+						break
+					}
+				}
+				if found {
+					// this slot has been preserved, if there's any booking for it we migrate it
+					for _, booking := range existingAppointment.Bookings {
+						if bytes.Equal(booking.ID, existingSlotData.ID) {
+							// the time of the appointment might have changed
+							if err := c.backend.BookedAppointments(booking.Token).Add(bookedAppointment(providerID, appointment, booking)); err != nil {
+								return err
+							}
+							bookings = append(bookings, booking)
+							break
+						}
+					}
+				} else {
+					// this slot has been deleted, if there's any booking for it we delete it
+					for _, booking := range existingAppointment.Bookings {
+						if bytes.Equal(booking.ID, existingSlotData.ID) {
+							// we re-enable the associated token
+							if err := usedTokens.Del(booking.Token); err != nil {
+								return err
+							}
+							if err := c.backend.BookedAppointments(booking.Token).Del(booking.ID); err != nil {
+								return err
+							}
+							break
+						}
+					}
+				}
+			}
+			appointment.Bookings = bookings
+		}
+
+		// if no appointments are left on the old date we remove it from the index
+		if remainingAppointments, err := appointmentsByDate.GetAll(c.settings.Validate); err != nil {
+			return err
+		} else if len(remainingAppointments) == 0 {
+			if err := appointmentDates.Del(date); err != nil {
+				return err
+			}
+		}
+	}
+
+	date := appointment.Data.Timestamp.Format("2006-01-02")
+
+	appointmentsByDate := c.backend.AppointmentsByDate(providerID, date)
+
+	if err := appointmentDatesByID.Set(appointment.Data.ID, date); err != nil {
+		return err
+	}
+
+	if err := appointmentDates.Add(date); err != nil {
+		return err
+	}
+
+	appointment.UpdatedAt = time.Now()
+
+	// new or freed slots go to users on the waitlist
+	if _, err := c.assignWaitlistSlots(providerID, appointment); err != nil {
+		return err
+	}
+
+	return appointmentsByDate.Set(appointment)
+}
@@ -19,10 +19,13 @@
 package servers_test
 
 import (
+	"github.com/kiebitz-oss/services"
 	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
 	at "github.com/kiebitz-oss/services/testing"
 	af "github.com/kiebitz-oss/services/testing/fixtures"
 	"testing"
+	"time"
 )
 
 func TestPublishAppointments(t *testing.T) {
@@ -67,3 +70,111 @@ func TestPublishAppointments(t *testing.T) {
 	}
 
 }
+
+func TestPublishAppointmentsProperties(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+
+	publish := func(properties map[string]interface{}) *helpers.Response {
+
+		appointment, err := services.MakeAppointment(time.Now().Add(time.Hour), 1, 30)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		appointment.PublicKey = provider.Actor.EncryptionKey.PublicKey
+		appointment.Properties = properties
+
+		signedAppointment, err := appointment.Sign(provider.Actor.SigningKey)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := client.Appointments.PublishAppointments(&services.PublishAppointmentsParams{
+			Timestamp:    time.Now(),
+			Appointments: []*services.SignedAppointment{signedAppointment},
+		}, provider)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return resp
+	}
+
+	if resp := publish(map[string]interface{}{
+		"vaccine": "moderna",
+		"minAge":  18,
+		"walkIn":  true,
+	}); resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	for _, properties := range []map[string]interface{}{
+		// the vaccine is required
+		{"minAge": 18},
+		// the vaccine is unknown
+		{"vaccine": "sputnik"},
+		// the age is out of range
+		{"vaccine": "moderna", "minAge": 150},
+		// walk-in needs to be a boolean
+		{"vaccine": "moderna", "walkIn": "yes"},
+		// the property is not in the schema
+		{"vaccine": "moderna", "color": "blue"},
+	} {
+		if resp := publish(properties); resp.StatusCode != 400 {
+			t.Fatalf("expected a 400 status code for %v, got %d", properties, resp.StatusCode)
+		}
+	}
+	// integer properties without bounds accept any value
+	validate := fixtures["settings"].(*services.Settings).Appointments.Validate
+	validate.Properties = []*services.PropertySchema{
+		{Name: "vaccine", Type: "enum", Required: true, Values: []string{"biontech"}},
+		{Name: "minAge", Type: "integer"},
+	}
+
+	if resp := publish(map[string]interface{}{
+		"vaccine": "biontech",
+		"minAge":  500,
+	}); resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	// appointments published under the old schema can still be read
+	now := time.Now()
+	if appointments := getProviderAppointments(t, client, provider, now.AddDate(0, 0, -1), now.AddDate(0, 0, 1)); len(appointments) != 2 {
+		t.Fatalf("expected 2 appointments, got %d", len(appointments))
+	}
+}
@@ -37,12 +37,10 @@ func (c *Appointments) storeProviderData(context services.Context, params *servi
 		return context.Error(400, "invalid signature", nil)
 	}
 
-	if expired(params.Data.Timestamp) {
-		return context.Error(410, "signature expired", nil)
+	if resp := isFresh(context, c.db, []byte(params.JSON), params.PublicKey, params.Data.Timestamp); resp != nil {
+		return resp
 	}
 
-	// to do: add one-time use check
-
 	hash := crypto.Hash(params.PublicKey)
 
 	verifiedProviderData := c.backend.VerifiedProviderData()
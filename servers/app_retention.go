@@ -0,0 +1,350 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+	"time"
+)
+
+// The data removed by a retention run
+type RetentionReport struct {
+	Appointments     int64
+	Bookings         int64
+	DateIndexEntries int64
+	WaitlistEntries  int64
+	Cancellations    int64
+	Tokens           int64
+}
+
+// Removes appointments (along with their encrypted bookings), waitlist
+// entries and booking cancellations that are older than DataTTLDays before
+// the given time, as well as tokens that have been used more than
+// TokenTTLDays before it. Tokens that are still on a waitlist or that still
+// have bookings are kept, so a token is only removed once its last
+// appointment has been removed as well.
+func (c *Appointments) ApplyRetention(now time.Time) (*RetentionReport, error) {
+
+	report := &RetentionReport{}
+
+	cutoff := now.AddDate(0, 0, -int(c.settings.DataTTLDays))
+
+	providerIDs := make([][]byte, 0)
+
+	// flagged providers might still have appointments
+	for _, actor := range []string{"providers", "flaggedProviders"} {
+		if providerKeys, err := c.backend.Keys(actor).GetAll(); err != nil {
+			if err == databases.NotFound {
+				continue
+			}
+			return report, err
+		} else {
+			for _, providerKey := range providerKeys {
+				providerIDs = append(providerIDs, providerKey.ID)
+			}
+		}
+	}
+
+	// cancellations are stored by token, so we look them up via their index
+	if tokens, err := c.backend.CancelledTokens(cutoff); err != nil && err != databases.NotFound {
+		return report, err
+	} else {
+		for _, token := range tokens {
+			if n, err := c.backend.BookingCancellations(token).Prune(cutoff); err != nil {
+				return report, err
+			} else {
+				report.Cancellations += n
+			}
+		}
+	}
+
+	waitingTokens := make(map[string]bool)
+
+	for _, providerID := range providerIDs {
+		if err := c.applyProviderRetention(providerID, cutoff, report); err != nil {
+			return report, err
+		}
+		if entries, err := c.backend.Waitlist(providerID).Waiting(); err != nil {
+			if err == databases.NotFound {
+				continue
+			}
+			return report, err
+		} else {
+			for _, entry := range entries {
+				waitingTokens[string(entry.Token)] = true
+			}
+		}
+	}
+
+	inUse := func(token []byte) (bool, error) {
+		if waitingTokens[string(token)] {
+			return true, nil
+		}
+		if bookedAppointments, err := c.backend.BookedAppointments(token).GetAll(); err != nil {
+			if err == databases.NotFound {
+				return false, nil
+			}
+			return false, err
+		} else {
+			return len(bookedAppointments) > 0, nil
+		}
+	}
+
+	if n, err := c.backend.UsedTokens().Prune(now.AddDate(0, 0, -int(c.settings.TokenTTLDays)), inUse); err != nil {
+		return report, err
+	} else {
+		report.Tokens = n
+	}
+
+	c.meterRetention(report)
+
+	return report, nil
+}
+
+func (c *Appointments) applyProviderRetention(providerID []byte, cutoff time.Time, report *RetentionReport) error {
+
+	if lock, err := c.backend.LockProvider(providerID); err != nil {
+		return err
+	} else {
+		defer release(lock)
+	}
+
+	appointmentDates := c.backend.AppointmentDates(providerID)
+	appointmentDatesByID := c.backend.AppointmentDatesByID(providerID)
+	cutoffDate := cutoff.Format("2006-01-02")
+
+	// we remove waitlist entries whose time window has passed, as well as
+	// entries of users that were booked into an expired appointment
+	waitlist := c.backend.Waitlist(providerID)
+
+	entries, err := waitlist.GetAll()
+
+	if err != nil && err != databases.NotFound {
+		return err
+	}
+
+	for _, entry := range entries {
+
+		expired := entry.To.Before(cutoff)
+
+		if !expired && entry.AppointmentID != nil {
+			if date, err := appointmentDatesByID.Get(entry.AppointmentID); err == nil {
+				expired = date < cutoffDate
+			} else if err != databases.NotFound {
+				return err
+			}
+		}
+
+		if !expired {
+			continue
+		}
+
+		if err := waitlist.Del(entry.Token); err != nil {
+			return err
+		}
+
+		report.WaitlistEntries++
+	}
+
+	dates, err := appointmentDates.Range(time.Unix(0, 0), cutoff)
+
+	if err != nil {
+		return err
+	}
+
+	for _, date := range dates {
+
+		appointmentsByDate := c.backend.AppointmentsByDate(providerID, date)
+
+		signedAppointments, err := appointmentsByDate.GetAll(c.settings.Validate)
+
+		if err != nil && err != databases.NotFound {
+			return err
+		}
+
+		remaining := len(signedAppointments)
+
+		for _, signedAppointment := range signedAppointments {
+			if removed, err := c.removeExpiredAppointment(providerID, date, signedAppointment, cutoff, report); err != nil {
+				return err
+			} else if removed {
+				remaining--
+			}
+		}
+
+		if remaining == 0 {
+			if err := appointmentDates.Del(date); err != nil {
+				return err
+			}
+		}
+	}
+
+	// appointments can be missing from the date index (e.g. if they were
+	// stored before it existed), so we also look them up via their ID and
+	// prune index entries of past appointments that don't exist anymore
+	datesByID, err := appointmentDatesByID.GetAll()
+
+	if err != nil && err != databases.NotFound {
+		return err
+	}
+
+	for id, date := range datesByID {
+
+		if string(date) > cutoffDate {
+			continue
+		}
+
+		if signedAppointment, err := c.backend.AppointmentsByDate(providerID, string(date)).Get(c.settings.Validate, []byte(id)); err == nil {
+			if _, err := c.removeExpiredAppointment(providerID, string(date), signedAppointment, cutoff, report); err != nil {
+				return err
+			}
+			continue
+		} else if err != databases.NotFound {
+			return err
+		}
+
+		if err := appointmentDatesByID.Del([]byte(id)); err != nil {
+			return err
+		}
+
+		report.DateIndexEntries++
+	}
+
+	return nil
+}
+
+// Removes the given appointment along with its bookings if it ended before
+// the cutoff, and returns whether it has been removed.
+func (c *Appointments) removeExpiredAppointment(providerID []byte, date string, signedAppointment *services.SignedAppointment, cutoff time.Time, report *RetentionReport) (bool, error) {
+
+	end := signedAppointment.Data.Timestamp.Add(time.Duration(signedAppointment.Data.Duration) * time.Minute)
+
+	if !end.Before(cutoff) {
+		return false, nil
+	}
+
+	// we remove the booking from the index of the user
+	for _, booking := range signedAppointment.Bookings {
+		if err := c.backend.BookedAppointments(booking.Token).Del(booking.ID); err != nil {
+			return false, err
+		}
+		report.Bookings++
+	}
+
+	if err := c.backend.AppointmentsByDate(providerID, date).Del(signedAppointment.Data.ID); err != nil {
+		return false, err
+	}
+
+	if err := c.backend.AppointmentDatesByID(providerID).Del(signedAppointment.Data.ID); err != nil {
+		return false, err
+	}
+
+	report.Appointments++
+
+	return true, nil
+}
+
+// Reports the removed data through the meter
+func (c *Appointments) meterRetention(report *RetentionReport) {
+
+	if c.meter == nil {
+		return
+	}
+
+	now := time.Now().UTC().UnixNano()
+
+	for name, value := range map[string]int64{
+		"appointments":     report.Appointments,
+		"bookings":         report.Bookings,
+		"dateIndexEntries": report.DateIndexEntries,
+		"waitlistEntries":  report.WaitlistEntries,
+		"cancellations":    report.Cancellations,
+		"tokens":           report.Tokens,
+	} {
+
+		if value == 0 {
+			continue
+		}
+
+		for _, twt := range tws {
+
+			// generate the time window
+			tw := twt(now)
+
+			if err := c.meter.Add("retention", name, map[string]string{}, tw, value); err != nil {
+				services.Log.Error(err)
+			}
+		}
+	}
+}
+
+// Starts the retention worker, which periodically removes expired data and
+// rolls appointment series forward.
+func (c *Appointments) startRetentionWorker() {
+
+	interval := time.Duration(c.settings.RetentionIntervalMinutes) * time.Minute
+
+	if interval <= 0 {
+		return
+	}
+
+	c.stopRetention = make(chan bool)
+	c.retentionStopped = make(chan bool)
+
+	go func(stop, stopped chan bool) {
+
+		defer close(stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if report, err := c.ApplyRetention(time.Now()); err != nil {
+					services.Log.Error(err)
+				} else {
+					services.Log.Infof("Retention: removed %d appointments, %d bookings, %d index entries, %d waitlist entries, %d cancellations and %d tokens.", report.Appointments, report.Bookings, report.DateIndexEntries, report.WaitlistEntries, report.Cancellations, report.Tokens)
+				}
+				if n, err := c.RollAppointmentSeries(time.Now()); err != nil {
+					services.Log.Error(err)
+				} else if n > 0 {
+					services.Log.Infof("Expanded %d appointment series.", n)
+				}
+			}
+		}
+	}(c.stopRetention, c.retentionStopped)
+}
+
+// Stops the retention worker and waits for a running retention to finish.
+func (c *Appointments) stopRetentionWorker() {
+
+	if c.stopRetention == nil {
+		return
+	}
+
+	close(c.stopRetention)
+	<-c.retentionStopped
+
+	c.stopRetention = nil
+	c.retentionStopped = nil
+}
@@ -0,0 +1,392 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/forms"
+	"github.com/kiebitz-oss/services/helpers"
+	"github.com/kiebitz-oss/services/servers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func TestApplyRetention(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		// we create a single appointment with a single slot
+		at.FC{af.Appointments{
+			N:        1,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    1,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+
+		// we create a user
+		at.FC{af.User{}, "user"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := fixtures["settings"].(*services.Settings)
+	server := fixtures["appointmentsServer"].(*servers.Appointments)
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	user := fixtures["user"].(*helpers.User)
+	appointment := fixtures["appointments"].([]*services.SignedAppointment)[0]
+	providerID := crypto.Hash(provider.Actor.SigningKey.PublicKey)
+
+	if resp, err := client.Appointments.BookAppointment(user, providerID, appointment); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	providerAppointments := func() int {
+
+		resp, err := client.Appointments.GetProviderAppointments(&services.GetProviderAppointmentsParams{
+			Timestamp: time.Now(),
+			From:      af.TS("2022-10-01T00:00:00Z"),
+			To:        af.TS("2022-10-02T00:00:00Z"),
+		}, provider)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var result struct {
+			Result *services.ProviderAppointments `json:"result"`
+		}
+
+		if data, err := resp.Bytes(); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal(data, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Result == nil {
+			t.Fatalf("expected a result")
+		}
+
+		return len(result.Result.Appointments)
+	}
+
+	// the appointment is still within the retention period
+	if report, err := server.ApplyRetention(af.TS("2022-10-15T00:00:00Z")); err != nil {
+		t.Fatal(err)
+	} else if report.Appointments != 0 || report.Bookings != 0 || report.Tokens != 0 {
+		t.Fatalf("expected nothing to be removed, got %+v", report)
+	}
+
+	if n := providerAppointments(); n != 1 {
+		t.Fatalf("expected one appointment, got %d", n)
+	}
+
+	// appointments that are missing from the date index are removed as well
+	if err := settings.DatabaseObj.Expire("appointmentDates", providerID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	afterRetention := appointment.Data.Timestamp.AddDate(0, 0, int(settings.Appointments.DataTTLDays)+1)
+
+	if report, err := server.ApplyRetention(afterRetention); err != nil {
+		t.Fatal(err)
+	} else if report.Appointments != 1 || report.Bookings != 1 || report.Tokens != 0 {
+		t.Fatalf("expected the appointment and its booking to be removed, got %+v", report)
+	}
+
+	if n := providerAppointments(); n != 0 {
+		t.Fatalf("expected no appointments, got %d", n)
+	}
+
+	if bookedAppointments := getBookedAppointments(t, client, user); len(bookedAppointments) != 0 {
+		t.Fatalf("expected no booked appointments, got %d", len(bookedAppointments))
+	}
+
+	// the token is still in use
+	if resp, err := client.Appointments.BookAppointment(user, providerID, appointment); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 401 {
+		t.Fatalf("expected a 401 error code, got %d", code)
+	}
+
+	afterTokenRetention := time.Now().AddDate(0, 0, int(settings.Appointments.TokenTTLDays)+1)
+
+	if report, err := server.ApplyRetention(afterTokenRetention); err != nil {
+		t.Fatal(err)
+	} else if report.Tokens != 1 {
+		t.Fatalf("expected the token to be removed, got %+v", report)
+	}
+}
+
+func TestApplyRetentionKeepsBookedTokens(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		// we create a single appointment that takes place after the tokens
+		// would normally have been released
+		at.FC{af.Appointments{
+			N:        1,
+			Start:    time.Now().AddDate(0, 0, 90),
+			Duration: 30,
+			Slots:    1,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+
+		// we create a user
+		at.FC{af.User{}, "user"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := fixtures["settings"].(*services.Settings)
+	server := fixtures["appointmentsServer"].(*servers.Appointments)
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	user := fixtures["user"].(*helpers.User)
+	appointment := fixtures["appointments"].([]*services.SignedAppointment)[0]
+	providerID := crypto.Hash(provider.Actor.SigningKey.PublicKey)
+
+	if resp, err := client.Appointments.BookAppointment(user, providerID, appointment); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	afterTokenRetention := time.Now().AddDate(0, 0, int(settings.Appointments.TokenTTLDays)+1)
+
+	// the token still has a booking, so it is kept
+	if report, err := server.ApplyRetention(afterTokenRetention); err != nil {
+		t.Fatal(err)
+	} else if report.Bookings != 0 || report.Tokens != 0 {
+		t.Fatalf("expected nothing to be removed, got %+v", report)
+	}
+
+	if bookedAppointments := getBookedAppointments(t, client, user); len(bookedAppointments) != 1 {
+		t.Fatalf("expected one booked appointment, got %d", len(bookedAppointments))
+	}
+
+	afterRetention := appointment.Data.Timestamp.AddDate(0, 0, int(settings.Appointments.DataTTLDays)+1)
+
+	// once the appointment is gone the token is released as well
+	if report, err := server.ApplyRetention(afterRetention); err != nil {
+		t.Fatal(err)
+	} else if report.Bookings != 1 || report.Tokens != 1 {
+		t.Fatalf("expected the booking and the token to be removed, got %+v", report)
+	}
+}
+
+func TestApplyRetentionWaitlistAndCancellations(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		// we create a single appointment with a single slot
+		at.FC{af.Appointments{
+			N:        1,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    1,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+
+		// we create a user
+		at.FC{af.User{}, "user"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := fixtures["settings"].(*services.Settings)
+	server := fixtures["appointmentsServer"].(*servers.Appointments)
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	user := fixtures["user"].(*helpers.User)
+	appointment := fixtures["appointments"].([]*services.SignedAppointment)[0]
+	providerID := crypto.Hash(provider.Actor.SigningKey.PublicKey)
+
+	waitingUser, err := (af.User{}).Setup(fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	booking := &services.Booking{}
+
+	if resp, err := client.Appointments.BookAppointment(user, providerID, appointment); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	} else if err := resp.CoerceResult(booking, &forms.BookingForm); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, err := client.Appointments.CancelBooking(provider, appointment.Data.ID, booking.ID, user.Actor.EncryptionKey.PublicKey, "we are closed"); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.JoinWaitlist(waitingUser.(*helpers.User), providerID, provider.Actor.EncryptionKey.PublicKey, af.TS("2022-10-01T00:00:00Z"), af.TS("2022-10-02T00:00:00Z")); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	cancellations := func() int {
+
+		resp, err := client.Appointments.GetBookingCancellations(user)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var result struct {
+			Result []*services.BookingCancellation `json:"result"`
+		}
+
+		if data, err := resp.Bytes(); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal(data, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		return len(result.Result)
+	}
+
+	afterRetention := appointment.Data.Timestamp.AddDate(0, 0, int(settings.Appointments.DataTTLDays)+1)
+
+	// the time window of the waitlist entry has passed, while the
+	// cancellation is still recent
+	if report, err := server.ApplyRetention(afterRetention); err != nil {
+		t.Fatal(err)
+	} else if report.WaitlistEntries != 1 || report.Cancellations != 0 {
+		t.Fatalf("expected the waitlist entry to be removed, got %+v", report)
+	}
+
+	if resp, err := client.Appointments.GetWaitlist(waitingUser.(*helpers.User), providerID); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 404 {
+		t.Fatalf("expected a 404 error code, got %d", code)
+	}
+
+	if n := cancellations(); n != 1 {
+		t.Fatalf("expected one cancellation, got %d", n)
+	}
+
+	if report, err := server.ApplyRetention(time.Now().AddDate(0, 0, int(settings.Appointments.DataTTLDays)+1)); err != nil {
+		t.Fatal(err)
+	} else if report.Cancellations != 1 {
+		t.Fatalf("expected the cancellation to be removed, got %+v", report)
+	}
+
+	if n := cancellations(); n != 0 {
+		t.Fatalf("expected no cancellations, got %d", n)
+	}
+
+	// the token of the waiting user is no longer reserved
+	if report, err := server.ApplyRetention(time.Now().AddDate(0, 0, int(settings.Appointments.TokenTTLDays)+1)); err != nil {
+		t.Fatal(err)
+	} else if report.Tokens != 1 {
+		t.Fatalf("expected the token to be removed, got %+v", report)
+	}
+}
@@ -20,27 +20,21 @@ package servers
 
 import (
 	"github.com/kiebitz-oss/services"
-	"github.com/kiebitz-oss/services/crypto"
 )
 
 func (c *Appointments) addCodes(context services.Context, params *services.AddCodesParams) services.Response {
-	rootKey := c.settings.Key("root")
-	if rootKey == nil {
-		services.Log.Error("root key missing")
-		return context.InternalError()
-	}
-	if ok, err := rootKey.Verify(&crypto.SignedData{
-		Data:      []byte(params.JSON),
+	if resp := c.isRoot(context, &services.SignedParams{
+		JSON:      params.JSON,
 		Signature: params.Signature,
-	}); !ok {
-		return context.Error(403, "invalid signature", nil)
-	} else if err != nil {
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		return resp
+	}
+	if err := c.audit("addCodes", params.PublicKey, params.JSON, params.Signature, params.Data.Timestamp); err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
 	}
-	if expired(params.Data.Timestamp) {
-		return context.Error(410, "signature expired", nil)
-	}
 	codes := c.backend.Codes(params.Data.Actor)
 	for _, code := range params.Data.Codes {
 		if err := codes.Add(code); err != nil {
@@ -48,5 +42,6 @@ func (c *Appointments) addCodes(context services.Context, params *services.AddCo
 			return context.InternalError()
 		}
 	}
+
 	return context.Acknowledge()
 }
@@ -46,6 +46,11 @@ func (c *Appointments) addMediatorPublicKeys(context services.Context, params *s
 
 	keys := c.backend.Keys("mediators")
 
+	if err := c.audit("addMediatorPublicKeys", params.PublicKey, params.JSON, params.Signature, params.Data.Timestamp, hash); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
 	if err := keys.Set(hash, mediatorKey); err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
@@ -0,0 +1,179 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	mediator := fixtures["mediator"].(*crypto.Actor)
+	provider := fixtures["provider"].(*helpers.Provider)
+	providerID := crypto.Hash(provider.Actor.SigningKey.PublicKey)
+
+	if resp, err := client.Appointments.SuspendProvider(providerID, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	getAuditLog := func(from, limit int64) []*services.AuditEntry {
+
+		resp, err := client.Appointments.GetAuditLog(from, limit)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != 200 {
+			t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+		}
+
+		var result struct {
+			Result []*services.AuditEntry `json:"result"`
+		}
+
+		if data, err := resp.Bytes(); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal(data, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		return result.Result
+	}
+
+	entries := getAuditLog(1, 100)
+
+	if err := services.VerifyAuditLog(entries); err != nil {
+		t.Fatal(err)
+	}
+
+	var confirmation, suspension *services.AuditEntry
+
+	for _, entry := range entries {
+		switch entry.Endpoint {
+		case "confirmProvider":
+			confirmation = entry
+		case "suspendProvider":
+			suspension = entry
+		}
+	}
+
+	if confirmation == nil || suspension == nil {
+		t.Fatalf("expected the confirmation and suspension to be logged")
+	}
+
+	// we can tell who confirmed the provider
+	if !bytes.Equal(confirmation.PublicKey, mediator.SigningKey.PublicKey) {
+		t.Fatalf("expected the confirmation to be signed by the mediator")
+	}
+
+	if len(confirmation.IDs) != 1 || !bytes.Equal(confirmation.IDs[0], providerID) {
+		t.Fatalf("expected the confirmation to refer to the provider")
+	}
+
+	if last := entries[len(entries)-1]; last != suspension {
+		t.Fatalf("expected the suspension to be the last entry")
+	}
+
+	if page := getAuditLog(2, 1); len(page) != 1 || page[0].N != 2 || !bytes.Equal(page[0].Hash, entries[1].Hash) {
+		t.Fatalf("expected the second entry")
+	}
+
+	// modifying an entry breaks the chain
+	confirmation.IDs[0] = crypto.Hash([]byte("another provider"))
+
+	if err := services.VerifyAuditLog(entries); err == nil {
+		t.Fatalf("expected the verification to fail")
+	}
+
+	// removing an entry breaks the chain as well
+	if err := services.VerifyAuditLog(append(entries[:1:1], entries[2:]...)); err == nil {
+		t.Fatalf("expected the verification to fail")
+	}
+
+	// forged request data is detected even if the hash is recomputed
+	forged := *suspension
+	forged.Data = strings.Replace(forged.Data, "{", "{ ", 1)
+
+	if forged.Hash, err = forged.ComputeHash(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := services.VerifyAuditLog([]*services.AuditEntry{&forged}); err == nil {
+		t.Fatalf("expected the verification to fail")
+	}
+
+	// the log survives a database reset
+	if resp, err := client.Appointments.ResetDB(); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	afterReset := getAuditLog(1, 100)
+
+	if len(afterReset) != len(entries)+1 || afterReset[len(afterReset)-1].Endpoint != "resetDB" {
+		t.Fatalf("expected the log to be kept")
+	}
+
+	if err := services.VerifyAuditLog(afterReset); err != nil {
+		t.Fatal(err)
+	}
+}
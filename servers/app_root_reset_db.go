@@ -34,15 +34,42 @@ func (a *Appointments) resetDB(context services.Context, params *services.ResetD
 	}
 
 	if !a.test {
-		context.Error(400, "not a test system, will not reset database...", nil)
+		return context.Error(400, "not a test system, will not reset database...", nil)
 	}
 
 	services.Log.Warning("Database reset requested!")
 
+	if err := a.audit("resetDB", params.PublicKey, params.JSON, params.Signature, params.Data.Timestamp); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	auditLog := a.backend.AuditLog()
+
+	// the audit log is not part of the reset, so we restore it afterwards
+	head, err := auditLog.Head()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	entries, err := auditLog.Range(1, head.N)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
 	if err := a.db.Reset(); err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
 	}
 
+	if err := auditLog.Restore(head, entries); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
 	return context.Acknowledge()
 }
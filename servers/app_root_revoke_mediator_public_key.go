@@ -0,0 +1,134 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
+)
+
+// { signing }, keyPair
+// revokes the key of a mediator and flags all providers it confirmed
+func (c *Appointments) revokeMediatorPublicKey(context services.Context, params *services.RevokeMediatorPublicKeySignedParams) services.Response {
+
+	if resp := c.isRoot(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		return resp
+	}
+
+	hash := crypto.Hash(params.Data.Signing)
+
+	mediators := c.backend.Keys("mediators")
+
+	mediatorKey, err := mediators.Get(hash)
+
+	if err != nil {
+		if err == databases.NotFound {
+			return context.NotFound()
+		}
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	providerKeys, err := c.backend.Keys("providers").GetAll()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// provider keys are signed by the mediator that confirmed them
+	confirmedKeys := make([]*services.ActorKey, 0)
+	affectedIDs := [][]byte{hash}
+
+	for _, providerKey := range providerKeys {
+		if bytes.Equal(providerKey.PublicKey, params.Data.Signing) {
+			confirmedKeys = append(confirmedKeys, providerKey)
+			affectedIDs = append(affectedIDs, providerKey.ID)
+		}
+	}
+
+	if err := c.audit("revokeMediatorPublicKey", params.PublicKey, params.JSON, params.Signature, params.Data.Timestamp, affectedIDs...); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// we keep the revoked key so that clients can learn about the revocation
+	if err := c.backend.Keys("revokedMediators").Set(hash, mediatorKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := mediators.Del(hash); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	for _, providerKey := range confirmedKeys {
+		if err := c.flagProvider(providerKey); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+	}
+
+	return context.Acknowledge()
+}
+
+// Flags a provider whose confirmation can no longer be trusted. The provider
+// can't use the API and won't show up in searches until a mediator confirms
+// it again, for which its data is returned to the pending queue.
+func (c *Appointments) flagProvider(providerKey *services.ActorKey) error {
+
+	providerID := providerKey.ID
+
+	if err := c.backend.Keys("flaggedProviders").Set(providerID, providerKey); err != nil {
+		return err
+	}
+
+	if err := c.backend.Keys("providers").Del(providerID); err != nil {
+		return err
+	}
+
+	if err := c.backend.ProvidersByZipCode().Del(providerID); err != nil {
+		return err
+	}
+
+	verifiedProviderData := c.backend.VerifiedProviderData()
+
+	providerData, err := verifiedProviderData.Get(providerID)
+
+	if err != nil {
+		if err == databases.NotFound {
+			return nil
+		}
+		return err
+	}
+
+	if err := c.backend.UnverifiedProviderData().Set(providerID, providerData); err != nil {
+		return err
+	}
+
+	return verifiedProviderData.Del(providerID)
+}
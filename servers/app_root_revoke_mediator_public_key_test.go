@@ -0,0 +1,178 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func TestRevokeMediatorPublicKey(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider (confirmed by the mediator)
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		// we create another mediator
+		at.FC{af.Mediator{}, "otherMediator"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	mediator := fixtures["mediator"].(*crypto.Actor)
+	otherMediator := fixtures["otherMediator"].(*crypto.Actor)
+	provider := fixtures["provider"].(*helpers.Provider)
+
+	checkProviderData := func() int {
+		if resp, err := client.Appointments.CheckProviderData(provider); err != nil {
+			t.Fatal(err)
+			return 0
+		} else {
+			return errorCode(t, resp)
+		}
+	}
+
+	pendingProviders := func() int {
+
+		resp, err := client.Appointments.GetPendingProviderData(&services.GetPendingProviderDataParams{
+			Timestamp: time.Now(),
+			Limit:     10,
+		}, otherMediator)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var result struct {
+			Result struct {
+				Results []*services.RawProviderData `json:"results"`
+			} `json:"result"`
+		}
+
+		if data, err := resp.Bytes(); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal(data, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		return len(result.Result.Results)
+	}
+
+	if code := checkProviderData(); code != 0 {
+		t.Fatalf("expected no error, got %d", code)
+	}
+
+	if n := pendingProviders(); n != 0 {
+		t.Fatalf("expected no pending providers, got %d", n)
+	}
+
+	if resp, err := client.Appointments.RevokeMediatorPublicKey(mediator); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 0 {
+		t.Fatalf("expected no error, got %d", code)
+	}
+
+	// the mediator can't be revoked twice
+	if resp, err := client.Appointments.RevokeMediatorPublicKey(mediator); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 404 {
+		t.Fatalf("expected a 404 error, got %d", code)
+	}
+
+	// the revoked mediator can no longer confirm providers
+	if resp, err := client.Appointments.ConfirmProvider(provider, mediator); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 401 {
+		t.Fatalf("expected a 401 error, got %d", code)
+	}
+
+	// the provider has been flagged and needs to be confirmed again
+	if code := checkProviderData(); code != 401 {
+		t.Fatalf("expected a 401 error, got %d", code)
+	}
+
+	if n := pendingProviders(); n != 1 {
+		t.Fatalf("expected one pending provider, got %d", n)
+	}
+
+	// the revoked key is published
+	if resp, err := client.Appointments.GetKeys(); err != nil {
+		t.Fatal(err)
+	} else {
+
+		var result struct {
+			Result *services.Keys `json:"result"`
+		}
+
+		if data, err := resp.Bytes(); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal(data, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result.Result.RevokedMediators) != 1 {
+			t.Fatalf("expected one revoked mediator key")
+		}
+	}
+
+	if resp, err := client.Appointments.ConfirmProvider(provider, otherMediator); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 0 {
+		t.Fatalf("expected no error, got %d", code)
+	}
+
+	if code := checkProviderData(); code != 0 {
+		t.Fatalf("expected no error, got %d", code)
+	}
+
+	if n := pendingProviders(); n != 0 {
+		t.Fatalf("expected no pending providers, got %d", n)
+	}
+
+}
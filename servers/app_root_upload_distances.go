@@ -20,27 +20,22 @@ package servers
 
 import (
 	"github.com/kiebitz-oss/services"
-	"github.com/kiebitz-oss/services/crypto"
 )
 
 func (c *Appointments) uploadDistances(context services.Context, params *services.UploadDistancesSignedParams) services.Response {
-	rootKey := c.settings.Key("root")
-	if rootKey == nil {
-		services.Log.Error("root key missing")
-		return context.InternalError()
-	}
-	if ok, err := rootKey.Verify(&crypto.SignedData{
-		Data:      []byte(params.JSON),
+	if resp := c.isRoot(context, &services.SignedParams{
+		JSON:      params.JSON,
 		Signature: params.Signature,
-	}); !ok {
-		return context.Error(403, "invalid signature", nil)
-	} else if err != nil {
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		return resp
+	}
+	if err := c.audit("uploadDistances", params.PublicKey, params.JSON, params.Signature, params.Data.Timestamp); err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
 	}
-	if expired(params.Data.Timestamp) {
-		return context.Error(410, "signature expired", nil)
-	}
+
 	for _, distance := range params.Data.Distances {
 		neighborsFrom := c.backend.Neighbors(params.Data.Type, distance.From)
 		neighborsTo := c.backend.Neighbors(params.Data.Type, distance.To)
@@ -0,0 +1,296 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+	"sort"
+	"strings"
+)
+
+// The matching appointments of a single provider in a search
+type providerMatch struct {
+	ID           []byte
+	Data         *services.SignedProviderData
+	Key          *services.ActorKey
+	Appointments []*services.SignedAppointment
+}
+
+// Returns all appointments of the provider that match the search, ordered by
+// timestamp and ID so that pages can continue after a given appointment.
+func (c *Appointments) matchingAppointments(providerID []byte, params *services.GetAppointmentsByZipCodeParams) ([]*services.SignedAppointment, error) {
+
+	// complexity: O(log(n) + m) where n is the number of dates of the
+	// provider and m the number of dates in the requested time window
+	dates, err := c.backend.AppointmentDates(providerID).Range(params.From, params.To)
+
+	if err != nil {
+		return nil, err
+	}
+
+	signedAppointments := make([]*services.SignedAppointment, 0)
+
+	for _, date := range dates {
+
+		appointmentsByDate := c.backend.AppointmentsByDate(providerID, date)
+		allAppointments, err := appointmentsByDate.GetAll(c.settings.Validate)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, signedAppointment := range allAppointments {
+
+			if !matchesFilters(params, signedAppointment) {
+				continue
+			}
+
+			// if all slots are booked we do not return the appointment
+			if len(signedAppointment.Bookings) >= len(signedAppointment.Data.SlotData) {
+				continue
+			}
+
+			signedAppointments = append(signedAppointments, signedAppointment)
+		}
+	}
+
+	sort.Slice(signedAppointments, func(i, j int) bool {
+		a, b := signedAppointments[i].Data, signedAppointments[j].Data
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.Before(b.Timestamp)
+		}
+		return string(a.ID) < string(b.ID)
+	})
+
+	return signedAppointments, nil
+}
+
+// Returns the provider with its matching appointments, or nil if the
+// provider should not show up in the search.
+func (c *Appointments) matchProvider(providerID []byte, params *services.GetAppointmentsByZipCodeParams) (*providerMatch, error) {
+
+	providerKey, err := c.backend.Keys("providers").Get(providerID)
+
+	if err != nil {
+		if err != databases.NotFound {
+			services.Log.Error(err)
+		}
+		services.Log.Warning("provider key not found")
+		return nil, nil
+	}
+
+	if suspended, err := c.backend.SuspendedProviders().Has(providerID); err != nil {
+		return nil, err
+	} else if suspended {
+		return nil, nil
+	}
+
+	// fetch the full public data of the provider
+	providerData, err := c.backend.PublicProviderData().Get(providerID)
+
+	if err != nil {
+		if err != databases.NotFound {
+			services.Log.Error(err)
+		}
+		services.Log.Warning("provider data not found")
+		return nil, nil
+	}
+
+	if params.Accessible && (providerData.Data == nil || !providerData.Data.Accessible) {
+		return nil, nil
+	}
+
+	appointments, err := c.matchingAppointments(providerID, params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(appointments) == 0 {
+		return nil, nil
+	}
+
+	return &providerMatch{
+		ID:           providerID,
+		Data:         providerData,
+		Key:          providerKey,
+		Appointments: appointments,
+	}, nil
+}
+
+// A provider in the search order. Providers are ordered by their sort key
+// (the distance of their zip code or the time of their earliest appointment),
+// their zip code and their ID.
+type searchCandidate struct {
+	SortKey int64
+	ZipCode string
+	ID      []byte
+	Match   *providerMatch
+}
+
+func (s *searchCandidate) less(other *searchCandidate) bool {
+	if s.SortKey != other.SortKey {
+		return s.SortKey < other.SortKey
+	}
+	if s.ZipCode != other.ZipCode {
+		return s.ZipCode < other.ZipCode
+	}
+	return bytes.Compare(s.ID, other.ID) < 0
+}
+
+// Compares the provider to the provider of the given cursor position
+func (s *searchCandidate) compare(position *cursorPosition) int {
+	if s.SortKey != position.SortKey {
+		if s.SortKey < position.SortKey {
+			return -1
+		}
+		return 1
+	}
+	if c := strings.Compare(s.ZipCode, position.ZipCode); c != 0 {
+		return c
+	}
+	return bytes.Compare(s.ID, position.After)
+}
+
+// Returns the cursor position of the given appointment of the provider
+func (s *searchCandidate) position(appointment *services.SignedAppointment) *cursorPosition {
+	timestamp := appointment.Data.Timestamp
+	return &cursorPosition{
+		SortKey:     s.SortKey,
+		ZipCode:     s.ZipCode,
+		After:       s.ID,
+		Timestamp:   &timestamp,
+		Appointment: appointment.Data.ID,
+	}
+}
+
+// Returns the appointments that come after the appointment of the given
+// cursor position. The appointments need to be ordered by timestamp and ID.
+func appointmentsAfter(appointments []*services.SignedAppointment, position *cursorPosition) []*services.SignedAppointment {
+
+	if position.Timestamp == nil {
+		return appointments
+	}
+
+	for i, appointment := range appointments {
+		timestamp := appointment.Data.Timestamp
+		if timestamp.After(*position.Timestamp) || (timestamp.Equal(*position.Timestamp) && string(appointment.Data.ID) > string(position.Appointment)) {
+			return appointments[i:]
+		}
+	}
+
+	return nil
+}
+
+// Searches for appointments near the given zip code and returns one page of
+// results after the given position, as well as the position of the last
+// returned appointment (or nil if there are no more results). Providers are
+// ordered by distance or by their earliest appointment, and a provider with
+// more than maxAppointments matching appointments is split across several
+// pages. As positions are keys rather than offsets, pages stay consistent
+// when providers or appointments are added or removed in between requests.
+func (c *Appointments) searchAppointments(params *services.GetAppointmentsByZipCodeParams, position *cursorPosition, maxProviders, maxAppointments int64) ([]*providerMatch, *cursorPosition, error) {
+
+	// get all providers in the given radius
+	candidates, err := c.getProvidersNearZipCode(params.ZipCode, params.Radius)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if params.SortBy == "earliest" {
+
+		// we need to look at all providers to sort them
+		matches := make([]*searchCandidate, 0)
+
+		for _, candidate := range candidates {
+			if match, err := c.matchProvider(candidate.ID, params); err != nil {
+				return nil, nil, err
+			} else if match != nil {
+				matches = append(matches, &searchCandidate{
+					SortKey: match.Appointments[0].Data.Timestamp.UnixNano(),
+					ID:      candidate.ID,
+					Match:   match,
+				})
+			}
+		}
+
+		candidates = matches
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].less(candidates[j])
+	})
+
+	page := make([]*providerMatch, 0)
+
+	var lastPosition *cursorPosition
+
+	for _, candidate := range candidates {
+
+		cmp := 1
+
+		// we skip all providers before the one of the position (the start
+		// position has no provider)
+		if position.After != nil {
+			if cmp = candidate.compare(position); cmp < 0 {
+				continue
+			}
+		}
+
+		match := candidate.Match
+
+		if match == nil {
+			if match, err = c.matchProvider(candidate.ID, params); err != nil {
+				return nil, nil, err
+			} else if match == nil {
+				continue
+			}
+		}
+
+		appointments := match.Appointments
+
+		// we continue after the last appointment of the previous page
+		if cmp == 0 {
+			appointments = appointmentsAfter(appointments, position)
+		}
+
+		if len(appointments) == 0 {
+			continue
+		}
+
+		if int64(len(page)) >= maxProviders {
+			return page, lastPosition, nil
+		}
+
+		if int64(len(appointments)) > maxAppointments {
+			match.Appointments = appointments[:maxAppointments]
+			page = append(page, match)
+			return page, candidate.position(match.Appointments[maxAppointments-1]), nil
+		}
+
+		match.Appointments = appointments
+		page = append(page, match)
+		lastPosition = candidate.position(appointments[len(appointments)-1])
+	}
+
+	return page, nil, nil
+}
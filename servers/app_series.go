@@ -0,0 +1,355 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"fmt"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
+	"time"
+)
+
+// Returns the times of all occurrences of the series between from and to
+// (inclusive).
+func seriesOccurrences(series *services.AppointmentSeries, from, to time.Time) []time.Time {
+
+	days := 1
+
+	if series.Interval == "weekly" {
+		days = 7
+	}
+
+	t := series.Start
+
+	// we skip ahead to the first occurrence in the time window
+	if from.After(t) {
+		n := int(from.Sub(t) / (time.Duration(days) * 24 * time.Hour))
+		t = t.AddDate(0, 0, n*days)
+	}
+
+	occurrences := make([]time.Time, 0)
+
+	for ; !t.After(to) && !t.After(series.End); t = t.AddDate(0, 0, days) {
+		if t.Before(from) {
+			continue
+		}
+		occurrences = append(occurrences, t)
+	}
+
+	return occurrences
+}
+
+// Returns the given number of slots, reusing the slots of the existing
+// appointment where possible. Removed slots and their bookings are handled
+// by storeAppointment.
+func seriesSlots(existingAppointment *services.SignedAppointment, slots int64) ([]*services.Slot, error) {
+
+	slotData := make([]*services.Slot, 0, slots)
+
+	for _, slot := range existingAppointment.Data.SlotData {
+		if int64(len(slotData)) < slots {
+			slotData = append(slotData, slot)
+		}
+	}
+
+	for int64(len(slotData)) < slots {
+		if id, err := crypto.RandomBytes(32); err != nil {
+			return nil, err
+		} else {
+			slotData = append(slotData, &services.Slot{ID: id})
+		}
+	}
+
+	return slotData, nil
+}
+
+// Expands the given series into appointments up to the configured horizon.
+// Future appointments of the series are updated to match it and appointments
+// that are no longer part of it are removed. Appointments that have bookings
+// are left untouched, so users keep the appointment they booked.
+// Past appointments are never modified. As the server does not have access
+// to the signing key of the provider, generated appointments are signed with
+// the appointment key of the service instead, which clients can obtain via
+// getKeys. The caller needs to hold the provider lock.
+func (c *Appointments) expandAppointmentSeries(providerID []byte, series *services.AppointmentSeries, now time.Time) error {
+
+	horizon := now.AddDate(0, 0, int(c.settings.SeriesHorizonDays))
+	signingKey := c.settings.Key("appointment")
+
+	if signingKey == nil {
+		return fmt.Errorf("appointment key missing")
+	}
+
+	occurrences := c.backend.AppointmentSeriesOccurrences(providerID, series.ID)
+
+	existingOccurrences, err := occurrences.GetAll()
+
+	if err != nil && err != databases.NotFound {
+		return err
+	}
+
+	planned := make(map[int64]time.Time)
+
+	for _, t := range seriesOccurrences(series, now, horizon) {
+		planned[t.Unix()] = t
+	}
+
+	for t, id := range existingOccurrences {
+
+		// we never touch appointments that have already taken place
+		if t.Before(now) {
+			continue
+		}
+
+		existingAppointment, _, err := c.getAppointmentByID(providerID, id)
+
+		if err == databases.NotFound {
+			// the appointment is gone, we recreate it if it's still planned
+			if err := occurrences.Del(t); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		_, isPlanned := planned[t.Unix()]
+
+		delete(planned, t.Unix())
+
+		// we keep appointments that have bookings as they are
+		if len(existingAppointment.Bookings) > 0 {
+			continue
+		}
+
+		if !isPlanned {
+			if err := c.deleteAppointment(providerID, id); err != nil {
+				return err
+			}
+			if err := occurrences.Del(t); err != nil {
+				return err
+			}
+			continue
+		}
+
+		slotData, err := seriesSlots(existingAppointment, series.Slots)
+
+		if err != nil {
+			return err
+		}
+
+		appointment := &services.Appointment{
+			Timestamp:  existingAppointment.Data.Timestamp,
+			Duration:   series.Duration,
+			Properties: series.Properties,
+			SlotData:   slotData,
+			ID:         existingAppointment.Data.ID,
+			PublicKey:  series.PublicKey,
+			SeriesID:   series.ID,
+		}
+
+		signedAppointment, err := appointment.Sign(signingKey)
+
+		if err != nil {
+			return err
+		}
+
+		// nothing has changed
+		if signedAppointment.JSON == existingAppointment.JSON {
+			continue
+		}
+
+		if err := c.storeAppointment(providerID, signedAppointment); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range planned {
+
+		appointment, err := services.MakeAppointment(t, series.Slots, series.Duration)
+
+		if err != nil {
+			return err
+		}
+
+		appointment.Properties = series.Properties
+		appointment.PublicKey = series.PublicKey
+		appointment.SeriesID = series.ID
+
+		signedAppointment, err := appointment.Sign(signingKey)
+
+		if err != nil {
+			return err
+		}
+
+		if err := c.storeAppointment(providerID, signedAppointment); err != nil {
+			return err
+		}
+
+		if err := occurrences.Set(t, appointment.ID); err != nil {
+			return err
+		}
+	}
+
+	series.ExpandedUntil = horizon
+
+	return c.backend.AppointmentSeries(providerID).Set(series)
+}
+
+// Rolls the appointment series of all confirmed providers forward to the
+// horizon as seen from the given time and returns the number of expanded
+// series. This is called periodically by the retention worker.
+func (c *Appointments) RollAppointmentSeries(now time.Time) (int64, error) {
+
+	providerKeys, err := c.backend.Keys("providers").GetAll()
+
+	if err != nil {
+		if err == databases.NotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var expanded int64
+
+	for _, providerKey := range providerKeys {
+		if n, err := c.rollProviderAppointmentSeries(providerKey.ID, now); err != nil {
+			return expanded, err
+		} else {
+			expanded += n
+		}
+	}
+
+	return expanded, nil
+}
+
+// Expands all series of the given provider whose horizon lies more than a
+// day in the past, so that appointments are generated on a rolling basis.
+// Returns the number of expanded series.
+func (c *Appointments) rollProviderAppointmentSeries(providerID []byte, now time.Time) (int64, error) {
+
+	if lock, err := c.backend.LockProvider(providerID); err != nil {
+		return 0, err
+	} else {
+		defer release(lock)
+	}
+
+	allSeries, err := c.backend.AppointmentSeries(providerID).GetAll()
+
+	if err != nil {
+		if err == databases.NotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	horizon := now.AddDate(0, 0, int(c.settings.SeriesHorizonDays)-1)
+
+	var expanded int64
+
+	for _, series := range allSeries {
+		if series.ExpandedUntil.After(horizon) || series.ExpandedUntil.After(series.End) {
+			continue
+		}
+		if err := c.expandAppointmentSeries(providerID, series, now); err != nil {
+			return expanded, err
+		}
+		expanded++
+	}
+
+	return expanded, nil
+}
+
+// Removes future appointments of the given series that have no bookings,
+// along with the series itself. The caller needs to hold the provider lock.
+func (c *Appointments) removeAppointmentSeries(providerID []byte, series *services.AppointmentSeries) error {
+
+	now := time.Now()
+	occurrences := c.backend.AppointmentSeriesOccurrences(providerID, series.ID)
+
+	existingOccurrences, err := occurrences.GetAll()
+
+	if err != nil {
+		return err
+	}
+
+	for t, id := range existingOccurrences {
+
+		if t.Before(now) {
+			continue
+		}
+
+		existingAppointment, _, err := c.getAppointmentByID(providerID, id)
+
+		if err == databases.NotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		// booked appointments stay in place
+		if len(existingAppointment.Bookings) > 0 {
+			continue
+		}
+
+		if err := c.deleteAppointment(providerID, id); err != nil {
+			return err
+		}
+
+		if err := occurrences.Del(t); err != nil {
+			return err
+		}
+	}
+
+	return c.backend.AppointmentSeries(providerID).Del(series.ID)
+}
+
+// Removes the given appointment along with its index entries.
+func (c *Appointments) deleteAppointment(providerID, id []byte) error {
+
+	appointmentDatesByID := c.backend.AppointmentDatesByID(providerID)
+
+	date, err := appointmentDatesByID.Get(id)
+
+	if err == databases.NotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	appointmentsByDate := c.backend.AppointmentsByDate(providerID, date)
+
+	if err := appointmentsByDate.Del(id); err != nil {
+		return err
+	}
+
+	if err := appointmentDatesByID.Del(id); err != nil {
+		return err
+	}
+
+	// if no appointments are left on the date we remove it from the index
+	if remainingAppointments, err := appointmentsByDate.GetAll(c.settings.Validate); err != nil {
+		return err
+	} else if len(remainingAppointments) == 0 {
+		return c.backend.AppointmentDates(providerID).Del(date)
+	}
+
+	return nil
+}
@@ -19,7 +19,6 @@
 package servers
 
 import (
-	"bytes"
 	"github.com/kiebitz-oss/services"
 	"github.com/kiebitz-oss/services/databases"
 	"time"
@@ -33,6 +32,14 @@ func (c *Appointments) isActiveProvider(context services.Context, id []byte) ser
 		}
 	}
 
+	// suspended providers are hidden from users
+	if suspended, err := c.backend.SuspendedProviders().Has(id); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if suspended {
+		return context.Error(404, "provider not found", nil)
+	}
+
 	return nil
 }
 
@@ -53,6 +60,22 @@ func (c *Appointments) bookAppointment(context services.Context, params *service
 	usedTokens := c.backend.UsedTokens()
 	token := params.Data.SignedTokenData.Data.Token
 
+	// we lock the token and the provider so that concurrent requests can
+	// neither reuse the token nor book the same slot twice
+	if lock, err := c.backend.LockToken(token); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		defer release(lock)
+	}
+
+	if lock, err := c.backend.LockProvider(params.Data.ProviderID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		defer release(lock)
+	}
+
 	if ok, err := usedTokens.Has(token); err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
@@ -79,42 +102,24 @@ func (c *Appointments) bookAppointment(context services.Context, params *service
 			return context.InternalError()
 		} else {
 			// we try to find an open slot
-			foundSlot := false
-			for _, slotData := range signedAppointment.Data.SlotData {
+			slotData := openSlot(signedAppointment)
 
-				found := false
-
-				for _, booking := range signedAppointment.Bookings {
-					if bytes.Equal(booking.ID, slotData.ID) {
-						found = true
-						break
-					}
-				}
-
-				if found {
-					continue
-				}
-
-				// this slot is open, we book it!
-
-				booking := &services.Booking{
-					PublicKey:     params.PublicKey,
-					ID:            slotData.ID,
-					Token:         token,
-					EncryptedData: params.Data.EncryptedData,
-				}
-
-				signedAppointment.Bookings = append(signedAppointment.Bookings, booking)
-				foundSlot = true
+			if slotData == nil {
+				return context.NotFound()
+			}
 
-				result = booking
+			// this slot is open, we book it!
 
-				break
+			booking := &services.Booking{
+				PublicKey:     params.PublicKey,
+				ID:            slotData.ID,
+				Token:         token,
+				EncryptedData: params.Data.EncryptedData,
 			}
 
-			if !foundSlot {
-				return context.NotFound()
-			}
+			signedAppointment.Bookings = append(signedAppointment.Bookings, booking)
+
+			result = booking
 
 			// we mark the token as used
 			if err := usedTokens.Add(token); err != nil {
@@ -122,6 +127,12 @@ func (c *Appointments) bookAppointment(context services.Context, params *service
 				return context.InternalError()
 			}
 
+			// we add the booking to the index of the token
+			if err := c.backend.BookedAppointments(token).Add(bookedAppointment(params.Data.ProviderID, signedAppointment, booking)); err != nil {
+				services.Log.Error(err)
+				return context.InternalError()
+			}
+
 			signedAppointment.UpdatedAt = time.Now()
 
 			if err := appointmentsByDate.Set(signedAppointment); err != nil {
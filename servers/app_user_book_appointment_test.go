@@ -0,0 +1,147 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/forms"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentBookAppointment(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		// we create a single appointment with a few slots
+		at.FC{af.Appointments{
+			N:        1,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    5,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	appointment := fixtures["appointments"].([]*services.SignedAppointment)[0]
+	providerID := crypto.Hash(provider.Actor.SigningKey.PublicKey)
+
+	users := make([]*helpers.User, 50)
+
+	for i := range users {
+		if user, err := (af.User{}).Setup(fixtures); err != nil {
+			t.Fatal(err)
+		} else {
+			users[i] = user.(*helpers.User)
+		}
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	// we start all requests at the same time to maximize contention
+	start := make(chan bool)
+
+	bookedSlots := map[string]bool{}
+	successes := 0
+
+	for _, user := range users {
+		// every user tries to book four times at the same time
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func(user *helpers.User) {
+				defer wg.Done()
+
+				<-start
+
+				resp, err := client.Appointments.BookAppointment(user, providerID, appointment)
+
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				if resp.StatusCode != 200 {
+					return
+				}
+
+				booking := &services.Booking{}
+
+				if err := resp.CoerceResult(booking, &forms.BookingForm); err != nil {
+					t.Error(err)
+					return
+				}
+
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				if bookedSlots[string(booking.ID)] {
+					t.Errorf("slot was booked twice")
+				}
+
+				bookedSlots[string(booking.ID)] = true
+				successes++
+
+			}(user)
+		}
+	}
+
+	close(start)
+	wg.Wait()
+
+	if successes != 5 || len(bookedSlots) != 5 {
+		t.Fatalf("expected 5 booked slots, got %d (%d successful bookings)", len(bookedSlots), successes)
+	}
+
+}
@@ -36,6 +36,13 @@ func (c *Appointments) cancelAppointment(context services.Context, params *servi
 		return resp
 	}
 
+	if lock, err := c.backend.LockProvider(params.Data.ProviderID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		defer release(lock)
+	}
+
 	appointmentDatesByID := c.backend.AppointmentDatesByID(params.Data.ProviderID)
 
 	if date, err := appointmentDatesByID.Get(params.Data.ID); err != nil {
@@ -53,16 +60,16 @@ func (c *Appointments) cancelAppointment(context services.Context, params *servi
 
 			token := params.Data.SignedTokenData.Data.Token
 
-			found := false
+			var cancelledBooking *services.Booking
 			for _, booking := range signedAppointment.Bookings {
 				if bytes.Equal(booking.Token, token) {
-					found = true
+					cancelledBooking = booking
 					continue
 				}
 				newBookings = append(newBookings, booking)
 			}
 
-			if !found {
+			if cancelledBooking == nil {
 				return context.NotFound()
 			}
 
@@ -76,8 +83,25 @@ func (c *Appointments) cancelAppointment(context services.Context, params *servi
 				return context.InternalError()
 			}
 
+			if err := c.backend.BookedAppointments(token).Del(cancelledBooking.ID); err != nil {
+				services.Log.Error(err)
+				return context.InternalError()
+			}
+
+			// if the booking was assigned through the waitlist we remove the entry
+			if err := c.backend.Waitlist(params.Data.ProviderID).Del(token); err != nil {
+				services.Log.Error(err)
+				return context.InternalError()
+			}
+
 			signedAppointment.UpdatedAt = time.Now()
 
+			// the freed slot goes to the next user on the waitlist
+			if _, err := c.assignWaitlistSlots(params.Data.ProviderID, signedAppointment); err != nil {
+				services.Log.Error(err)
+				return context.InternalError()
+			}
+
 			// we update the appointment
 			if err := appointmentsByDate.Set(signedAppointment); err != nil {
 				services.Log.Error(err)
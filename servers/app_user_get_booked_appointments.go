@@ -0,0 +1,105 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+)
+
+func (c *Appointments) getBookedAppointments(context services.Context, params *services.GetBookedAppointmentsSignedParams) services.Response {
+
+	if resp := c.isUser(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		ExtraData: params.Data.SignedTokenData,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		return resp
+	}
+
+	token := params.Data.SignedTokenData.Data.Token
+	index := c.backend.BookedAppointments(token)
+
+	indexedAppointments, err := index.GetAll()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	bookedAppointments := make([]*services.BookedAppointment, 0, len(indexedAppointments))
+
+	for _, bookedAppointment := range indexedAppointments {
+
+		// we verify the booking against the appointment itself
+		signedAppointment, err := c.getBookedAppointment(bookedAppointment, token)
+
+		if err != nil {
+			if err != databases.NotFound {
+				services.Log.Error(err)
+				return context.InternalError()
+			}
+			// the booking does not exist anymore, we remove it from the index
+			if err := index.Del(bookedAppointment.SlotID); err != nil {
+				services.Log.Error(err)
+				return context.InternalError()
+			}
+			continue
+		}
+
+		slots := make([]*services.Slot, len(signedAppointment.Bookings))
+
+		for i, booking := range signedAppointment.Bookings {
+			slots[i] = &services.Slot{ID: booking.ID}
+		}
+
+		// we remove the bookings as the user is not allowed to see them
+		signedAppointment.Bookings = nil
+		signedAppointment.BookedSlots = slots
+
+		bookedAppointment.Timestamp = signedAppointment.Data.Timestamp
+		bookedAppointment.Appointment = signedAppointment
+
+		bookedAppointments = append(bookedAppointments, bookedAppointment)
+	}
+
+	return context.Result(bookedAppointments)
+}
+
+// Returns the appointment of the given index entry, making sure that the
+// slot is still booked with the given token.
+func (c *Appointments) getBookedAppointment(bookedAppointment *services.BookedAppointment, token []byte) (*services.SignedAppointment, error) {
+
+	signedAppointment, _, err := c.getAppointmentByID(bookedAppointment.ProviderID, bookedAppointment.AppointmentID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, booking := range signedAppointment.Bookings {
+		if bytes.Equal(booking.ID, bookedAppointment.SlotID) && bytes.Equal(booking.Token, token) {
+			return signedAppointment, nil
+		}
+	}
+
+	return nil, databases.NotFound
+}
@@ -0,0 +1,167 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func getBookedAppointments(t *testing.T, client *helpers.Client, user *helpers.User) []*services.BookedAppointment {
+
+	resp, err := client.Appointments.GetBookedAppointments(user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Result []*services.BookedAppointment `json:"result"`
+	}
+
+	if data, err := resp.Bytes(); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	return result.Result
+}
+
+func TestGetBookedAppointments(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		// we create a single appointment with a single slot
+		at.FC{af.Appointments{
+			N:        1,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    1,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+
+		// we create a user
+		at.FC{af.User{}, "user"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	user := fixtures["user"].(*helpers.User)
+	appointment := fixtures["appointments"].([]*services.SignedAppointment)[0]
+	providerID := crypto.Hash(provider.Actor.SigningKey.PublicKey)
+
+	if bookedAppointments := getBookedAppointments(t, client, user); len(bookedAppointments) != 0 {
+		t.Fatalf("expected no booked appointments, got %d", len(bookedAppointments))
+	}
+
+	if resp, err := client.Appointments.BookAppointment(user, providerID, appointment); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	bookedAppointments := getBookedAppointments(t, client, user)
+
+	if len(bookedAppointments) != 1 {
+		t.Fatalf("expected one booked appointment, got %d", len(bookedAppointments))
+	}
+
+	bookedAppointment := bookedAppointments[0]
+
+	if !bytes.Equal(bookedAppointment.ProviderID, providerID) ||
+		!bytes.Equal(bookedAppointment.AppointmentID, appointment.Data.ID) ||
+		!bytes.Equal(bookedAppointment.SlotID, appointment.Data.SlotData[0].ID) {
+		t.Fatalf("booked appointment does not match the booking")
+	}
+
+	if bookedAppointment.Appointment == nil || bookedAppointment.Appointment.Signature == nil {
+		t.Fatalf("expected the signed appointment")
+	}
+
+	// the provider moves the appointment to another time
+	appointment.Data.Timestamp = af.TS("2022-10-02T12:00:00Z")
+
+	if signedAppointment, err := appointment.Data.Sign(provider.Actor.SigningKey); err != nil {
+		t.Fatal(err)
+	} else if resp, err := client.Appointments.PublishAppointments(&services.PublishAppointmentsParams{
+		Timestamp:    time.Now(),
+		Appointments: []*services.SignedAppointment{signedAppointment},
+	}, provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	if bookedAppointments := getBookedAppointments(t, client, user); len(bookedAppointments) != 1 {
+		t.Fatalf("expected one booked appointment, got %d", len(bookedAppointments))
+	} else if !bookedAppointments[0].Timestamp.Equal(appointment.Data.Timestamp) {
+		t.Fatalf("expected the new time of the appointment")
+	}
+
+	if resp, err := client.Appointments.CancelAppointment(user, providerID, appointment); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	if bookedAppointments := getBookedAppointments(t, client, user); len(bookedAppointments) != 0 {
+		t.Fatalf("expected no booked appointments, got %d", len(bookedAppointments))
+	}
+}
@@ -0,0 +1,145 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"sort"
+	"time"
+)
+
+func (c *Appointments) joinWaitlist(context services.Context, params *services.JoinWaitlistSignedParams) services.Response {
+
+	if resp := c.isUser(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		ExtraData: params.Data.SignedTokenData,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		return resp
+	}
+
+	usedTokens := c.backend.UsedTokens()
+	tokenData := params.Data.SignedTokenData.Data
+	token := tokenData.Token
+
+	// we lock the token and the provider in the same order as when booking
+	if lock, err := c.backend.LockToken(token); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		defer release(lock)
+	}
+
+	if lock, err := c.backend.LockProvider(params.Data.ProviderID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		defer release(lock)
+	}
+
+	if ok, err := usedTokens.Has(token); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if ok {
+		return context.Error(401, "not authorized", nil)
+	}
+
+	if res := c.isActiveProvider(context, params.Data.ProviderID); res != nil {
+		return res
+	}
+
+	entry := &services.WaitlistEntry{
+		Token:         token,
+		PublicKey:     params.PublicKey,
+		From:          params.Data.From,
+		To:            params.Data.To,
+		EncryptedData: params.Data.EncryptedData,
+		CreatedAt:     time.Now(),
+	}
+
+	// tokens with a lower number have been issued earlier and take precedence
+	if tokenData.Data != nil {
+		entry.N = tokenData.Data.N
+	}
+
+	waitlist := c.backend.Waitlist(params.Data.ProviderID)
+
+	if err := waitlist.Add(entry); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// the token is reserved while the user is on the waitlist, so it can't be
+	// used for another booking in the meantime
+	if err := usedTokens.Add(token); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// there might already be free slots in the requested time window
+	dates, err := c.backend.AppointmentDates(params.Data.ProviderID).Range(params.Data.From.Truncate(24*time.Hour), params.Data.To)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	for _, date := range dates {
+
+		appointmentsByDate := c.backend.AppointmentsByDate(params.Data.ProviderID, date)
+		allAppointments, err := appointmentsByDate.GetAll(c.settings.Validate)
+
+		if err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+
+		signedAppointments := make([]*services.SignedAppointment, 0, len(allAppointments))
+
+		for _, signedAppointment := range allAppointments {
+			signedAppointments = append(signedAppointments, signedAppointment)
+		}
+
+		// we fill the earliest appointments first
+		sort.Slice(signedAppointments, func(i, j int) bool {
+			return signedAppointments[i].Data.Timestamp.Before(signedAppointments[j].Data.Timestamp)
+		})
+
+		for _, signedAppointment := range signedAppointments {
+			if assigned, err := c.assignWaitlistSlots(params.Data.ProviderID, signedAppointment); err != nil {
+				services.Log.Error(err)
+				return context.InternalError()
+			} else if assigned {
+				if err := appointmentsByDate.Set(signedAppointment); err != nil {
+					services.Log.Error(err)
+					return context.InternalError()
+				}
+			}
+		}
+	}
+
+	if entry, err := c.getWaitlistEntry(params.Data.ProviderID, token); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		return context.Result(entry)
+	}
+}
@@ -0,0 +1,238 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"bytes"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/forms"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func getWaitlistEntry(t *testing.T, client *helpers.Client, user *helpers.User, providerID []byte) *services.WaitlistEntry {
+
+	resp, err := client.Appointments.GetWaitlist(user, providerID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	entry := &services.WaitlistEntry{}
+
+	if err := resp.CoerceResult(entry, &forms.WaitlistEntryForm); err != nil {
+		t.Fatal(err)
+	}
+
+	return entry
+}
+
+// JSON-RPC errors are returned with a generic status code, so we need to
+// look at the error code in the response
+func errorCode(t *testing.T, resp *helpers.Response) int {
+
+	value, err := resp.JSON()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errorValue, ok := value["error"].(map[string]interface{}); ok {
+		if code, ok := errorValue["code"].(float64); ok {
+			return int(code)
+		}
+	}
+
+	return 0
+}
+
+func TestWaitlist(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		// we create a single appointment with a single slot
+		at.FC{af.Appointments{
+			N:        1,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    1,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	appointment := fixtures["appointments"].([]*services.SignedAppointment)[0]
+	providerID := crypto.Hash(provider.Actor.SigningKey.PublicKey)
+	encryptionKey := provider.Actor.EncryptionKey.PublicKey
+
+	// users are created in order, so earlier users have a higher priority
+	users := make([]*helpers.User, 4)
+
+	for i := range users {
+		if user, err := (af.User{}).Setup(fixtures); err != nil {
+			t.Fatal(err)
+		} else {
+			users[i] = user.(*helpers.User)
+		}
+	}
+
+	if resp, err := client.Appointments.BookAppointment(users[0], providerID, appointment); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.BookAppointment(users[1], providerID, appointment); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 404 {
+		t.Fatalf("expected a 404 error code, got %d", code)
+	}
+
+	from := af.TS("2022-10-01T00:00:00Z")
+	to := af.TS("2022-10-02T00:00:00Z")
+
+	// users with a lower priority join the waitlist first
+	for _, user := range []*helpers.User{users[3], users[2], users[1]} {
+		if resp, err := client.Appointments.JoinWaitlist(user, providerID, encryptionKey, from, to); err != nil {
+			t.Fatal(err)
+		} else if resp.StatusCode != 200 {
+			t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+		}
+	}
+
+	// the token is reserved while waiting
+	if resp, err := client.Appointments.JoinWaitlist(users[1], providerID, encryptionKey, from, to); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 401 {
+		t.Fatalf("expected a 401 error code, got %d", code)
+	}
+
+	for i, user := range users[1:] {
+		if entry := getWaitlistEntry(t, client, user, providerID); entry.Position != int64(i+1) {
+			t.Fatalf("expected position %d, got %d", i+1, entry.Position)
+		}
+	}
+
+	if resp, err := client.Appointments.CancelAppointment(users[0], providerID, appointment); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	// the user with the highest priority gets the freed slot
+	if entry := getWaitlistEntry(t, client, users[1], providerID); entry.Position != 0 {
+		t.Fatalf("expected position 0, got %d", entry.Position)
+	} else if !bytes.Equal(entry.AppointmentID, appointment.Data.ID) {
+		t.Fatalf("expected a booking for the appointment")
+	}
+
+	if entry := getWaitlistEntry(t, client, users[2], providerID); entry.Position != 1 {
+		t.Fatalf("expected position 1, got %d", entry.Position)
+	}
+
+	// a user that was booked automatically can't leave the waitlist anymore
+	if resp, err := client.Appointments.LeaveWaitlist(users[1], providerID); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 409 {
+		t.Fatalf("expected a 409 error code, got %d", code)
+	}
+
+	if resp, err := client.Appointments.LeaveWaitlist(users[3], providerID); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.GetWaitlist(users[3], providerID); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 404 {
+		t.Fatalf("expected a 404 error code, got %d", code)
+	}
+
+	// the token has been released, so the user can join again
+	if resp, err := client.Appointments.JoinWaitlist(users[3], providerID, encryptionKey, from, to); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	// publishing an additional slot assigns it to the next user
+	if id, err := crypto.RandomBytes(32); err != nil {
+		t.Fatal(err)
+	} else {
+		appointment.Data.SlotData = append(appointment.Data.SlotData, &services.Slot{ID: id})
+	}
+
+	if signedAppointment, err := appointment.Data.Sign(provider.Actor.SigningKey); err != nil {
+		t.Fatal(err)
+	} else if resp, err := client.Appointments.PublishAppointments(&services.PublishAppointmentsParams{
+		Timestamp:    time.Now(),
+		Appointments: []*services.SignedAppointment{signedAppointment},
+	}, provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	if entry := getWaitlistEntry(t, client, users[2], providerID); entry.Position != 0 {
+		t.Fatalf("expected position 0, got %d", entry.Position)
+	}
+
+	if entry := getWaitlistEntry(t, client, users[3], providerID); entry.Position != 1 {
+		t.Fatalf("expected position 1, got %d", entry.Position)
+	}
+}
@@ -0,0 +1,205 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+	"time"
+)
+
+func (c *Appointments) rescheduleAppointment(context services.Context, params *services.RescheduleAppointmentSignedParams) services.Response {
+
+	if resp := c.isUser(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		ExtraData: params.Data.SignedTokenData,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		return resp
+	}
+
+	providerID, newProviderID := params.Data.ProviderID, params.Data.NewProviderID
+
+	if bytes.Equal(providerID, newProviderID) && bytes.Equal(params.Data.ID, params.Data.NewID) {
+		return context.Error(400, "cannot reschedule to the same appointment", nil)
+	}
+
+	token := params.Data.SignedTokenData.Data.Token
+
+	// the token stays locked during the whole operation, so it can't be used
+	// by another request while the booking is moved
+	if lock, err := c.backend.LockToken(token); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		defer release(lock)
+	}
+
+	// we always lock providers in the same order to avoid deadlocks
+	providerIDs := [][]byte{providerID}
+
+	if cmp := bytes.Compare(providerID, newProviderID); cmp < 0 {
+		providerIDs = append(providerIDs, newProviderID)
+	} else if cmp > 0 {
+		providerIDs = [][]byte{newProviderID, providerID}
+	}
+
+	for _, id := range providerIDs {
+		if lock, err := c.backend.LockProvider(id); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		} else {
+			defer release(lock)
+		}
+	}
+
+	// test if provider of the new appointment is still active
+	if res := c.isActiveProvider(context, newProviderID); res != nil {
+		return res
+	}
+
+	appointment, appointmentsByDate, err := c.getAppointmentByID(providerID, params.Data.ID)
+
+	if err != nil {
+		if err == databases.NotFound {
+			return context.NotFound()
+		}
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	var oldBooking *services.Booking
+	oldBookings := make([]*services.Booking, 0)
+
+	for _, booking := range appointment.Bookings {
+		if bytes.Equal(booking.Token, token) {
+			oldBooking = booking
+			continue
+		}
+		oldBookings = append(oldBookings, booking)
+	}
+
+	if oldBooking == nil {
+		return context.NotFound()
+	}
+
+	newAppointment, newAppointmentsByDate, err := c.getAppointmentByID(newProviderID, params.Data.NewID)
+
+	if err != nil {
+		if err == databases.NotFound {
+			return context.NotFound()
+		}
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	slotData := openSlot(newAppointment)
+
+	// nothing has been changed yet, so the old booking remains as it is
+	if slotData == nil {
+		return context.NotFound()
+	}
+
+	newBooking := &services.Booking{
+		PublicKey:     params.PublicKey,
+		ID:            slotData.ID,
+		Token:         token,
+		EncryptedData: params.Data.EncryptedData,
+	}
+
+	newBookings := newAppointment.Bookings
+	newAppointment.Bookings = append(newBookings, newBooking)
+	newAppointment.UpdatedAt = time.Now()
+
+	if err := newAppointmentsByDate.Set(newAppointment); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	appointment.Bookings = oldBookings
+	appointment.UpdatedAt = time.Now()
+
+	// the freed slot goes to the next user on the waitlist
+	if _, err := c.assignWaitlistSlots(providerID, appointment); err != nil {
+		services.Log.Error(err)
+		return c.rollbackReschedule(context, newAppointmentsByDate, newAppointment, newBookings)
+	}
+
+	if err := appointmentsByDate.Set(appointment); err != nil {
+		services.Log.Error(err)
+		return c.rollbackReschedule(context, newAppointmentsByDate, newAppointment, newBookings)
+	}
+
+	bookedAppointments := c.backend.BookedAppointments(token)
+
+	if err := bookedAppointments.Del(oldBooking.ID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := bookedAppointments.Add(bookedAppointment(newProviderID, newAppointment, newBooking)); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// if the old booking was assigned through the waitlist we remove the entry
+	if err := c.backend.Waitlist(providerID).Del(token); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Result(newBooking)
+}
+
+// Restores the bookings of the new appointment if the old one could not be
+// updated, so that the user does not end up with two bookings.
+func (c *Appointments) rollbackReschedule(context services.Context, appointmentsByDate *AppointmentsByDate, appointment *services.SignedAppointment, bookings []*services.Booking) services.Response {
+
+	appointment.Bookings = bookings
+	appointment.UpdatedAt = time.Now()
+
+	if err := appointmentsByDate.Set(appointment); err != nil {
+		services.Log.Error(err)
+	}
+
+	return context.InternalError()
+}
+
+// Returns the appointment with the given ID along with the map it is stored in.
+func (c *Appointments) getAppointmentByID(providerID, id []byte) (*services.SignedAppointment, *AppointmentsByDate, error) {
+
+	date, err := c.backend.AppointmentDatesByID(providerID).Get(id)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	appointmentsByDate := c.backend.AppointmentsByDate(providerID, date)
+
+	signedAppointment, err := appointmentsByDate.Get(c.settings.Validate, id)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return signedAppointment, appointmentsByDate, nil
+}
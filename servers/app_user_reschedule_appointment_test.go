@@ -0,0 +1,144 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"bytes"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/forms"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+)
+
+func TestRescheduleAppointment(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		// we create a few appointments with a single slot each
+		at.FC{af.Appointments{
+			N:        3,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    1,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+
+		// we create two users
+		at.FC{af.User{}, "user"},
+		at.FC{af.User{}, "otherUser"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	user := fixtures["user"].(*helpers.User)
+	otherUser := fixtures["otherUser"].(*helpers.User)
+	appointments := fixtures["appointments"].([]*services.SignedAppointment)
+	providerID := crypto.Hash(provider.Actor.SigningKey.PublicKey)
+
+	if resp, err := client.Appointments.BookAppointment(user, providerID, appointments[0]); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.BookAppointment(otherUser, providerID, appointments[1]); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	// the target appointment is fully booked, so nothing should change
+	if resp, err := client.Appointments.RescheduleAppointment(user, providerID, appointments[0], providerID, appointments[1]); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 404 {
+		t.Fatalf("expected a 404 error code, got %d", code)
+	}
+
+	if bookedAppointments := getBookedAppointments(t, client, user); len(bookedAppointments) != 1 {
+		t.Fatalf("expected one booked appointment, got %d", len(bookedAppointments))
+	} else if !bytes.Equal(bookedAppointments[0].AppointmentID, appointments[0].Data.ID) {
+		t.Fatalf("expected the original booking to be preserved")
+	}
+
+	booking := &services.Booking{}
+
+	if resp, err := client.Appointments.RescheduleAppointment(user, providerID, appointments[0], providerID, appointments[2]); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	} else if err := resp.CoerceResult(booking, &forms.BookingForm); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(booking.ID, appointments[2].Data.SlotData[0].ID) {
+		t.Fatalf("expected a booking for the new appointment")
+	}
+
+	if bookedAppointments := getBookedAppointments(t, client, user); len(bookedAppointments) != 1 {
+		t.Fatalf("expected one booked appointment, got %d", len(bookedAppointments))
+	} else if !bytes.Equal(bookedAppointments[0].AppointmentID, appointments[2].Data.ID) {
+		t.Fatalf("expected the booking to be moved")
+	}
+
+	// the old slot is free again...
+	if resp, err := client.Appointments.RescheduleAppointment(otherUser, providerID, appointments[1], providerID, appointments[0]); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	// ...while the token is still in use
+	if resp, err := client.Appointments.BookAppointment(user, providerID, appointments[1]); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 401 {
+		t.Fatalf("expected a 401 error code, got %d", code)
+	}
+}
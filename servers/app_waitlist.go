@@ -0,0 +1,112 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"time"
+)
+
+// Assigns open slots of the given appointment to waiting users in order of
+// their priority, using the encrypted data they provided when joining the
+// waitlist. The caller needs to hold the provider lock and to store the
+// appointment if any slots were assigned.
+func (c *Appointments) assignWaitlistSlots(providerID []byte, signedAppointment *services.SignedAppointment) (bool, error) {
+
+	if openSlot(signedAppointment) == nil {
+		return false, nil
+	}
+
+	waitlist := c.backend.Waitlist(providerID)
+
+	entries, err := waitlist.Waiting()
+
+	if err != nil {
+		return false, err
+	}
+
+	assigned := false
+	timestamp := signedAppointment.Data.Timestamp
+
+	for _, entry := range entries {
+
+		if timestamp.Before(entry.From) || timestamp.After(entry.To) {
+			continue
+		}
+
+		slotData := openSlot(signedAppointment)
+
+		if slotData == nil {
+			break
+		}
+
+		// the token has been marked as used when the user joined the
+		// waitlist, so we can book the slot right away
+		booking := &services.Booking{
+			PublicKey:     entry.PublicKey,
+			ID:            slotData.ID,
+			Token:         entry.Token,
+			EncryptedData: entry.EncryptedData,
+		}
+
+		signedAppointment.Bookings = append(signedAppointment.Bookings, booking)
+
+		if err := c.backend.BookedAppointments(entry.Token).Add(bookedAppointment(providerID, signedAppointment, booking)); err != nil {
+			return false, err
+		}
+
+		entry.AppointmentID = signedAppointment.Data.ID
+
+		if err := waitlist.Set(entry); err != nil {
+			return false, err
+		}
+
+		if err := waitlist.Dequeue(entry.Token); err != nil {
+			return false, err
+		}
+
+		assigned = true
+	}
+
+	if assigned {
+		signedAppointment.UpdatedAt = time.Now()
+	}
+
+	return assigned, nil
+}
+
+// Returns the waitlist entry of the given token, including its position.
+func (c *Appointments) getWaitlistEntry(providerID, token []byte) (*services.WaitlistEntry, error) {
+
+	waitlist := c.backend.Waitlist(providerID)
+
+	entry, err := waitlist.Get(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.AppointmentID == nil {
+		if entry.Position, err = waitlist.Position(token); err != nil {
+			return nil, err
+		}
+	}
+
+	return entry, nil
+}
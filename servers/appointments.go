@@ -20,10 +20,13 @@ package servers
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"fmt"
 	"github.com/kiebitz-oss/services"
 	"github.com/kiebitz-oss/services/api"
 	"github.com/kiebitz-oss/services/crypto"
 	"github.com/kiebitz-oss/services/forms"
+	"time"
 )
 
 // time windows for statistics generation
@@ -43,6 +46,9 @@ type Appointments struct {
 	meter    services.Meter
 	settings *services.AppointmentsSettings
 	test     bool
+	// used to stop the retention worker
+	stopRetention    chan bool
+	retentionStopped chan bool
 }
 
 func MakeAppointments(settings *services.Settings) (*Appointments, error) {
@@ -55,7 +61,19 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 		test:     settings.Test,
 	}
 
-	api := &api.API{
+	var err error
+
+	if appointments.Server, err = MakeServer("appointments", settings.Appointments.HTTP, settings.Appointments.JSONRPC, settings.Appointments.REST, settings.Appointments.Validate, appointmentsAPI(appointments)); err != nil {
+		return nil, err
+	}
+
+	return appointments, nil
+}
+
+// Returns the API of the appointments server, which is also used to generate the
+// OpenAPI specification (for which no database is required).
+func appointmentsAPI(appointments *Appointments) *api.API {
+	return &api.API{
 		Version: 1,
 		Name:    "appointments",
 		Endpoints: []*api.Endpoint{
@@ -176,6 +194,32 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 					Method: api.POST,
 				},
 			},
+			{
+				Name:        "revokeMediatorPublicKey", // authenticated (root)
+				Description: "Revokes the key of a mediator. Providers confirmed by the mediator are flagged and need to be confirmed again.",
+				Form:        &forms.RevokeMediatorPublicKeyForm,
+				Handler:     appointments.revokeMediatorPublicKey,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "mediators/revoke",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "getAuditLog", // authenticated (root)
+				Description: "Returns entries of the audit log, which records privileged operations of root and mediators.",
+				Form:        &forms.GetAuditLogForm,
+				Handler:     appointments.getAuditLog,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetAuditLogRVV,
+				},
+				REST: &api.REST{
+					Path:   "audit",
+					Method: api.POST,
+				},
+			},
 			{
 				Name:        "addCodes", // authenticated (root)
 				Description: "Adds signup codes to the system.",
@@ -254,6 +298,45 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 					Method: api.POST,
 				},
 			},
+			{
+				Name:        "suspendProvider", // authenticated (mediator)
+				Description: "Suspends a provider, hiding it from users and blocking it from publishing appointments.",
+				Form:        &forms.SuspendProviderForm,
+				Handler:     appointments.suspendProvider,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/suspend",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "reactivateProvider", // authenticated (mediator)
+				Description: "Reactivates a suspended provider.",
+				Form:        &forms.ReactivateProviderForm,
+				Handler:     appointments.reactivateProvider,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/reactivate",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "deleteProvider", // authenticated (mediator)
+				Description: "Permanently deletes a provider along with its appointments, releasing the tokens of all booked users.",
+				Form:        &forms.DeleteProviderForm,
+				Handler:     appointments.deleteProvider,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/delete",
+					Method: api.POST,
+				},
+			},
 			{
 				Name:        "getProviderAppointments", // authenticated (provider)
 				Description: "Returns a list of appointments for the given provider.",
@@ -280,6 +363,58 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 					Method: api.POST,
 				},
 			},
+			{
+				Name:        "publishAppointmentSeries", // authenticated (provider)
+				Description: "Publishes a new or modified appointment series, which is expanded into appointments on a rolling basis.",
+				Form:        &forms.PublishAppointmentSeriesForm,
+				Handler:     appointments.publishAppointmentSeries,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "appointments/series/publish",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "getAppointmentSeries", // authenticated (provider)
+				Description: "Returns all appointment series of the provider.",
+				Form:        &forms.GetAppointmentSeriesForm,
+				Handler:     appointments.getAppointmentSeries,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetAppointmentSeriesRVV,
+				},
+				REST: &api.REST{
+					Path:   "appointments/series",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "deleteAppointmentSeries", // authenticated (provider)
+				Description: "Deletes an appointment series along with its future appointments that have no bookings.",
+				Form:        &forms.DeleteAppointmentSeriesForm,
+				Handler:     appointments.deleteAppointmentSeries,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "appointments/series/delete",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "cancelBooking", // authenticated (provider)
+				Description: "Cancels a booking of one of the provider's appointments, with an encrypted reason for the user.",
+				Form:        &forms.CancelBookingForm,
+				Handler:     appointments.cancelBooking,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "appointments/bookings/cancel",
+					Method: api.POST,
+				},
+			},
 			{
 				Name:        "storeProviderData", // authenticated (provider)
 				Description: "Stores provider data for verification.",
@@ -319,6 +454,84 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 					Method: api.POST,
 				},
 			},
+			{
+				Name:        "rescheduleAppointment", // authenticated (user)
+				Description: "Moves a booking to another appointment in a single operation.",
+				Form:        &forms.RescheduleAppointmentForm,
+				Handler:     appointments.rescheduleAppointment,
+				ReturnType: &api.ReturnType{
+					Validators: forms.BookAppointmentRVV,
+				},
+				REST: &api.REST{
+					Path:   "appointments/reschedule",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "getBookedAppointments", // authenticated (user)
+				Description: "Returns the appointments booked with the token of the user.",
+				Form:        &forms.GetBookedAppointmentsForm,
+				Handler:     appointments.getBookedAppointments,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetBookedAppointmentsRVV,
+				},
+				REST: &api.REST{
+					Path:   "appointments/booked",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "getBookingCancellations", // authenticated (user)
+				Description: "Returns the bookings of the user that have been cancelled by providers.",
+				Form:        &forms.GetBookingCancellationsForm,
+				Handler:     appointments.getBookingCancellations,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetBookingCancellationsRVV,
+				},
+				REST: &api.REST{
+					Path:   "appointments/cancellations",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "joinWaitlist", // authenticated (user)
+				Description: "Adds the user to the waitlist of a provider. Free slots in the given time window are booked automatically.",
+				Form:        &forms.JoinWaitlistForm,
+				Handler:     appointments.joinWaitlist,
+				ReturnType: &api.ReturnType{
+					Validators: forms.WaitlistEntryRVV,
+				},
+				REST: &api.REST{
+					Path:   "waitlist/join",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "getWaitlist", // authenticated (user)
+				Description: "Returns the waitlist entry of the user, including its position or the assigned appointment.",
+				Form:        &forms.GetWaitlistForm,
+				Handler:     appointments.getWaitlist,
+				ReturnType: &api.ReturnType{
+					Validators: forms.WaitlistEntryRVV,
+				},
+				REST: &api.REST{
+					Path:   "waitlist",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "leaveWaitlist", // authenticated (user)
+				Description: "Removes the user from the waitlist of a provider.",
+				Form:        &forms.LeaveWaitlistForm,
+				Handler:     appointments.leaveWaitlist,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "waitlist/leave",
+					Method: api.POST,
+				},
+			},
 			{
 				Name:        "cancelAppointment", // authenticated (user)
 				Description: "Cancels a booking.",
@@ -334,14 +547,61 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 			},
 		},
 	}
+}
 
-	var err error
+// Returns the OpenAPI specification of the appointments server
+func AppointmentsSpec() *api.Spec {
+	return appointmentsAPI(&Appointments{}).OpenAPI()
+}
 
-	if appointments.Server, err = MakeServer("appointments", settings.Appointments.HTTP, settings.Appointments.JSONRPC, settings.Appointments.REST, settings.Appointments.Validate, api); err != nil {
-		return nil, err
+// Starts the server along with the retention worker
+func (c *Appointments) Start() error {
+	// the secret signs search cursors and must not be predictable. Older
+	// configurations do not contain one, so we derive it from the private
+	// keys, which all instances of the service share.
+	if len(c.settings.Secret) == 0 {
+		if c.settings.Secret = deriveSecret(c.settings.Keys); c.settings.Secret == nil {
+			return fmt.Errorf("appointments secret missing and no private keys to derive it from")
+		}
+		services.Log.Warning("No appointments secret configured, deriving it from the private keys.")
+	}
+	// the service cannot work without a currently valid version of these keys
+	for _, name := range []string{"root", "token", "provider"} {
+		if c.settings.Key(name) == nil {
+			return fmt.Errorf("no currently valid %s key", name)
+		}
+	}
+	if err := c.migrateIndexes(); err != nil {
+		return err
 	}
+	if err := c.Server.Start(); err != nil {
+		return err
+	}
+	c.startRetentionWorker()
+	return nil
+}
 
-	return appointments, nil
+func (c *Appointments) Stop() error {
+	c.stopRetentionWorker()
+	return c.Server.Stop()
+}
+
+// Derives a secret from the private keys in the given list, or returns nil if
+// the list does not contain any private keys.
+func deriveSecret(keys []*crypto.Key) []byte {
+	h := sha256.New()
+	h.Write([]byte("appointments secret"))
+	found := false
+	for _, key := range keys {
+		if key.PrivateKey != nil {
+			h.Write(key.PrivateKey)
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return h.Sum(nil)
 }
 
 // Method Handlers
@@ -352,14 +612,73 @@ func (c *Appointments) Key(key string) *crypto.Key {
 
 func (c *Appointments) getKeysData() (*services.Keys, error) {
 
-	providerDataKey := c.settings.Key("provider")
+	// all versions of a key may have expired since the server was started
+	providerDataKey, rootKey, tokenKey := c.settings.Key("provider"), c.settings.Key("root"), c.settings.Key("token")
 
-	return &services.Keys{
-		ProviderData: providerDataKey.PublicKey,
-		RootKey:      c.settings.Key("root").PublicKey,
-		TokenKey:     c.settings.Key("token").PublicKey,
-	}, nil
+	if providerDataKey == nil || rootKey == nil || tokenKey == nil {
+		return nil, fmt.Errorf("provider, root or token key missing")
+	}
+
+	revokedMediators, err := c.backend.Keys("revokedMediators").GetAll()
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &services.Keys{
+		ProviderData:     providerDataKey.PublicKey,
+		RootKey:          rootKey.PublicKey,
+		TokenKey:         tokenKey.PublicKey,
+		Versions:         c.keyVersions("provider", "root", "token", "appointment"),
+		RevokedMediators: revokedMediators,
+	}
+
+	// the appointment key is only required if series are used
+	if appointmentKey := c.settings.Key("appointment"); appointmentKey != nil {
+		keys.AppointmentKey = appointmentKey.PublicKey
+	}
+
+	return keys, nil
+
+}
+
+// Returns all versions of the given keys along with their status
+func (c *Appointments) keyVersions(names ...string) []*services.KeyVersion {
+
+	now := time.Now()
+	versions := []*services.KeyVersion{}
+
+	for _, name := range names {
+
+		current := c.settings.Key(name)
 
+		for _, key := range c.settings.Keys {
+
+			if key.Name != name {
+				continue
+			}
+
+			status := services.KeyValid
+
+			if key == current {
+				status = services.KeyCurrent
+			} else if key.ValidFrom != nil && now.Before(*key.ValidFrom) {
+				status = services.KeyPending
+			} else if !key.ValidAt(now) {
+				status = services.KeyRetired
+			}
+
+			versions = append(versions, &services.KeyVersion{
+				Name:       key.Name,
+				PublicKey:  key.PublicKey,
+				ValidFrom:  key.ValidFrom,
+				ValidUntil: key.ValidUntil,
+				Status:     status,
+			})
+		}
+	}
+
+	return versions
 }
 
 func (c *Appointments) getActorKeys() (*services.KeyLists, error) {
@@ -382,13 +701,60 @@ func (c *Appointments) getActorKeys() (*services.KeyLists, error) {
 	}, nil
 }
 
+// Returns all providers within the given radius around the zip code along
+// with the distance of their zip code, which serves as their sort key.
+func (c *Appointments) getProvidersNearZipCode(zipCode string, radius int64) ([]*searchCandidate, error) {
+
+	providersByZipCode := c.backend.ProvidersByZipCode()
+
+	// the zip code itself always comes first
+	providerIDs, err := providersByZipCode.Get(zipCode)
+
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]*searchCandidate, 0, len(providerIDs))
+
+	for _, providerID := range providerIDs {
+		candidates = append(candidates, &searchCandidate{ZipCode: zipCode, ID: providerID})
+	}
+
+	// get all neighboring zip codes within the radius, sorted by distance
+	neighbors, err := c.backend.Neighbors("zipCode", zipCode).RangeByScore(0, radius)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, neighbor := range neighbors {
+		if string(neighbor.Data) == zipCode {
+			continue
+		}
+		if neighborIDs, err := providersByZipCode.Get(string(neighbor.Data)); err != nil {
+			return nil, err
+		} else {
+			for _, providerID := range neighborIDs {
+				candidates = append(candidates, &searchCandidate{
+					SortKey: neighbor.Score,
+					ZipCode: string(neighbor.Data),
+					ID:      providerID,
+				})
+			}
+		}
+	}
+
+	return candidates, nil
+}
+
 // authentication helpers
 
 func (c *Appointments) isUser(context services.Context, params *services.SignedParams) services.Response {
 
-	tokenKey := c.settings.Key("token")
+	// tokens remain valid as long as the key version they were signed with
+	tokenKeys := c.settings.ValidKeys("token")
 
-	if tokenKey == nil {
+	if len(tokenKeys) == 0 {
 		services.Log.Error("token key missing")
 		return context.InternalError()
 	}
@@ -400,11 +766,20 @@ func (c *Appointments) isUser(context services.Context, params *services.SignedP
 		Signature: signedTokenData.Signature,
 	}
 
-	// first we verify the signed token against the token key
-	if ok, err := tokenKey.VerifyString(signedData); err != nil {
-		services.Log.Error(err)
-		return context.InternalError()
-	} else if !ok {
+	// first we verify the signed token against the token keys
+	validToken := false
+
+	for _, tokenKey := range tokenKeys {
+		if ok, err := tokenKey.VerifyString(signedData); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		} else if ok {
+			validToken = true
+			break
+		}
+	}
+
+	if !validToken {
 		return context.Error(400, "invalid token", nil)
 	}
 
@@ -421,16 +796,12 @@ func (c *Appointments) isUser(context services.Context, params *services.SignedP
 		return context.Error(400, "invalid signature", nil)
 	}
 
-	if expired(params.Timestamp) {
-		return context.Error(410, "signature expired", nil)
-	}
-
-	return nil
+	return isFresh(context, c.db, []byte(params.JSON), params.PublicKey, params.Timestamp)
 
 }
 
 func (c *Appointments) isRoot(context services.Context, params *services.SignedParams) services.Response {
-	return isRoot(context, []byte(params.JSON), params.Signature, params.Timestamp, c.settings.Keys)
+	return isRoot(context, c.db, []byte(params.JSON), params.Signature, params.Timestamp, c.settings.Keys)
 }
 
 func (c *Appointments) isMediator(context services.Context, params *services.SignedParams) (services.Response, *services.ActorKey) {
@@ -444,8 +815,8 @@ func (c *Appointments) isMediator(context services.Context, params *services.Sig
 
 	if resp, key := c.isValidActorSignature(context, []byte(params.JSON), params.Signature, params.PublicKey, keys.Mediators); resp != nil {
 		return resp, nil
-	} else if expired(params.Timestamp) {
-		return context.Error(410, "signature expired", nil), nil
+	} else if resp := isFresh(context, c.db, []byte(params.JSON), params.PublicKey, params.Timestamp); resp != nil {
+		return resp, nil
 	} else {
 		return nil, key
 	}
@@ -462,8 +833,8 @@ func (c *Appointments) isProvider(context services.Context, params *services.Sig
 
 	if resp, key := c.isValidActorSignature(context, []byte(params.JSON), params.Signature, params.PublicKey, keys.Providers); resp != nil {
 		return resp, nil
-	} else if expired(params.Timestamp) {
-		return context.Error(410, "signature expired", nil), nil
+	} else if resp := isFresh(context, c.db, []byte(params.JSON), params.PublicKey, params.Timestamp); resp != nil {
+		return resp, nil
 	} else {
 		return nil, key
 	}
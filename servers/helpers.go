@@ -21,6 +21,7 @@ package servers
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"github.com/kiebitz-oss/services"
 	"github.com/kiebitz-oss/services/crypto"
 	"time"
@@ -57,27 +58,142 @@ func findActorKey(keys []*services.ActorKey, publicKeyOrID []byte) (*services.Ac
 	return nil, nil
 }
 
-func isRoot(context services.Context, data, signature []byte, timestamp time.Time, keys []*crypto.Key) services.Response {
-	rootKey := services.Key(keys, "root")
-	if rootKey == nil {
+// Returns the first slot of the appointment that has not been booked yet,
+// or nil if all slots are booked.
+func openSlot(signedAppointment *services.SignedAppointment) *services.Slot {
+	for _, slotData := range signedAppointment.Data.SlotData {
+
+		found := false
+
+		for _, booking := range signedAppointment.Bookings {
+			if bytes.Equal(booking.ID, slotData.ID) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return slotData
+		}
+	}
+	return nil
+}
+
+// Returns the entry for the token-to-booking index
+func bookedAppointment(providerID []byte, signedAppointment *services.SignedAppointment, booking *services.Booking) *services.BookedAppointment {
+	return &services.BookedAppointment{
+		ProviderID:    providerID,
+		AppointmentID: signedAppointment.Data.ID,
+		SlotID:        booking.ID,
+		Timestamp:     signedAppointment.Data.Timestamp,
+	}
+}
+
+// Returns true if the appointment matches the property, time of day and
+// free slot filters of a search.
+func matchesFilters(params *services.GetAppointmentsByZipCodeParams, signedAppointment *services.SignedAppointment) bool {
+
+	appointment := signedAppointment.Data
+
+	if int64(len(appointment.SlotData)-len(signedAppointment.Bookings)) < params.MinSlots {
+		return false
+	}
+
+	// we use the time of day in the time zone the appointment was published in
+	timeOfDay := appointment.Timestamp.Format("15:04")
+
+	if params.TimeFrom != "" && timeOfDay < params.TimeFrom {
+		return false
+	}
+
+	if params.TimeTo != "" && timeOfDay > params.TimeTo {
+		return false
+	}
+
+	for name, value := range params.Properties {
+		// we compare the JSON representations, as numbers might have been
+		// decoded to different types
+		if expected, err := json.Marshal(value); err != nil {
+			return false
+		} else if actual, err := json.Marshal(appointment.Properties[name]); err != nil {
+			return false
+		} else if !bytes.Equal(expected, actual) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isRoot(context services.Context, db services.Database, data, signature []byte, timestamp time.Time, keys []*crypto.Key) services.Response {
+	// we accept all valid versions of the root key
+	rootKeys := services.ValidKeys(keys, "root")
+	if len(rootKeys) == 0 {
 		services.Log.Error("root key missing")
 		return context.InternalError()
 	}
-	if ok, err := rootKey.Verify(&crypto.SignedData{
-		Data:      data,
-		Signature: signature,
-	}); !ok {
-		return context.Error(403, "invalid signature", nil)
-	} else if err != nil {
+	for _, rootKey := range rootKeys {
+		if ok, err := rootKey.Verify(&crypto.SignedData{
+			Data:      data,
+			Signature: signature,
+		}); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		} else if ok {
+			return isFresh(context, db, data, rootKey.PublicKey, timestamp)
+		}
+	}
+	return context.Error(403, "invalid signature", nil)
+}
+
+// releases the given lock, we can't do anything useful if this fails so we
+// only log the error
+func release(lock services.Lock) {
+	if err := lock.Release(); err != nil {
 		services.Log.Error(err)
-		return context.InternalError()
 	}
+}
+
+// how long a signature is valid after its timestamp
+const signatureValidity = time.Minute
+
+// how far a timestamp may lie in the future to allow for clock skew
+const maxClockSkew = 10 * time.Second
+
+func expired(timestamp time.Time) bool {
+	return time.Now().Add(-signatureValidity).After(timestamp)
+}
+
+// Ensures that the timestamp of a signed request is current and that the
+// request has not been seen before. We remember signed data until its
+// signature expires, so a request can't be replayed within that window.
+// This should only be called after the signature has been verified.
+func isFresh(context services.Context, db services.Database, data, publicKey []byte, timestamp time.Time) services.Response {
+
 	if expired(timestamp) {
 		return context.Error(410, "signature expired", nil)
 	}
-	return nil
-}
 
-func expired(timestamp time.Time) bool {
-	return time.Now().Add(-time.Minute).After(timestamp)
+	if timestamp.After(time.Now().Add(maxClockSkew)) {
+		return context.Error(400, "timestamp lies in the future", nil)
+	}
+
+	// we don't use the signature itself, as it could be altered without
+	// invalidating it
+	key := crypto.Hash(append(append([]byte{}, publicKey...), data...))
+
+	if n, err := db.Integer("signatures", key).IncrBy(1); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if n > 1 {
+		return context.Error(409, "request has already been processed", nil)
+	}
+
+	// we add a small margin to make sure the signature expires first
+	if err := db.Expire("signatures", key, time.Until(timestamp.Add(signatureValidity))+time.Second); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return nil
 }
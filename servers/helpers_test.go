@@ -0,0 +1,100 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func TestSignatureReplay(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+
+	from := time.Now()
+
+	getAppointments := func(timestamp time.Time) int {
+		resp, err := client.Appointments.GetProviderAppointments(&services.GetProviderAppointmentsParams{
+			Timestamp: timestamp,
+			From:      from,
+			To:        from.Add(time.Hour),
+		}, provider)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return errorCode(t, resp)
+	}
+
+	timestamp := time.Now()
+
+	if code := getAppointments(timestamp); code != 0 {
+		t.Fatalf("expected no error, got %d", code)
+	}
+
+	// sending the same request again should fail
+	if code := getAppointments(timestamp); code != 409 {
+		t.Fatalf("expected a 409 error code for a replayed request, got %d", code)
+	}
+
+	if code := getAppointments(time.Now().Add(-2 * time.Minute)); code != 410 {
+		t.Fatalf("expected a 410 error code for an expired request, got %d", code)
+	}
+
+	if code := getAppointments(time.Now().Add(time.Minute)); code != 400 {
+		t.Fatalf("expected a 400 error code for a future timestamp, got %d", code)
+	}
+
+}
@@ -28,6 +28,7 @@ import (
 )
 
 type Server struct {
+	api           *api.API
 	httpServer    *http.HTTPServer
 	restServer    *rest.RESTServer
 	jsonRPCServer *jsonrpc.JSONRPCServer
@@ -41,9 +42,37 @@ func MakeServer(
 	validateSettings *services.ValidateSettings,
 	api *api.API) (*Server, error) {
 
-	server := &Server{}
+	server := &Server{
+		api: api,
+	}
+
+	var cors *services.CorsSettings
+
+	if jsonRPCSettings != nil {
+		cors = jsonRPCSettings.Cors
+	} else if restSettings != nil {
+		cors = restSettings.Cors
+	}
+
+	// the OpenAPI specification is served independently of the API types
+	// that are enabled, so we add it before the other routes
+	routeGroups := []*http.RouteGroup{
+		{
+			Handlers: []http.Handler{
+				jsonrpc.Cors(cors, false),
+			},
+			Routes: []*http.Route{
+				{
+					Pattern: `^/\.well-known/openapi\.json$`,
+					Handlers: []http.Handler{
+						openAPIHandler(api.OpenAPI()),
+					},
+				},
+			},
+		},
+	}
 
-	httpServer, err := http.MakeHTTPServer(httpSettings, nil, name)
+	httpServer, err := http.MakeHTTPServer(httpSettings, routeGroups, name)
 
 	if err != nil {
 		return nil, err
@@ -83,6 +112,17 @@ func MakeServer(
 
 }
 
+func openAPIHandler(spec *api.Spec) http.Handler {
+	return func(c *http.Context) {
+		c.JSON(200, spec)
+	}
+}
+
+// Returns the OpenAPI specification of the server
+func (c *Server) OpenAPI() *api.Spec {
+	return c.api.OpenAPI()
+}
+
 func (c *Server) Start() error {
 	// we start the JSONRPC server first to avoid passing HTTP requests to it before it is initialized
 	if c.jsonRPCServer != nil {
@@ -0,0 +1,221 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/api"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	"github.com/kiebitz-oss/services/jsonrpc"
+	"github.com/kiebitz-oss/services/servers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	settings := fixtures["settings"].(*services.Settings)
+
+	checkSpec := func(spec *api.Spec) {
+
+		if spec.OpenAPI != "3.1.0" || spec.Info.Title != "appointments" {
+			t.Fatalf("unexpected specification header")
+		}
+
+		pathItem, ok := spec.Paths["/appointments/zipCode/{zipCode}/{radius}/{from}/{to}"]
+
+		if !ok {
+			t.Fatalf("expected a path for getAppointmentsByZipCode")
+		}
+
+		operation, ok := (*pathItem)["get"]
+
+		if !ok || operation.OperationID != "getAppointmentsByZipCode" {
+			t.Fatalf("expected a GET operation for getAppointmentsByZipCode")
+		}
+
+		params := map[string]string{}
+
+		for _, parameter := range operation.Parameters {
+			params[parameter.Name] = parameter.In
+		}
+
+		if params["zipCode"] != "path" || params["cursor"] != "query" {
+			t.Fatalf("expected path and query parameters")
+		}
+
+		if _, ok := spec.Paths["/jsonrpc"]; !ok {
+			t.Fatalf("expected a JSON-RPC path")
+		}
+
+		if _, ok := spec.Components.Schemas["bookAppointmentParams"]; !ok {
+			t.Fatalf("expected a schema for the bookAppointment parameters")
+		}
+	}
+
+	// the specification is available via JSON-RPC...
+	resp, err := client.Appointments.GetOpenAPI()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Result *api.Spec `json:"result"`
+	}
+
+	if data, err := resp.Bytes(); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	checkSpec(result.Result)
+
+	// ...and at a well-known URL
+	url := strings.TrimSuffix(settings.Admin.Client.AppointmentsEndpoint, "/jsonrpc") + "/.well-known/openapi.json"
+
+	httpResp, err := http.Get(url)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d", httpResp.StatusCode)
+	}
+
+	var spec *api.Spec
+
+	if data, err := ioutil.ReadAll(httpResp.Body); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	checkSpec(spec)
+
+	// the specification can also be generated without a database
+	checkSpec(servers.AppointmentsSpec())
+}
+
+func TestJSONRPCBatch(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := fixtures["settings"].(*services.Settings)
+	client := jsonrpc.MakeClient(settings.Admin.Client.AppointmentsEndpoint)
+
+	responses, err := client.CallBatch([]*jsonrpc.Request{
+		jsonrpc.MakeRequest("getKeys", "1", map[string]interface{}{}),
+		// a notification, which should not get a response
+		jsonrpc.MakeRequest("getKeys", "", map[string]interface{}{}),
+		jsonrpc.MakeRequest("doesNotExist", "2", map[string]interface{}{}),
+		jsonrpc.MakeRequest("getConfigurables", "3", map[string]interface{}{}),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(responses) != 3 {
+		t.Fatalf("expected 3 responses, got %d", len(responses))
+	}
+
+	for i, response := range responses {
+		if response.ID != fmt.Sprintf("%d", i+1) {
+			t.Fatalf("expected responses in order, got ID %v", response.ID)
+		}
+	}
+
+	if responses[0].Error != nil || responses[2].Error != nil {
+		t.Fatalf("expected valid requests to succeed")
+	}
+
+	if responses[1].Error == nil || responses[1].Error.Code != -32601 {
+		t.Fatalf("expected a method not found error")
+	}
+
+	// batches with only notifications get no response
+	if responses, err := client.CallBatch([]*jsonrpc.Request{
+		jsonrpc.MakeRequest("getKeys", "", map[string]interface{}{}),
+	}); err != nil {
+		t.Fatal(err)
+	} else if len(responses) != 0 {
+		t.Fatalf("expected no responses")
+	}
+
+	// batches may not exceed the maximum batch size
+	requests := make([]*jsonrpc.Request, settings.Appointments.JSONRPC.MaxBatchSize+1)
+
+	for i := range requests {
+		requests[i] = jsonrpc.MakeRequest("getKeys", fmt.Sprintf("%d", i), map[string]interface{}{})
+	}
+
+	if _, err := client.CallBatch(requests); err == nil {
+		t.Fatalf("expected the batch to be rejected")
+	}
+}
@@ -0,0 +1,125 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+	"time"
+)
+
+func (c *Storage) lockBlob(id []byte) (services.Lock, error) {
+	return c.db.Lock(fmt.Sprintf("lock::blob::%s", hex.EncodeToString(id)))
+}
+
+// blobs expire like settings
+func (c *Storage) blobTTL() time.Duration {
+	return c.settingsTTL()
+}
+
+// Returns the key under which the chunk with the given index is stored
+func blobChunkKey(id []byte, index int64) []byte {
+	key := make([]byte, len(id)+8)
+	copy(key, id)
+	binary.BigEndian.PutUint64(key[len(id):], uint64(index))
+	return key
+}
+
+// Returns the manifest of the blob with the given ID, or nil if it doesn't
+// exist.
+func (c *Storage) getBlobManifest(id []byte) (*services.BlobManifest, error) {
+
+	data, err := c.db.Value("blobs", id).Get()
+
+	if err == databases.NotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	manifest := &services.BlobManifest{}
+
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// Stores the manifest, which also resets its TTL.
+func (c *Storage) saveBlobManifest(manifest *services.BlobManifest) error {
+	if data, err := json.Marshal(manifest); err != nil {
+		return err
+	} else {
+		return c.db.Value("blobs", manifest.ID).Set(data, c.blobTTL())
+	}
+}
+
+// Removes the manifest and all chunks of the given blob.
+func (c *Storage) removeBlob(manifest *services.BlobManifest) error {
+	for _, chunk := range manifest.Chunks {
+		if err := c.db.Value("blobChunks", blobChunkKey(manifest.ID, chunk.Index)).Del(); err != nil {
+			return err
+		}
+	}
+	return c.db.Value("blobs", manifest.ID).Del()
+}
+
+// Returns the total size of the blobs owned by the given key, leaving out the
+// blob with the given ID (which is about to be replaced).
+func (c *Storage) ownedBlobBytes(publicKey, except []byte) (int64, error) {
+
+	ids, err := c.ownedRecords("blobs", publicKey)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+
+	for _, id := range ids {
+		if bytes.Equal(id, except) {
+			continue
+		}
+		if manifest, err := c.getBlobManifest(id); err != nil {
+			return 0, err
+		} else if manifest != nil {
+			n += manifest.Size
+		}
+	}
+
+	return n, nil
+}
+
+// Returns an error response if the blob doesn't exist or belongs to another
+// key.
+func (c *Storage) canModifyBlob(context services.Context, manifest *services.BlobManifest, publicKey []byte) services.Response {
+	if manifest == nil {
+		return context.NotFound()
+	}
+	if !bytes.Equal(manifest.PublicKey, publicKey) {
+		return context.Error(403, "not authorized", nil)
+	}
+	return nil
+}
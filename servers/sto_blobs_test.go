@@ -0,0 +1,384 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/forms"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+)
+
+func TestBlobs(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the storage API
+		at.FC{af.StorageServer{}, "storageServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	settings := fixtures["settings"].(*services.Settings)
+
+	// the storage server uses the same settings object
+	settings.Storage.BlobChunkSize = 1024
+	settings.Storage.MaxBlobSize = 4096
+
+	owner, err := crypto.GenerateWebKey("owner", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := crypto.GenerateWebKey("other", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := crypto.RandomBytes(32)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the blob is split into two full chunks and a partial one
+	blob, err := crypto.RandomBytes(2500)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := [][]byte{blob[:1024], blob[1024:2048], blob[2048:]}
+
+	getManifest := func(resp *helpers.Response) *services.BlobManifest {
+		manifest := &services.BlobManifest{}
+		if err := resp.CoerceResult(manifest, &forms.BlobManifestForm); err != nil {
+			t.Fatal(err)
+		}
+		return manifest
+	}
+
+	expectCode := func(resp *helpers.Response, err error, expected int, message string) {
+		if err != nil {
+			t.Fatal(err)
+		} else if code := errorCode(t, resp); code != expected {
+			t.Fatalf("%s: expected %d, got %d", message, expected, code)
+		}
+	}
+
+	resp, err := client.Storage.CreateBlob(id, 5000, owner)
+	expectCode(resp, err, 413, "creating a blob that is too large")
+
+	resp, err = client.Storage.CreateBlob(id, int64(len(blob)), owner)
+	expectCode(resp, err, 0, "creating the blob")
+
+	if manifest := getManifest(resp); manifest.ChunkSize != 1024 || manifest.NumChunks() != 3 {
+		t.Fatalf("unexpected manifest: %v", manifest)
+	}
+
+	resp, err = client.Storage.UploadBlobChunk(id, 0, chunks[0], other)
+	expectCode(resp, err, 403, "uploading a chunk with another key")
+
+	resp, err = client.Storage.UploadBlobChunk(id, 0, chunks[2], owner)
+	expectCode(resp, err, 400, "uploading a chunk with the wrong length")
+
+	resp, err = client.Storage.UploadBlobChunk(id, 3, chunks[2], owner)
+	expectCode(resp, err, 400, "uploading a chunk with an invalid index")
+
+	for _, i := range []int64{0, 2} {
+		resp, err = client.Storage.UploadBlobChunk(id, i, chunks[i], owner)
+		expectCode(resp, err, 0, "uploading a chunk")
+	}
+
+	resp, err = client.Storage.FinalizeBlob(id, owner)
+	expectCode(resp, err, 409, "finalizing an incomplete blob")
+
+	resp, err = client.Storage.GetBlobChunk(id, 0)
+	expectCode(resp, err, 409, "downloading a chunk of an incomplete blob")
+
+	// the manifest tells us which chunks are still missing
+	resp, err = client.Storage.GetBlob(id)
+	expectCode(resp, err, 0, "getting the manifest")
+
+	if manifest := getManifest(resp); len(manifest.Chunks) != 2 || manifest.Chunks[0].Index != 0 || manifest.Chunks[1].Index != 2 {
+		t.Fatalf("expected chunks 0 and 2 to be uploaded")
+	}
+
+	resp, err = client.Storage.UploadBlobChunk(id, 1, chunks[1], owner)
+	expectCode(resp, err, 0, "uploading the missing chunk")
+
+	// we pretend that the first chunk has expired in the meantime
+	chunkKey := make([]byte, len(id)+8)
+	copy(chunkKey, id)
+	binary.BigEndian.PutUint64(chunkKey[len(id):], 0)
+
+	if err := settings.DatabaseObj.Value("blobChunks", chunkKey).Del(); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = client.Storage.FinalizeBlob(id, owner)
+	expectCode(resp, err, 409, "finalizing a blob with an expired chunk")
+
+	resp, err = client.Storage.GetBlob(id)
+	expectCode(resp, err, 0, "getting the manifest")
+
+	if manifest := getManifest(resp); len(manifest.Chunks) != 2 || manifest.Chunks[0].Index != 1 {
+		t.Fatalf("expected the expired chunk to be removed from the manifest")
+	}
+
+	resp, err = client.Storage.UploadBlobChunk(id, 0, chunks[0], owner)
+	expectCode(resp, err, 0, "uploading the expired chunk again")
+
+	resp, err = client.Storage.FinalizeBlob(id, owner)
+	expectCode(resp, err, 0, "finalizing the blob")
+
+	manifest := getManifest(resp)
+
+	hash := sha256.New()
+
+	for _, chunk := range chunks {
+		chunkHash := sha256.Sum256(chunk)
+		hash.Write(chunkHash[:])
+	}
+
+	if !manifest.Complete || !bytes.Equal(manifest.Hash, hash.Sum(nil)) {
+		t.Fatalf("expected a complete manifest with the hash of the chunk hashes")
+	}
+
+	resp, err = client.Storage.UploadBlobChunk(id, 1, chunks[1], owner)
+	expectCode(resp, err, 409, "uploading a chunk to a finalized blob")
+
+	downloaded := []byte{}
+
+	for i := range chunks {
+
+		resp, err = client.Storage.GetBlobChunk(id, int64(i))
+		expectCode(resp, err, 0, "downloading a chunk")
+
+		chunk := &services.BlobChunk{}
+
+		if err := resp.CoerceResult(chunk, &forms.BlobChunkForm); err != nil {
+			t.Fatal(err)
+		}
+
+		if chunkHash := sha256.Sum256(chunk.Data); !bytes.Equal(chunkHash[:], manifest.Chunks[i].Hash) {
+			t.Fatalf("chunk %d does not match its hash", i)
+		}
+
+		downloaded = append(downloaded, chunk.Data...)
+	}
+
+	if !bytes.Equal(downloaded, blob) {
+		t.Fatalf("the downloaded blob does not match the uploaded one")
+	}
+
+	resp, err = client.Storage.DeleteBlob(id, other)
+	expectCode(resp, err, 403, "deleting the blob with another key")
+
+	resp, err = client.Storage.DeleteBlob(id, owner)
+	expectCode(resp, err, 0, "deleting the blob")
+
+	resp, err = client.Storage.GetBlob(id)
+	expectCode(resp, err, 404, "getting a deleted blob")
+
+}
+
+func TestBlobQuotas(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the storage API
+		at.FC{af.StorageServer{}, "storageServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	settings := fixtures["settings"].(*services.Settings)
+
+	// the storage server uses the same settings object
+	settings.Storage.BlobChunkSize = 1024
+	settings.Storage.MaxBlobSize = 4096
+	settings.Storage.MaxBlobBytesPerKey = 4096
+	settings.Storage.MaxRecordsPerKey = 2
+
+	owner, err := crypto.GenerateWebKey("owner", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([][]byte, 3)
+
+	for i := range ids {
+		if ids[i], err = crypto.RandomBytes(32); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expectCode := func(resp *helpers.Response, err error, expected int, message string) {
+		if err != nil {
+			t.Fatal(err)
+		} else if code := errorCode(t, resp); code != expected {
+			t.Fatalf("%s: expected %d, got %d", message, expected, code)
+		}
+	}
+
+	resp, err := client.Storage.CreateBlob(ids[0], 2500, owner)
+	expectCode(resp, err, 0, "creating the blob")
+
+	resp, err = client.Storage.CreateBlob(ids[1], 2000, owner)
+	expectCode(resp, err, 429, "creating a blob that exceeds the bytes of the key")
+
+	// the size of a replaced blob doesn't count
+	resp, err = client.Storage.CreateBlob(ids[0], 4096, owner)
+	expectCode(resp, err, 0, "replacing the blob with a larger one")
+
+	resp, err = client.Storage.CreateBlob(ids[0], 1024, owner)
+	expectCode(resp, err, 0, "replacing the blob with a smaller one")
+
+	// blobs and settings count against the same limit
+	resp, err = client.Storage.StoreSettings(ids[1], "data", 0, owner)
+	expectCode(resp, err, 0, "storing settings")
+
+	resp, err = client.Storage.CreateBlob(ids[2], 1024, owner)
+	expectCode(resp, err, 429, "creating a blob that exceeds the records of the key")
+
+	chunk, err := crypto.RandomBytes(1024)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = client.Storage.UploadBlobChunk(ids[0], 0, chunk, owner)
+	expectCode(resp, err, 0, "uploading a chunk")
+
+	// chunks don't count against the write quota of the key...
+	settings.Storage.KeyWriteQuota = 1
+
+	resp, err = client.Storage.UploadBlobChunk(ids[0], 0, chunk, owner)
+	expectCode(resp, err, 0, "uploading a chunk again with an exhausted write quota")
+
+	// ...but each chunk can only be uploaded twice per quota window
+	resp, err = client.Storage.UploadBlobChunk(ids[0], 0, chunk, owner)
+	expectCode(resp, err, 429, "uploading a chunk a third time")
+
+}
+
+func TestUploadLargeBlob(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the storage API
+		at.FC{af.StorageServer{}, "storageServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	settings := fixtures["settings"].(*services.Settings)
+
+	owner, err := crypto.GenerateWebKey("owner", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := crypto.RandomBytes(32)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// we upload a blob of the maximum size with the default settings
+	blob, err := crypto.RandomBytes(int(settings.Storage.MaxBlobSize))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectCode := func(resp *helpers.Response, err error, expected int, message string) {
+		if err != nil {
+			t.Fatal(err)
+		} else if code := errorCode(t, resp); code != expected {
+			t.Fatalf("%s: expected %d, got %d", message, expected, code)
+		}
+	}
+
+	resp, err := client.Storage.CreateBlob(id, int64(len(blob)), owner)
+	expectCode(resp, err, 0, "creating the blob")
+
+	chunkSize := settings.Storage.BlobChunkSize
+
+	for i := int64(0); i*chunkSize < int64(len(blob)); i++ {
+		end := (i + 1) * chunkSize
+		if end > int64(len(blob)) {
+			end = int64(len(blob))
+		}
+		resp, err = client.Storage.UploadBlobChunk(id, i, blob[i*chunkSize:end], owner)
+		expectCode(resp, err, 0, "uploading a chunk")
+	}
+
+	resp, err = client.Storage.FinalizeBlob(id, owner)
+	expectCode(resp, err, 0, "finalizing the blob")
+
+}
@@ -0,0 +1,78 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"github.com/kiebitz-oss/services"
+)
+
+func (c *Storage) completePairing(context services.Context, params *services.CompletePairingSignedParams) services.Response {
+
+	if resp := c.isSigned(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		return resp
+	}
+
+	if lock, err := c.lockPairing(params.Data.ID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		defer release(lock)
+	}
+
+	session, err := c.getPairingSession(params.Data.ID)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if session == nil {
+		return context.NotFound()
+	}
+
+	if !bytes.Equal(session.SigningKey, params.PublicKey) {
+		return context.Error(403, "not authorized", nil)
+	}
+
+	if session.PeerPublicKey == nil {
+		return context.Error(409, "no device has joined yet", nil)
+	}
+
+	if session.EncryptedData != nil {
+		return context.Error(409, "already completed", nil)
+	}
+
+	// the other device derives the key from the public key of the session
+	if !bytes.Equal(params.Data.EncryptedData.PublicKey, session.PublicKey) {
+		return context.Error(400, "data must be encrypted with the key of the session", nil)
+	}
+
+	session.EncryptedData = params.Data.EncryptedData
+
+	if err := c.savePairingSession(session); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Acknowledge()
+}
@@ -0,0 +1,133 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+)
+
+// Creates an upload session for a blob. If the key already owns a blob with
+// the given ID, it is replaced.
+func (c *Storage) createBlob(context services.Context, params *services.CreateBlobSignedParams) services.Response {
+
+	if params.Data.Size > c.settings.MaxBlobSize {
+		return context.Error(413, "blob too large", nil)
+	}
+
+	if ok, err := c.withinQuota("ip", []byte(context.ClientIP()), c.settings.IPWriteQuota); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return context.Error(429, "quota exceeded", nil)
+	}
+
+	if resp := c.isSigned(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		return resp
+	}
+
+	if ok, err := c.withinQuota("key", params.PublicKey, c.settings.KeyWriteQuota); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return context.Error(429, "quota exceeded", nil)
+	}
+
+	if lock, err := c.lockBlob(params.Data.ID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		defer release(lock)
+	}
+
+	existingManifest, err := c.getBlobManifest(params.Data.ID)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if existingManifest != nil {
+		if resp := c.canModifyBlob(context, existingManifest, params.PublicKey); resp != nil {
+			return resp
+		}
+	}
+
+	// blobs count against the same limit as settings records
+	if lock, err := c.lockOwnedRecords(params.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		defer release(lock)
+	}
+
+	var newRecords int64
+
+	if existingManifest == nil {
+		if n, err := c.countOwnedRecords(params.PublicKey); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		} else if n >= c.settings.MaxRecordsPerKey {
+			return context.Error(429, "too many records", nil)
+		}
+		newRecords = 1
+	}
+
+	if n, err := c.ownedBlobBytes(params.PublicKey, params.Data.ID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if n+params.Data.Size > c.settings.MaxBlobBytesPerKey {
+		return context.Error(429, "too many bytes", nil)
+	}
+
+	if existingManifest != nil {
+		if err := c.removeBlob(existingManifest); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+	}
+
+	manifest := &services.BlobManifest{
+		ID:        params.Data.ID,
+		PublicKey: params.PublicKey,
+		Size:      params.Data.Size,
+		ChunkSize: c.settings.BlobChunkSize,
+		Chunks:    []*services.BlobChunkHash{},
+	}
+
+	if err := c.saveBlobManifest(manifest); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.addOwnedRecord("blobs", params.PublicKey, manifest.ID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	c.meterStorage(0, newRecords)
+
+	manifest.PublicKey = nil
+
+	return context.Result(manifest)
+}
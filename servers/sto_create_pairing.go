@@ -0,0 +1,95 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
+	"time"
+)
+
+func (c *Storage) createPairing(context services.Context, params *services.CreatePairingSignedParams) services.Response {
+
+	if ok, err := c.withinQuota("ip", []byte(context.ClientIP()), c.settings.IPWriteQuota); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return context.Error(429, "quota exceeded", nil)
+	}
+
+	// the key that signed the request is the only one that can complete the
+	// session later on
+	if resp := c.isSigned(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		return resp
+	}
+
+	id, err := crypto.RandomBytes(32)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	ttl := time.Duration(c.settings.PairingTTLMinutes) * time.Minute
+
+	session := &services.PairingSession{
+		ID:         id,
+		PublicKey:  params.Data.PublicKey,
+		SigningKey: params.PublicKey,
+		ExpiresAt:  time.Now().Add(ttl).UTC(),
+	}
+
+	var code string
+
+	// we make sure that the code isn't used by another open session
+	for {
+		if code, err = generatePairingCode(); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+		if _, err := c.db.Value("pairingCodes", []byte(code)).Get(); err == databases.NotFound {
+			break
+		} else if err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+	}
+
+	if err := c.savePairingSession(session); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.db.Value("pairingCodes", []byte(code)).Set(id, ttl); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Result(&services.PairingCode{
+		ID:        id,
+		Code:      formatPairingCode(code),
+		ExpiresAt: session.ExpiresAt,
+	})
+}
@@ -22,11 +22,56 @@ import (
 	"github.com/kiebitz-oss/services"
 )
 
-func (c *Storage) deleteSettings(context services.Context, params *services.GetSettingsParams) services.Response {
-	value := c.db.Value("settings", params.ID)
-	if err := value.Del(); err != nil {
+func (c *Storage) deleteSettings(context services.Context, params *services.DeleteSettingsSignedParams) services.Response {
+
+	if resp := c.isSigned(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		return resp
+	}
+
+	if lock, err := c.lockSettings(params.Data.ID); err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
+	} else {
+		defer release(lock)
 	}
+
+	record, err := c.getRecord(params.Data.ID)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if record.Version == 0 && record.Data == nil {
+		return context.NotFound()
+	}
+
+	// settings stored before records were bound to keys need to be claimed
+	// by a write before they can be deleted
+	if record.PublicKey == nil {
+		return context.Error(403, "not authorized", nil)
+	}
+
+	if resp := c.canModify(context, record, params.PublicKey, params.Data.Version); resp != nil {
+		return resp
+	}
+
+	for _, table := range []string{"settingsRecords", "settings"} {
+		if err := c.db.Value(table, params.Data.ID).Del(); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+	}
+
+	if err := c.db.Set("storageOwners", record.PublicKey).Del(params.Data.ID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
 	return context.Acknowledge()
 }
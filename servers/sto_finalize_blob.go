@@ -0,0 +1,112 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"crypto/sha256"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+)
+
+// Finalizes the upload of a blob once all chunks have been uploaded, after
+// which the blob can be downloaded but no longer be modified.
+func (c *Storage) finalizeBlob(context services.Context, params *services.BlobSignedParams) services.Response {
+
+	if resp := c.isSigned(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		return resp
+	}
+
+	if lock, err := c.lockBlob(params.Data.ID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		defer release(lock)
+	}
+
+	manifest, err := c.getBlobManifest(params.Data.ID)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if resp := c.canModifyBlob(context, manifest, params.PublicKey); resp != nil {
+		return resp
+	}
+
+	if manifest.Complete {
+		return context.Error(409, "upload already finalized", nil)
+	}
+
+	// chunks are sorted by index and unique, so we only need to count them
+	if int64(len(manifest.Chunks)) != manifest.NumChunks() {
+		return context.Error(409, "chunks missing", nil)
+	}
+
+	// chunks expire on their own, so a chunk that was uploaded early on
+	// might be gone by now. We remove such chunks from the manifest, which
+	// tells the client to upload them again.
+	chunks := []*services.BlobChunkHash{}
+
+	for _, chunk := range manifest.Chunks {
+		if _, err := c.db.Value("blobChunks", blobChunkKey(manifest.ID, chunk.Index)).TTL(); err == nil {
+			chunks = append(chunks, chunk)
+		} else if err != databases.NotFound {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+	}
+
+	if len(chunks) != len(manifest.Chunks) {
+		manifest.Chunks = chunks
+		if err := c.saveBlobManifest(manifest); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+		return context.Error(409, "chunks missing", nil)
+	}
+
+	hash := sha256.New()
+
+	for _, chunk := range manifest.Chunks {
+		hash.Write(chunk.Hash)
+		// the chunks expire together with the manifest
+		if err := c.db.Expire("blobChunks", blobChunkKey(manifest.ID, chunk.Index), c.blobTTL()); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+	}
+
+	manifest.Complete = true
+	manifest.Hash = hash.Sum(nil)
+
+	if err := c.saveBlobManifest(manifest); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	manifest.PublicKey = nil
+
+	return context.Result(manifest)
+}
@@ -0,0 +1,63 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+)
+
+func (c *Storage) getBlobChunk(context services.Context, params *services.GetBlobChunkParams) services.Response {
+
+	manifest, err := c.getBlobManifest(params.ID)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if manifest == nil {
+		return context.NotFound()
+	}
+
+	// incomplete blobs can't be downloaded
+	if !manifest.Complete {
+		return context.Error(409, "upload incomplete", nil)
+	}
+
+	for _, chunk := range manifest.Chunks {
+
+		if chunk.Index != params.Index {
+			continue
+		}
+
+		if data, err := c.db.Value("blobChunks", blobChunkKey(manifest.ID, chunk.Index)).Get(); err == databases.NotFound {
+			return context.NotFound()
+		} else if err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		} else {
+			return context.Result(&services.BlobChunk{
+				Index: chunk.Index,
+				Data:  data,
+				Hash:  chunk.Hash,
+			})
+		}
+	}
+
+	return context.NotFound()
+}
@@ -21,7 +21,7 @@ package servers
 import (
 	"encoding/json"
 	"github.com/kiebitz-oss/services"
-	"github.com/kiebitz-oss/services/databases"
+	"time"
 )
 
 func toInterface(data []byte) (interface{}, error) {
@@ -33,18 +33,41 @@ func toInterface(data []byte) (interface{}, error) {
 }
 
 func (c *Storage) getSettings(context services.Context, params *services.GetSettingsParams) services.Response {
-	value := c.db.Value("settings", params.ID)
-	if data, err := value.Get(); err != nil {
-		if err == databases.NotFound {
-			return context.NotFound()
-		} else {
-			services.Log.Error(err)
-			return context.InternalError()
-		}
-	} else if i, err := toInterface(data); err != nil {
+
+	record, err := c.getRecord(params.ID)
+
+	if err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
-	} else {
-		return context.Result(i)
+	} else if record.Version == 0 && record.Data == nil {
+		return context.NotFound()
+	}
+
+	if c.settings.SlidingSettingsTTL {
+
+		// we don't know which table the settings are stored in, but Expire
+		// ignores keys that do not exist
+		for _, table := range []string{"settingsRecords", "settings"} {
+			if err := c.db.Expire(table, params.ID, c.settingsTTL()); err != nil {
+				services.Log.Error(err)
+				return context.InternalError()
+			}
+		}
+
+		// the records owned by a key need to live as long as the records
+		if record.PublicKey != nil {
+			if err := c.touchOwnedRecords(record.PublicKey); err != nil {
+				services.Log.Error(err)
+				return context.InternalError()
+			}
+		}
+
+		expiresAt := time.Now().Add(c.settingsTTL()).UTC()
+		record.ExpiresAt = &expiresAt
 	}
+
+	// the owner of the settings isn't revealed
+	record.PublicKey = nil
+
+	return context.Result(record)
 }
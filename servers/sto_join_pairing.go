@@ -0,0 +1,93 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+)
+
+func (c *Storage) joinPairing(context services.Context, params *services.JoinPairingParams) services.Response {
+
+	ip := []byte(context.ClientIP())
+
+	// we stop accepting codes from clients that tried too many invalid ones
+	if n, err := c.quotaUsed("pairing", ip); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if n >= c.settings.MaxPairingAttempts {
+		return context.Error(429, "too many attempts", nil)
+	}
+
+	invalidCode := func() services.Response {
+		if _, err := c.withinQuota("pairing", ip, c.settings.MaxPairingAttempts); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+		return context.NotFound()
+	}
+
+	code := []byte(normalizePairingCode(params.Code))
+
+	id, err := c.db.Value("pairingCodes", code).Get()
+
+	if err == databases.NotFound {
+		return invalidCode()
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if lock, err := c.lockPairing(id); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		defer release(lock)
+	}
+
+	session, err := c.getPairingSession(id)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// the session has expired or another device joined it in the meantime
+	if session == nil || session.PeerPublicKey != nil {
+		return invalidCode()
+	}
+
+	session.PeerPublicKey = params.PublicKey
+
+	if err := c.savePairingSession(session); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// codes can only be used once
+	if err := c.db.Value("pairingCodes", code).Del(); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// the key of the creating device isn't revealed
+	session.SigningKey = nil
+
+	return context.Result(session)
+}
@@ -0,0 +1,254 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"bytes"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/forms"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"strings"
+	"testing"
+)
+
+func TestPairing(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the storage API
+		at.FC{af.StorageServer{}, "storageServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+
+	// the old and the new device
+	keyA, err := crypto.GenerateWebKey("a", "ecdh")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyB, err := crypto.GenerateWebKey("b", "ecdh")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the signing key of the old device, which binds the session to it
+	signingKey, err := crypto.GenerateWebKey("signing", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherSigningKey, err := crypto.GenerateWebKey("other", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getSession := func(resp *helpers.Response) *services.PairingSession {
+		session := &services.PairingSession{}
+		if err := resp.CoerceResult(session, &forms.PairingSessionForm); err != nil {
+			t.Fatal(err)
+		}
+		return session
+	}
+
+	resp, err := client.Storage.CreatePairing(keyA, signingKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pairingCode := &services.PairingCode{}
+
+	if err := resp.CoerceResult(pairingCode, &forms.PairingCodeForm); err != nil {
+		t.Fatal(err)
+	}
+
+	// the data can't be sent before another device joined
+	encryptedData, err := keyA.Encrypt([]byte("secret"), keyB)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, err = client.Storage.CompletePairing(pairingCode.ID, encryptedData, signingKey); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 409 {
+		t.Fatalf("expected completing an unjoined session to fail with 409, got %d", code)
+	}
+
+	// codes are case-insensitive
+	if resp, err = client.Storage.JoinPairing(strings.ToLower(pairingCode.Code), keyB); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 0 {
+		t.Fatalf("expected joining to succeed, got %d", code)
+	}
+
+	if session := getSession(resp); !bytes.Equal(session.ID, pairingCode.ID) || !bytes.Equal(session.PublicKey, keyA.PublicKey) {
+		t.Fatalf("expected the session of the first device")
+	}
+
+	if data, err := resp.Bytes(); err != nil {
+		t.Fatal(err)
+	} else if bytes.Contains(data, []byte("signingKey")) {
+		t.Fatalf("expected the signing key of the first device to be hidden")
+	}
+
+	// codes can only be used once
+	if resp, err = client.Storage.JoinPairing(pairingCode.Code, keyA); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 404 {
+		t.Fatalf("expected a used code to fail with 404, got %d", code)
+	}
+
+	if resp, err = client.Storage.GetPairing(pairingCode.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first device encrypts the data for the second one
+	session := getSession(resp)
+
+	if encryptedData, err = keyA.Encrypt([]byte("secret"), &crypto.Key{PublicKey: session.PeerPublicKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the device that created the session can complete it
+	if resp, err = client.Storage.CompletePairing(pairingCode.ID, encryptedData, otherSigningKey); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 403 {
+		t.Fatalf("expected completing the session with another key to fail with 403, got %d", code)
+	}
+
+	if resp, err = client.Storage.CompletePairing(pairingCode.ID, encryptedData, signingKey); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 0 {
+		t.Fatalf("expected completing the session to succeed, got %d", code)
+	}
+
+	if resp, err = client.Storage.CompletePairing(pairingCode.ID, encryptedData, signingKey); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 409 {
+		t.Fatalf("expected completing the session twice to fail with 409, got %d", code)
+	}
+
+	if resp, err = client.Storage.GetPairing(pairingCode.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	session = getSession(resp)
+
+	if session.EncryptedData == nil {
+		t.Fatalf("expected encrypted data")
+	}
+
+	if data, err := keyB.Decrypt(session.EncryptedData); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "secret" {
+		t.Fatalf("expected the secret, got '%s'", string(data))
+	}
+
+}
+
+func TestPairingAttempts(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the storage API
+		at.FC{af.StorageServer{}, "storageServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	settings := fixtures["settings"].(*services.Settings)
+
+	// the storage server uses the same settings object
+	settings.Storage.MaxPairingAttempts = 2
+
+	key, err := crypto.GenerateWebKey("a", "ecdh")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signingKey, err := crypto.GenerateWebKey("signing", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Storage.CreatePairing(key, signingKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pairingCode := &services.PairingCode{}
+
+	if err := resp.CoerceResult(pairingCode, &forms.PairingCodeForm); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if resp, err = client.Storage.JoinPairing("0000-0000", key); err != nil {
+			t.Fatal(err)
+		} else if code := errorCode(t, resp); code != 404 {
+			t.Fatalf("expected an invalid code to fail with 404, got %d", code)
+		}
+	}
+
+	// once the attempts are used up, even valid codes are rejected
+	if resp, err = client.Storage.JoinPairing(pairingCode.Code, key); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 429 {
+		t.Fatalf("expected further attempts to fail with 429, got %d", code)
+	}
+
+}
@@ -0,0 +1,108 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
+	"strings"
+	"time"
+)
+
+// we leave out characters that are easily confused (0/O, 1/I)
+const pairingCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+const pairingCodeLength = 8
+
+// Generates a random pairing code. As the alphabet has 32 characters, taking
+// the random bytes modulo its length doesn't introduce a bias.
+func generatePairingCode() (string, error) {
+
+	randomBytes, err := crypto.RandomBytes(pairingCodeLength)
+
+	if err != nil {
+		return "", err
+	}
+
+	code := make([]byte, pairingCodeLength)
+
+	for i, b := range randomBytes {
+		code[i] = pairingCodeAlphabet[int(b)%len(pairingCodeAlphabet)]
+	}
+
+	return string(code), nil
+}
+
+// Formats a pairing code for display, e.g. "ABCD-EFGH"
+func formatPairingCode(code string) string {
+	return code[:pairingCodeLength/2] + "-" + code[pairingCodeLength/2:]
+}
+
+// Normalizes a pairing code entered by a user
+func normalizePairingCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(code))
+}
+
+func (c *Storage) lockPairing(id []byte) (services.Lock, error) {
+	return c.db.Lock(fmt.Sprintf("lock::pairing::%s", hex.EncodeToString(id)))
+}
+
+// Returns the pairing session with the given ID, or nil if it doesn't exist
+// or has expired.
+func (c *Storage) getPairingSession(id []byte) (*services.PairingSession, error) {
+
+	data, err := c.db.Value("pairings", id).Get()
+
+	if err == databases.NotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	session := &services.PairingSession{}
+
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, err
+	}
+
+	if !time.Now().Before(session.ExpiresAt) {
+		return nil, nil
+	}
+
+	return session, nil
+}
+
+// Stores the given pairing session until it expires.
+func (c *Storage) savePairingSession(session *services.PairingSession) error {
+
+	ttl := time.Until(session.ExpiresAt)
+
+	if ttl <= 0 {
+		return fmt.Errorf("pairing session has expired")
+	}
+
+	if data, err := json.Marshal(session); err != nil {
+		return err
+	} else {
+		return c.db.Value("pairings", session.ID).Set(data, ttl)
+	}
+}
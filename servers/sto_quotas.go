@@ -0,0 +1,171 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+	"time"
+)
+
+// The sets that track the records owned by a key, by the table that the
+// records are stored in. Settings and blobs count against the same limit.
+var ownedRecordSets = map[string]string{
+	"settingsRecords": "storageOwners",
+	"blobs":           "storageBlobOwners",
+}
+
+// Counts a write against the quota of the given key or IP address and
+// returns false if the quota is exhausted for the current quota window.
+func (c *Storage) withinQuota(kind string, subject []byte, quota int64) (bool, error) {
+
+	key := append([]byte(kind+"::"), subject...)
+
+	counter := c.db.Integer("storageQuotas", key)
+
+	n, err := counter.IncrBy(1)
+
+	if err != nil {
+		return false, err
+	}
+
+	// the first write opens a new quota window. We check the TTL instead of
+	// the count so that a window whose expiry couldn't be set is repaired by
+	// the next write, instead of never expiring.
+	if ttl, err := counter.TTL(); err != nil && err != databases.NotFound {
+		return false, err
+	} else if err == nil && ttl == 0 {
+		if err := c.db.Expire("storageQuotas", key, time.Duration(c.settings.QuotaWindowMinutes)*time.Minute); err != nil {
+			return false, err
+		}
+	}
+
+	return n <= quota, nil
+}
+
+// Returns how much of the quota of the given key or IP address has been used
+// in the current quota window.
+func (c *Storage) quotaUsed(kind string, subject []byte) (int64, error) {
+	if n, err := c.db.Integer("storageQuotas", append([]byte(kind+"::"), subject...)).Get(); err == databases.NotFound {
+		return 0, nil
+	} else {
+		return n, err
+	}
+}
+
+// Locks the records owned by the given key, which makes sure that the limit
+// check and the creation of a new record happen atomically.
+func (c *Storage) lockOwnedRecords(publicKey []byte) (services.Lock, error) {
+	return c.db.Lock(fmt.Sprintf("lock::storageOwners::%s", hex.EncodeToString(publicKey)))
+}
+
+// Returns the number of settings records and blobs owned by the given key.
+func (c *Storage) countOwnedRecords(publicKey []byte) (int64, error) {
+	var n int64
+	for table := range ownedRecordSets {
+		if ids, err := c.ownedRecords(table, publicKey); err != nil {
+			return 0, err
+		} else {
+			n += int64(len(ids))
+		}
+	}
+	return n, nil
+}
+
+// Returns the IDs of the records in the given table that are owned by the
+// given key. Records that have expired in the meantime are no longer counted.
+func (c *Storage) ownedRecords(table string, publicKey []byte) ([][]byte, error) {
+
+	owned := c.db.Set(ownedRecordSets[table], publicKey)
+
+	members, err := owned.Members()
+
+	if err != nil && err != databases.NotFound {
+		return nil, err
+	}
+
+	ids := make([][]byte, 0, len(members))
+
+	for _, member := range members {
+		if _, err := c.db.Value(table, member.Data).Get(); err == databases.NotFound {
+			if err := owned.Del(member.Data); err != nil {
+				return nil, err
+			}
+		} else if err != nil {
+			return nil, err
+		} else {
+			ids = append(ids, member.Data)
+		}
+	}
+
+	return ids, nil
+}
+
+// Adds the given record to the records in the given table that are owned by
+// the given key.
+func (c *Storage) addOwnedRecord(table string, publicKey, id []byte) error {
+	if err := c.db.Set(ownedRecordSets[table], publicKey).Add(id); err != nil {
+		return err
+	}
+	return c.touchOwnedRecords(publicKey)
+}
+
+// Extends the lifetime of the records owned by the given key. This needs to
+// happen on every write, as records live for the settings TTL after their
+// last write and the sets have to outlive them.
+func (c *Storage) touchOwnedRecords(publicKey []byte) error {
+	for _, set := range ownedRecordSets {
+		if err := c.db.Expire(set, publicKey, c.settingsTTL()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Records the number of bytes and records that were stored.
+func (c *Storage) meterStorage(bytes, records int64) {
+
+	if c.meter == nil {
+		return
+	}
+
+	now := time.Now().UTC().UnixNano()
+
+	for name, value := range map[string]int64{
+		"bytes":   bytes,
+		"records": records,
+	} {
+
+		if value == 0 {
+			continue
+		}
+
+		for _, twt := range tws {
+
+			// generate the time window
+			tw := twt(now)
+
+			if err := c.meter.Add("storage", name, map[string]string{}, tw, value); err != nil {
+				services.Log.Error(err)
+			}
+		}
+	}
+}
@@ -25,13 +25,130 @@ import (
 )
 
 // store the settings in the database by ID
-func (c *Storage) storeSettings(context services.Context, params *services.StoreSettingsParams) services.Response {
-	value := c.db.Value("settings", params.ID)
-	if dv, err := json.Marshal(params.Data); err != nil {
+func (c *Storage) storeSettings(context services.Context, params *services.StoreSettingsSignedParams) services.Response {
+
+	data, err := json.Marshal(params.Data.Data)
+
+	if err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
-	} else if err := value.Set(dv, time.Duration(c.settings.SettingsTTLDays*24)*time.Hour); err != nil {
+	}
+
+	if int64(len(data)) > c.settings.MaxDataSize {
+		return context.Error(413, "data too large", nil)
+	}
+
+	// we check the IP quota first so that unsigned requests count as well
+	if ok, err := c.withinQuota("ip", []byte(context.ClientIP()), c.settings.IPWriteQuota); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return context.Error(429, "quota exceeded", nil)
+	}
+
+	if resp := c.isSigned(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		return resp
+	}
+
+	// only signed requests count against the quota of the key, as otherwise
+	// anyone could exhaust it
+	if ok, err := c.withinQuota("key", params.PublicKey, c.settings.KeyWriteQuota); err != nil {
+		services.Log.Error(err)
 		return context.InternalError()
+	} else if !ok {
+		return context.Error(429, "quota exceeded", nil)
 	}
-	return context.Acknowledge()
+
+	if lock, err := c.lockSettings(params.Data.ID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		defer release(lock)
+	}
+
+	record, err := c.getRecord(params.Data.ID)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if resp := c.canModify(context, record, params.PublicKey, params.Data.Version); resp != nil {
+		return resp
+	}
+
+	// anyone who knows the ID of settings stored before records were bound
+	// to keys can claim them, so we limit how many claims an IP address can
+	// make to prevent scanning for such settings
+	if record.PublicKey == nil && record.Data != nil {
+		if ok, err := c.withinQuota("claim", []byte(context.ClientIP()), c.settings.ClaimQuota); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		} else if !ok {
+			return context.Error(429, "quota exceeded", nil)
+		}
+	}
+
+	var newRecords int64
+
+	// new records count against the limit of the key, for existing ones we
+	// only extend the lifetime of the set of records owned by the key
+	if record.PublicKey == nil {
+
+		if lock, err := c.lockOwnedRecords(params.PublicKey); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		} else {
+			defer release(lock)
+		}
+
+		if n, err := c.countOwnedRecords(params.PublicKey); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		} else if n >= c.settings.MaxRecordsPerKey {
+			return context.Error(429, "too many records", nil)
+		}
+
+		if err := c.addOwnedRecord("settingsRecords", params.PublicKey, params.Data.ID); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+
+		newRecords = 1
+	} else if err := c.touchOwnedRecords(params.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	record.PublicKey = params.PublicKey
+	record.Version++
+	record.Data = params.Data.Data
+
+	if recordData, err := json.Marshal(record); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if err := c.db.Value("settingsRecords", params.Data.ID).Set(recordData, c.settingsTTL()); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// settings stored before records were bound to keys are replaced
+	if err := c.db.Value("settings", params.Data.ID).Del(); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	c.meterStorage(int64(len(data)), newRecords)
+
+	expiresAt := time.Now().Add(c.settingsTTL()).UTC()
+
+	return context.Result(&services.SettingsVersion{
+		Version:   record.Version,
+		ExpiresAt: &expiresAt,
+	})
 }
@@ -0,0 +1,133 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"github.com/kiebitz-oss/services"
+	"sort"
+)
+
+// Stores a chunk of a blob. Chunks can be uploaded in any order and uploaded
+// again until the blob is finalized, which allows clients to resume uploads.
+func (c *Storage) uploadBlobChunk(context services.Context, params *services.UploadBlobChunkSignedParams) services.Response {
+
+	if ok, err := c.withinQuota("ip", []byte(context.ClientIP()), c.settings.IPWriteQuota); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return context.Error(429, "quota exceeded", nil)
+	}
+
+	if resp := c.isSigned(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		return resp
+	}
+
+	if lock, err := c.lockBlob(params.Data.ID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		defer release(lock)
+	}
+
+	manifest, err := c.getBlobManifest(params.Data.ID)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if resp := c.canModifyBlob(context, manifest, params.PublicKey); resp != nil {
+		return resp
+	}
+
+	if manifest.Complete {
+		return context.Error(409, "upload already finalized", nil)
+	}
+
+	// creating the blob counted against the write quota of the key, so its
+	// chunks don't, as otherwise large blobs could never be uploaded. To
+	// bound the writes we allow each chunk to be uploaded twice (e.g. to
+	// retry a failed upload) per quota window.
+	if ok, err := c.withinQuota("blob", manifest.ID, 2*manifest.NumChunks()); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return context.Error(429, "quota exceeded", nil)
+	}
+
+	if params.Data.Index >= manifest.NumChunks() {
+		return context.Error(400, "invalid chunk index", nil)
+	}
+
+	if int64(len(params.Data.Data)) != manifest.ChunkLength(params.Data.Index) {
+		return context.Error(400, "invalid chunk length", nil)
+	}
+
+	hash := sha256.Sum256(params.Data.Data)
+
+	if !bytes.Equal(hash[:], params.Data.Hash) {
+		return context.Error(400, "hash mismatch", nil)
+	}
+
+	if err := c.db.Value("blobChunks", blobChunkKey(manifest.ID, params.Data.Index)).Set(params.Data.Data, c.blobTTL()); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	chunks := []*services.BlobChunkHash{}
+
+	// chunks that are uploaded again replace the existing ones, so they
+	// don't add to the stored bytes
+	newBytes := int64(len(params.Data.Data))
+
+	for _, chunk := range manifest.Chunks {
+		if chunk.Index != params.Data.Index {
+			chunks = append(chunks, chunk)
+		} else {
+			newBytes = 0
+		}
+	}
+
+	chunks = append(chunks, &services.BlobChunkHash{
+		Index: params.Data.Index,
+		Hash:  params.Data.Hash,
+	})
+
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Index < chunks[j].Index })
+
+	manifest.Chunks = chunks
+
+	if err := c.saveBlobManifest(manifest); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	c.meterStorage(newBytes, 0)
+
+	manifest.PublicKey = nil
+
+	return context.Result(manifest)
+}
@@ -19,15 +19,23 @@
 package servers
 
 import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"github.com/kiebitz-oss/services"
 	"github.com/kiebitz-oss/services/api"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
 	"github.com/kiebitz-oss/services/forms"
+	"time"
 )
 
 type Storage struct {
 	*Server
 	settings *services.StorageSettings
 	db       services.Database
+	meter    services.Meter
 	test     bool
 }
 
@@ -36,20 +44,46 @@ func MakeStorage(settings *services.Settings) (*Storage, error) {
 	storage := &Storage{
 		db:       settings.DatabaseObj,
 		settings: settings.Storage,
+		meter:    settings.MeterObj,
 		test:     settings.Test,
 	}
 
-	api := &api.API{
+	// request bodies are limited before they are decoded, so that clients
+	// can't make us decode arbitrarily large payloads
+	maxBodySize := storageBodySize(settings.Storage)
+
+	if settings.Storage.JSONRPC != nil && settings.Storage.JSONRPC.MaxBodySize == 0 {
+		settings.Storage.JSONRPC.MaxBodySize = maxBodySize
+	}
+
+	if settings.Storage.REST != nil && settings.Storage.REST.MaxBodySize == 0 {
+		settings.Storage.REST.MaxBodySize = maxBodySize
+	}
+
+	var err error
+
+	if storage.Server, err = MakeServer("storage", settings.Storage.HTTP, settings.Storage.JSONRPC, settings.Storage.REST, settings.Appointments.Validate, storageAPI(storage)); err != nil {
+		return nil, err
+	}
+
+	return storage, nil
+
+}
+
+// Returns the API of the storage server, which is also used to generate the
+// OpenAPI specification (for which no database is required).
+func storageAPI(storage *Storage) *api.API {
+	return &api.API{
 		Version: 1,
 		Name:    "storage",
 		Endpoints: []*api.Endpoint{
 			{
 				Name:        "storeSettings",
-				Description: "Stores encrypted settings.",
+				Description: "Stores encrypted settings. The settings are bound to the key that stored them first, and can only be modified or deleted with that key. Writes are subject to size limits and quotas.",
 				Form:        &forms.StoreSettingsForm,
 				Handler:     storage.storeSettings,
 				ReturnType: &api.ReturnType{
-					Validators: forms.IsAcknowledgeRVV,
+					Validators: forms.StoreSettingsRVV,
 				},
 				REST: &api.REST{
 					Path:   "store",
@@ -58,9 +92,12 @@ func MakeStorage(settings *services.Settings) (*Storage, error) {
 			},
 			{
 				Name:        "getSettings",
-				Description: "Retrieves encrypted settings.",
+				Description: "Retrieves encrypted settings along with the time at which they expire. If the storage uses a sliding TTL, this extends the lifetime of the settings.",
 				Form:        &forms.GetSettingsForm,
 				Handler:     storage.getSettings,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetSettingsRVV,
+				},
 				REST: &api.REST{
 					Path:   "store/<id>",
 					Method: api.GET,
@@ -79,6 +116,136 @@ func MakeStorage(settings *services.Settings) (*Storage, error) {
 					Method: api.DELETE,
 				},
 			},
+			{
+				Name:        "createPairing",
+				Description: "Creates a pairing session through which another device can receive data, and returns a short code that the other device can join it with. The session is bound to the key that signed the request.",
+				Form:        &forms.CreatePairingForm,
+				Handler:     storage.createPairing,
+				ReturnType: &api.ReturnType{
+					Validators: forms.PairingCodeRVV,
+				},
+				REST: &api.REST{
+					Path:   "pairing",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "joinPairing",
+				Description: "Joins a pairing session with its code. Invalid codes are rate-limited.",
+				Form:        &forms.JoinPairingForm,
+				Handler:     storage.joinPairing,
+				ReturnType: &api.ReturnType{
+					Validators: forms.PairingSessionRVV,
+				},
+				REST: &api.REST{
+					Path:   "pairing/join",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "getPairing",
+				Description: "Returns the public keys and the encrypted data of a pairing session.",
+				Form:        &forms.GetPairingForm,
+				Handler:     storage.getPairing,
+				ReturnType: &api.ReturnType{
+					Validators: forms.PairingSessionRVV,
+				},
+				REST: &api.REST{
+					Path:   "pairing/<id>",
+					Method: api.GET,
+				},
+			},
+			{
+				Name:        "completePairing",
+				Description: "Sends data encrypted for the device that joined a pairing session. Only the key that created the session can complete it.",
+				Form:        &forms.CompletePairingForm,
+				Handler:     storage.completePairing,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "pairing/complete",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "createBlob",
+				Description: "Creates an upload session for an encrypted blob, which replaces any existing blob with the same ID. Blobs are bound to the key that created them.",
+				Form:        &forms.CreateBlobForm,
+				Handler:     storage.createBlob,
+				ReturnType: &api.ReturnType{
+					Validators: forms.BlobManifestRVV,
+				},
+				REST: &api.REST{
+					Path:   "blobs",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "uploadBlobChunk",
+				Description: "Uploads a chunk of a blob along with its SHA-256 hash. Chunks can be uploaded in any order and again until the upload is finalized.",
+				Form:        &forms.UploadBlobChunkForm,
+				Handler:     storage.uploadBlobChunk,
+				ReturnType: &api.ReturnType{
+					Validators: forms.BlobManifestRVV,
+				},
+				REST: &api.REST{
+					Path:   "blobs/chunks",
+					Method: api.PUT,
+				},
+			},
+			{
+				Name:        "finalizeBlob",
+				Description: "Finalizes the upload of a blob once all of its chunks have been uploaded.",
+				Form:        &forms.BlobForm,
+				Handler:     storage.finalizeBlob,
+				ReturnType: &api.ReturnType{
+					Validators: forms.BlobManifestRVV,
+				},
+				REST: &api.REST{
+					Path:   "blobs/finalize",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "getBlob",
+				Description: "Returns the manifest of a blob, which lists the hashes of the uploaded chunks.",
+				Form:        &forms.GetBlobForm,
+				Handler:     storage.getBlob,
+				ReturnType: &api.ReturnType{
+					Validators: forms.BlobManifestRVV,
+				},
+				REST: &api.REST{
+					Path:   "blobs/<id>",
+					Method: api.GET,
+				},
+			},
+			{
+				Name:        "getBlobChunk",
+				Description: "Returns a chunk of a finalized blob.",
+				Form:        &forms.GetBlobChunkForm,
+				Handler:     storage.getBlobChunk,
+				ReturnType: &api.ReturnType{
+					Validators: forms.BlobChunkRVV,
+				},
+				REST: &api.REST{
+					Path:   "blobs/<id>/chunks/<index>",
+					Method: api.GET,
+				},
+			},
+			{
+				Name:        "deleteBlob",
+				Description: "Deletes a blob.",
+				Form:        &forms.BlobForm,
+				Handler:     storage.deleteBlob,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "blobs",
+					Method: api.DELETE,
+				},
+			},
 			{
 				Name:        "resetDB",
 				Description: "Resets the database. Only enabled for test deployments.",
@@ -94,17 +261,109 @@ func MakeStorage(settings *services.Settings) (*Storage, error) {
 			},
 		},
 	}
+}
 
-	var err error
+// Returns the maximum size of a request body, which needs to fit the largest
+// payload (settings data or a blob chunk). The payload is embedded in the
+// signed data as an escaped string and chunks are base64-encoded, so we
+// allow twice its size along with some room for the signature and keys.
+func storageBodySize(settings *services.StorageSettings) int64 {
+	payload := settings.MaxDataSize
+	if settings.BlobChunkSize > payload {
+		payload = settings.BlobChunkSize
+	}
+	return 2*payload + 64*1024
+}
+
+// Returns the OpenAPI specification of the storage server
+func StorageSpec() *api.Spec {
+	return storageAPI(&Storage{}).OpenAPI()
+}
+
+func (c *Storage) isRoot(context services.Context, params *services.SignedParams) services.Response {
+	return isRoot(context, c.db, []byte(params.JSON), params.Signature, params.Timestamp, c.settings.Keys)
+}
+
+// Checks that the request has been signed with the given key and hasn't been
+// processed before.
+func (c *Storage) isSigned(context services.Context, params *services.SignedParams) services.Response {
+	if ok, err := crypto.VerifyWithBytes([]byte(params.JSON), params.Signature, params.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return context.Error(403, "invalid signature", nil)
+	}
+	return isFresh(context, c.db, []byte(params.JSON), params.PublicKey, params.Timestamp)
+}
+
+// Checks that the record may be modified by the given key and that it hasn't
+// been modified since the client fetched the given version.
+func (c *Storage) canModify(context services.Context, record *services.SettingsRecord, publicKey []byte, version int64) services.Response {
+	// records without an owner are claimed by the first signed write, which
+	// has to be based on their version (which is always 0 for settings
+	// stored before records were bound to keys)
+	if record.PublicKey != nil && !bytes.Equal(record.PublicKey, publicKey) {
+		return context.Error(403, "not authorized", nil)
+	}
+	if record.Version != version {
+		return context.Error(409, "version conflict", &services.SettingsVersion{Version: record.Version})
+	}
+	return nil
+}
 
-	if storage.Server, err = MakeServer("storage", settings.Storage.HTTP, settings.Storage.JSONRPC, settings.Storage.REST, settings.Appointments.Validate, api); err != nil {
+// Locks the settings with the given ID, which makes sure that the version
+// check and the write happen atomically.
+func (c *Storage) lockSettings(id []byte) (services.Lock, error) {
+	return c.db.Lock(fmt.Sprintf("lock::settings::%s", hex.EncodeToString(id)))
+}
+
+// Returns the settings record with the given ID, or an empty record if no
+// settings have been stored yet. Settings stored before records were bound
+// to keys are returned as records without an owner.
+func (c *Storage) getRecord(id []byte) (*services.SettingsRecord, error) {
+
+	record := &services.SettingsRecord{}
+
+	value := c.db.Value("settingsRecords", id)
+
+	if data, err := value.Get(); err == nil {
+		if err := json.Unmarshal(data, record); err != nil {
+			return nil, err
+		}
+		record.ExpiresAt, err = expiresAt(value)
+		return record, err
+	} else if err != databases.NotFound {
 		return nil, err
 	}
 
-	return storage, nil
+	value = c.db.Value("settings", id)
+
+	if data, err := value.Get(); err == nil {
+		if record.Data, err = toInterface(data); err != nil {
+			return nil, err
+		}
+		record.ExpiresAt, err = expiresAt(value)
+		return record, err
+	} else if err != databases.NotFound {
+		return nil, err
+	}
 
+	return record, nil
 }
 
-func (c *Storage) isRoot(context services.Context, params *services.SignedParams) services.Response {
-	return isRoot(context, []byte(params.JSON), params.Signature, params.Timestamp, c.settings.Keys)
+// Returns the time at which the given value expires, or nil if it doesn't.
+func expiresAt(value services.Value) (*time.Time, error) {
+	if ttl, err := value.TTL(); err == databases.NotFound || (err == nil && ttl == 0) {
+		// the value may have expired since we read it
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else {
+		t := time.Now().Add(ttl).UTC()
+		return &t, nil
+	}
+}
+
+func (c *Storage) settingsTTL() time.Duration {
+	return time.Duration(c.settings.SettingsTTLDays*24) * time.Hour
 }
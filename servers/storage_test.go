@@ -0,0 +1,504 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"errors"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/client"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/forms"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreSettings(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the storage API
+		at.FC{af.StorageServer{}, "storageServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+
+	owner, err := crypto.GenerateWebKey("owner", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := crypto.GenerateWebKey("other", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := crypto.RandomBytes(32)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getVersion := func(resp *helpers.Response) int64 {
+		version := &services.SettingsVersion{}
+		if err := resp.CoerceResult(version, &forms.SettingsVersionForm); err != nil {
+			t.Fatal(err)
+		}
+		return version.Version
+	}
+
+	resp, err := client.Storage.StoreSettings(id, "first", 0, owner)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := errorCode(t, resp); code != 0 {
+		t.Fatalf("expected the first write to succeed, got %d", code)
+	}
+
+	if version := getVersion(resp); version != 1 {
+		t.Fatalf("expected version 1, got %d", version)
+	}
+
+	// another key can neither modify nor delete the record
+	if resp, err = client.Storage.StoreSettings(id, "stolen", 1, other); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 403 {
+		t.Fatalf("expected a write with another key to fail with 403, got %d", code)
+	}
+
+	if resp, err = client.Storage.DeleteSettings(id, 1, other); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 403 {
+		t.Fatalf("expected a delete with another key to fail with 403, got %d", code)
+	}
+
+	// a stale version is rejected
+	if resp, err = client.Storage.StoreSettings(id, "second", 0, owner); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 409 {
+		t.Fatalf("expected a write with a stale version to fail with 409, got %d", code)
+	}
+
+	if resp, err = client.Storage.StoreSettings(id, "second", 1, owner); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 0 {
+		t.Fatalf("expected the second write to succeed, got %d", code)
+	} else if version := getVersion(resp); version != 2 {
+		t.Fatalf("expected version 2, got %d", version)
+	}
+
+	if resp, err = client.Storage.GetSettings(id); err != nil {
+		t.Fatal(err)
+	}
+
+	record := &services.SettingsRecord{}
+
+	if err := resp.CoerceResult(record, &forms.SettingsRecordForm); err != nil {
+		t.Fatal(err)
+	}
+
+	if record.Version != 2 || record.Data != "second" {
+		t.Fatalf("unexpected record: %v", record)
+	}
+
+	if resp, err = client.Storage.DeleteSettings(id, 1, owner); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 409 {
+		t.Fatalf("expected a delete with a stale version to fail with 409, got %d", code)
+	}
+
+	if resp, err = client.Storage.DeleteSettings(id, 2, owner); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 0 {
+		t.Fatalf("expected the owner to be able to delete the record, got %d", code)
+	}
+
+	if resp, err = client.Storage.GetSettings(id); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 404 {
+		t.Fatalf("expected the record to be gone, got %d", code)
+	}
+
+}
+
+func TestClaimLegacySettings(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the storage API
+		at.FC{af.StorageServer{}, "storageServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	settings := fixtures["settings"].(*services.Settings)
+
+	// the storage server uses the same settings object
+	settings.Storage.ClaimQuota = 1
+
+	key, err := crypto.GenerateWebKey("owner", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([][]byte, 2)
+
+	// we store settings the way they were stored before records were bound
+	// to keys
+	for i := range ids {
+		if ids[i], err = crypto.RandomBytes(32); err != nil {
+			t.Fatal(err)
+		} else if err := settings.DatabaseObj.Value("settings", ids[i]).Set([]byte(`"legacy"`), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// records without an owner can't be deleted...
+	if resp, err := client.Storage.DeleteSettings(ids[0], 0, key); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 403 {
+		t.Fatalf("expected the delete to fail with 403, got %d", code)
+	}
+
+	// ...only claimed by a write based on version 0
+	if resp, err := client.Storage.StoreSettings(ids[0], "claimed", 1, key); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 409 {
+		t.Fatalf("expected a claim with the wrong version to fail with 409, got %d", code)
+	}
+
+	if resp, err := client.Storage.StoreSettings(ids[0], "claimed", 0, key); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 0 {
+		t.Fatalf("expected the claim to succeed, got %d", code)
+	}
+
+	// the number of claims per IP address is limited
+	if resp, err := client.Storage.StoreSettings(ids[1], "claimed", 0, key); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 429 {
+		t.Fatalf("expected the second claim to fail with 429, got %d", code)
+	}
+
+	// once claimed, the owner can delete the record
+	if resp, err := client.Storage.DeleteSettings(ids[0], 1, key); err != nil {
+		t.Fatal(err)
+	} else if code := errorCode(t, resp); code != 0 {
+		t.Fatalf("expected the owner to be able to delete the record, got %d", code)
+	}
+
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the storage API
+		at.FC{af.StorageServer{}, "storageServer"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := fixtures["settings"].(*services.Settings)
+
+	key, err := crypto.GenerateWebKey("owner", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := crypto.RandomBytes(32)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for transport, maxBodySize := range map[client.Transport]int64{
+		client.JSONRPC: settings.Storage.JSONRPC.MaxBodySize,
+		client.REST:    settings.Storage.REST.MaxBodySize,
+	} {
+
+		if maxBodySize == 0 {
+			t.Fatalf("expected the body size to be limited")
+		}
+
+		storageClient := client.MakeStorageClient(settings.Admin.Client.StorageEndpoint, &client.Options{
+			Transport: transport,
+		})
+
+		_, err := storageClient.StoreSettings(&services.StoreSettingsParams{
+			ID:   id,
+			Data: strings.Repeat("x", int(maxBodySize)),
+		}, key)
+
+		var apiErr *client.Error
+
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != 413 {
+			t.Fatalf("expected a 413 error, got %v", err)
+		}
+	}
+}
+
+func TestStorageQuotas(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the storage API
+		at.FC{af.StorageServer{}, "storageServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	settings := fixtures["settings"].(*services.Settings)
+
+	// the storage server uses the same settings object
+	settings.Storage.MaxDataSize = 16
+	settings.Storage.MaxRecordsPerKey = 2
+	settings.Storage.KeyWriteQuota = 6
+
+	key, err := crypto.GenerateWebKey("owner", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([][]byte, 3)
+
+	for i := range ids {
+		if ids[i], err = crypto.RandomBytes(32); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := func(id []byte, data string, version int64) int {
+		if resp, err := client.Storage.StoreSettings(id, data, version, key); err != nil {
+			t.Fatal(err)
+			return 0
+		} else {
+			return errorCode(t, resp)
+		}
+	}
+
+	if code := store(ids[0], "this is too much data", 0); code != 413 {
+		t.Fatalf("expected data that is too large to be rejected with 413, got %d", code)
+	}
+
+	for _, id := range ids[:2] {
+		if code := store(id, "data", 0); code != 0 {
+			t.Fatalf("expected the write to succeed, got %d", code)
+		}
+	}
+
+	// we pretend that setting the expiry of the quota window failed
+	counter := settings.DatabaseObj.Integer("storageQuotas", append([]byte("key::"), key.PublicKey...))
+
+	if n, err := counter.Get(); err != nil {
+		t.Fatal(err)
+	} else if err := counter.Set(n, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := store(ids[2], "data", 0); code != 429 {
+		t.Fatalf("expected a third record to be rejected with 429, got %d", code)
+	}
+
+	// the next write repairs the quota window
+	if ttl, err := counter.TTL(); err != nil {
+		t.Fatal(err)
+	} else if ttl <= 0 {
+		t.Fatalf("expected the quota window to expire, got %v", ttl)
+	}
+
+	// we pretend that the records were created a while ago
+	if err := settings.DatabaseObj.Expire("storageOwners", key.PublicKey, time.Millisecond*10); err != nil {
+		t.Fatal(err)
+	}
+
+	// existing records can still be updated...
+	if code := store(ids[0], "new data", 1); code != 0 {
+		t.Fatalf("expected the update to succeed, got %d", code)
+	}
+
+	time.Sleep(time.Millisecond * 20)
+
+	// ...which extends the lifetime of the records owned by the key
+	if code := store(ids[2], "data", 0); code != 429 {
+		t.Fatalf("expected a third record to still be rejected with 429, got %d", code)
+	}
+
+	if code := store(ids[0], "newer data", 2); code != 0 {
+		t.Fatalf("expected the update to succeed, got %d", code)
+	}
+
+	// ...until the write quota of the key is exhausted
+	if code := store(ids[0], "newest data", 3); code != 429 {
+		t.Fatalf("expected the write quota to be exhausted, got %d", code)
+	}
+
+}
+
+func TestSettingsTTL(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the storage API
+		at.FC{af.StorageServer{}, "storageServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	settings := fixtures["settings"].(*services.Settings)
+
+	// the storage server uses the same settings object
+	settings.Storage.SettingsTTLDays = 1
+	settings.Storage.SlidingSettingsTTL = false
+
+	key, err := crypto.GenerateWebKey("owner", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := crypto.RandomBytes(32)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// checks that the settings expire in about the given time
+	expectExpiry := func(expiresAt *time.Time, ttl time.Duration) {
+		if expiresAt == nil {
+			t.Fatalf("expected an expiry time")
+		} else if remaining := time.Until(*expiresAt); remaining > ttl || remaining < ttl-time.Minute {
+			t.Fatalf("expected the settings to expire in %v, got %v", ttl, remaining)
+		}
+	}
+
+	getRecord := func() *services.SettingsRecord {
+		resp, err := client.Storage.GetSettings(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		record := &services.SettingsRecord{}
+		if err := resp.CoerceResult(record, &forms.SettingsRecordForm); err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	resp, err := client.Storage.StoreSettings(id, "data", 0, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version := &services.SettingsVersion{}
+
+	if err := resp.CoerceResult(version, &forms.SettingsVersionForm); err != nil {
+		t.Fatal(err)
+	}
+
+	expectExpiry(version.ExpiresAt, 24*time.Hour)
+
+	// we pretend that the settings were stored a while ago
+	if err := settings.DatabaseObj.Expire("settingsRecords", id, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// without a sliding TTL, reading the settings doesn't extend it
+	expectExpiry(getRecord().ExpiresAt, time.Hour)
+	expectExpiry(getRecord().ExpiresAt, time.Hour)
+
+	settings.Storage.SlidingSettingsTTL = true
+
+	expectExpiry(getRecord().ExpiresAt, 24*time.Hour)
+
+	if ttl, err := settings.DatabaseObj.Value("settingsRecords", id).TTL(); err != nil {
+		t.Fatal(err)
+	} else if ttl < 23*time.Hour {
+		t.Fatalf("expected the TTL to be extended, got %v", ttl)
+	}
+
+}
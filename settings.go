@@ -20,6 +20,7 @@ package services
 
 import (
 	"github.com/kiebitz-oss/services/crypto"
+	"time"
 )
 
 type RPCSettings struct {
@@ -27,15 +28,30 @@ type RPCSettings struct {
 }
 
 type StorageSettings struct {
-	Keys            []*crypto.Key          `json:"keys,omitempty"`
-	SettingsTTLDays int64                  `json:"settings_ttl_days"`
-	HTTP            *HTTPServerSettings    `json:"http,omitempty"`
-	JSONRPC         *JSONRPCServerSettings `json:"jsonrpc,omitempty"`
-	REST            *RESTServerSettings    `json:"rest,omitempty"`
+	Keys               []*crypto.Key          `json:"keys,omitempty"`
+	SettingsTTLDays    int64                  `json:"settings_ttl_days"`
+	SlidingSettingsTTL bool                   `json:"sliding_settings_ttl"`
+	MaxDataSize        int64                  `json:"max_data_size"`
+	MaxRecordsPerKey   int64                  `json:"max_records_per_key"`
+	KeyWriteQuota      int64                  `json:"key_write_quota"`
+	IPWriteQuota       int64                  `json:"ip_write_quota"`
+	ClaimQuota         int64                  `json:"claim_quota"`
+	QuotaWindowMinutes int64                  `json:"quota_window_minutes"`
+	PairingTTLMinutes  int64                  `json:"pairing_ttl_minutes"`
+	MaxPairingAttempts int64                  `json:"max_pairing_attempts"`
+	BlobChunkSize      int64                  `json:"blob_chunk_size"`
+	MaxBlobSize        int64                  `json:"max_blob_size"`
+	MaxBlobBytesPerKey int64                  `json:"max_blob_bytes_per_key"`
+	HTTP               *HTTPServerSettings    `json:"http,omitempty"`
+	JSONRPC            *JSONRPCServerSettings `json:"jsonrpc,omitempty"`
+	REST               *RESTServerSettings    `json:"rest,omitempty"`
 }
 
 type AppointmentsSettings struct {
 	DataTTLDays              int64                  `json:"data_ttl_days,omitempty"`
+	TokenTTLDays             int64                  `json:"token_ttl_days"`
+	RetentionIntervalMinutes int64                  `json:"retention_interval_minutes"`
+	SeriesHorizonDays        int64                  `json:"series_horizon_days"`
 	HTTP                     *HTTPServerSettings    `json:"http,omitempty"`
 	REST                     *RESTServerSettings    `json:"rest,omitempty"`
 	JSONRPC                  *JSONRPCServerSettings `json:"jsonrpc,omitempty"`
@@ -56,19 +72,43 @@ func (a *AppointmentsSettings) Key(name string) *crypto.Key {
 	return Key(a.Keys, name)
 }
 
+func (a *AppointmentsSettings) ValidKeys(name string) []*crypto.Key {
+	return ValidKeys(a.Keys, name)
+}
+
+// Returns the current version of the named key, which is the currently valid
+// version that became valid most recently. This is the key that should be
+// used for signing, while all valid versions can be used for verification.
 func Key(keys []*crypto.Key, name string) *crypto.Key {
+	var current *crypto.Key
+	for _, key := range ValidKeys(keys, name) {
+		if current == nil || (key.ValidFrom != nil && (current.ValidFrom == nil || key.ValidFrom.After(*current.ValidFrom))) {
+			current = key
+		}
+	}
+	return current
+}
+
+// Returns all versions of the named key that are currently valid
+func ValidKeys(keys []*crypto.Key, name string) []*crypto.Key {
+	validKeys := []*crypto.Key{}
+	now := time.Now()
 	for _, key := range keys {
-		if key.Name == name {
-			return key
+		if key.Name == name && key.ValidAt(now) {
+			validKeys = append(validKeys, key)
 		}
 	}
-	return nil
+	return validKeys
 }
 
 func (s *SigningSettings) Key(name string) *crypto.Key {
 	return Key(s.Keys, name)
 }
 
+func (s *SigningSettings) ValidKeys(name string) []*crypto.Key {
+	return ValidKeys(s.Keys, name)
+}
+
 type SigningSettings struct {
 	Keys []*crypto.Key `json:"keys"`
 }
@@ -126,14 +166,19 @@ type CorsSettings struct {
 
 // Settings for the JSON-RPC server
 type JSONRPCServerSettings struct {
-	Cors *CorsSettings       `json:"cors,omitempty"`
-	HTTP *HTTPServerSettings `json:"http,omitempty"`
+	Cors         *CorsSettings       `json:"cors,omitempty"`
+	HTTP         *HTTPServerSettings `json:"http,omitempty"`
+	MaxBatchSize int64               `json:"max_batch_size"`
+	// the maximum size of a request body in bytes (0 means no limit)
+	MaxBodySize int64 `json:"max_body_size"`
 }
 
 // Settings for the REST server
 type RESTServerSettings struct {
 	Cors *CorsSettings       `json:"cors,omitempty"`
 	HTTP *HTTPServerSettings `json:"http,omitempty"`
+	// the maximum size of a request body in bytes (0 means no limit)
+	MaxBodySize int64 `json:"max_body_size"`
 }
 
 // Settings for the appointments server validator
@@ -142,6 +187,36 @@ type ValidateSettings struct {
 	AnonMaxTimeWindow           int64    `json:"anon_max_time_window"` 
 	AnonAggregatedMaxTimeWindow int64    `json:"anon_aggregated_max_time_window"` 
 	ProviderMaxTimeWindow       int64    `json:"provider_max_time_window"` 
+	WaitlistMaxTimeWindow       int64    `json:"waitlist_max_time_window"`
+	// the schema of appointment properties (replaces 'vaccines' if given)
+	Properties []*PropertySchema `json:"properties,omitempty"`
+}
+
+// Returns the schema of appointment properties. If no properties are
+// configured we fall back to a required 'vaccine' property with the
+// configured vaccines as values.
+func (v *ValidateSettings) PropertySchemas() []*PropertySchema {
+	if len(v.Properties) > 0 {
+		return v.Properties
+	}
+	return []*PropertySchema{
+		{
+			Name:     "vaccine",
+			Type:     "enum",
+			Required: true,
+			Values:   v.Vaccines,
+		},
+	}
+}
+
+// Describes a property that providers can set on appointments.
+type PropertySchema struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"` // "enum", "boolean" or "integer"
+	Required bool     `json:"required"`
+	Values   []string `json:"values,omitempty"` // for "enum" properties
+	Min      *int64   `json:"min,omitempty"`    // for "integer" properties (optional)
+	Max      *int64   `json:"max,omitempty"`    // for "integer" properties (optional)
 }
 
 type HTTPServerSettings struct {
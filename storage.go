@@ -18,15 +18,211 @@
 
 package services
 
+import (
+	"github.com/kiebitz-oss/services/crypto"
+	"time"
+)
+
+// StoreSettings
+
+type StoreSettingsSignedParams struct {
+	JSON      string               `json:"data" coerce:"name:json"`
+	Data      *StoreSettingsParams `json:"-" coerce:"name:data"`
+	Signature []byte               `json:"signature"`
+	PublicKey []byte               `json:"publicKey"`
+}
+
+type StoreSettingsParams struct {
+	Timestamp time.Time   `json:"timestamp"`
+	ID        []byte      `json:"id"`
+	Data      interface{} `json:"data"`
+	// the version of the record that is replaced (0 for new records)
+	Version int64 `json:"version"`
+}
+
+// GetSettings
+
+type GetSettingsParams struct {
+	ID []byte `json:"id"`
+}
+
+// DeleteSettings
+
+type DeleteSettingsSignedParams struct {
+	JSON      string                `json:"data" coerce:"name:json"`
+	Data      *DeleteSettingsParams `json:"-" coerce:"name:data"`
+	Signature []byte                `json:"signature"`
+	PublicKey []byte                `json:"publicKey"`
+}
+
 type DeleteSettingsParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	ID        []byte    `json:"id"`
+	// the version of the record that is deleted
+	Version int64 `json:"version"`
+}
+
+// A settings record, which is bound to the public key that stored it first.
+// The version is incremented with every write, which allows clients to detect
+// concurrent modifications.
+type SettingsRecord struct {
+	PublicKey []byte      `json:"publicKey,omitempty"`
+	Version   int64       `json:"version"`
+	Data      interface{} `json:"data"`
+	// when the settings will be deleted unless they are stored (or, with a
+	// sliding TTL, read) again
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type SettingsVersion struct {
+	Version   int64      `json:"version"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Pairing
+
+// A short-lived session through which two devices exchange ECDH public keys,
+// which allows the first device to send data encrypted for the second one.
+type PairingSession struct {
 	ID []byte `json:"id"`
+	// the ECDH public key of the device that created the session
+	PublicKey []byte `json:"publicKey"`
+	// the ECDH public key of the device that joined the session
+	PeerPublicKey []byte                    `json:"peerPublicKey,omitempty"`
+	EncryptedData *crypto.ECDHEncryptedData `json:"encryptedData,omitempty"`
+	ExpiresAt     time.Time                 `json:"expiresAt"`
+	// the signing key of the device that created the session, which is the
+	// only one that may complete it
+	SigningKey []byte `json:"signingKey,omitempty"`
 }
 
-type GetSettingsParams struct {
+type CreatePairingSignedParams struct {
+	JSON      string               `json:"data" coerce:"name:json"`
+	Data      *CreatePairingParams `json:"-" coerce:"name:data"`
+	Signature []byte               `json:"signature"`
+	PublicKey []byte               `json:"publicKey"`
+}
+
+type CreatePairingParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	PublicKey []byte    `json:"publicKey"`
+}
+
+type PairingCode struct {
+	ID        []byte    `json:"id"`
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type JoinPairingParams struct {
+	Code      string `json:"code"`
+	PublicKey []byte `json:"publicKey"`
+}
+
+type GetPairingParams struct {
 	ID []byte `json:"id"`
 }
 
-type StoreSettingsParams struct {
-	ID   []byte      `json:"id"`
-	Data interface{} `json:"data"`
+type CompletePairingSignedParams struct {
+	JSON      string                 `json:"data" coerce:"name:json"`
+	Data      *CompletePairingParams `json:"-" coerce:"name:data"`
+	Signature []byte                 `json:"signature"`
+	PublicKey []byte                 `json:"publicKey"`
+}
+
+type CompletePairingParams struct {
+	Timestamp     time.Time                 `json:"timestamp"`
+	ID            []byte                    `json:"id"`
+	EncryptedData *crypto.ECDHEncryptedData `json:"encryptedData"`
+}
+
+// Blobs
+
+// The manifest of a blob, which is uploaded in fixed-size chunks that are
+// encrypted by the client. The manifest lists the SHA-256 hash of every chunk
+// that has been uploaded, which allows clients to resume uploads and to
+// verify the chunks they download.
+type BlobManifest struct {
+	ID        []byte           `json:"id"`
+	PublicKey []byte           `json:"publicKey,omitempty"`
+	Size      int64            `json:"size"`
+	ChunkSize int64            `json:"chunkSize"`
+	Chunks    []*BlobChunkHash `json:"chunks"`
+	Complete  bool             `json:"complete"`
+	// the SHA-256 hash of the concatenated chunk hashes (once complete)
+	Hash []byte `json:"hash,omitempty"`
+}
+
+// Returns the number of chunks of the blob
+func (b *BlobManifest) NumChunks() int64 {
+	return (b.Size + b.ChunkSize - 1) / b.ChunkSize
+}
+
+// Returns the expected length of the chunk with the given index
+func (b *BlobManifest) ChunkLength(index int64) int64 {
+	if remaining := b.Size - index*b.ChunkSize; remaining < b.ChunkSize {
+		return remaining
+	}
+	return b.ChunkSize
+}
+
+type BlobChunkHash struct {
+	Index int64  `json:"index"`
+	Hash  []byte `json:"hash"`
+}
+
+type BlobChunk struct {
+	Index int64  `json:"index"`
+	Data  []byte `json:"data"`
+	Hash  []byte `json:"hash"`
+}
+
+type CreateBlobSignedParams struct {
+	JSON      string            `json:"data" coerce:"name:json"`
+	Data      *CreateBlobParams `json:"-" coerce:"name:data"`
+	Signature []byte            `json:"signature"`
+	PublicKey []byte            `json:"publicKey"`
+}
+
+type CreateBlobParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	ID        []byte    `json:"id"`
+	Size      int64     `json:"size"`
+}
+
+type UploadBlobChunkSignedParams struct {
+	JSON      string                 `json:"data" coerce:"name:json"`
+	Data      *UploadBlobChunkParams `json:"-" coerce:"name:data"`
+	Signature []byte                 `json:"signature"`
+	PublicKey []byte                 `json:"publicKey"`
+}
+
+type UploadBlobChunkParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	ID        []byte    `json:"id"`
+	Index     int64     `json:"index"`
+	Data      []byte    `json:"data"`
+	Hash      []byte    `json:"hash"`
+}
+
+// used by finalizeBlob and deleteBlob
+type BlobSignedParams struct {
+	JSON      string      `json:"data" coerce:"name:json"`
+	Data      *BlobParams `json:"-" coerce:"name:data"`
+	Signature []byte      `json:"signature"`
+	PublicKey []byte      `json:"publicKey"`
+}
+
+type BlobParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	ID        []byte    `json:"id"`
+}
+
+type GetBlobParams struct {
+	ID []byte `json:"id"`
+}
+
+type GetBlobChunkParams struct {
+	ID    []byte `json:"id"`
+	Index int64  `json:"index"`
 }
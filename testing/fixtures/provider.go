@@ -65,6 +65,7 @@ func (c Provider) Setup(fixtures map[string]interface{}) (interface{}, error) {
 			City:        c.City,
 			ZipCode:     c.ZipCode,
 			Description: c.Description,
+			Accessible:  c.Accessible,
 		},
 		QueueData: &services.ProviderQueueData{
 			ZipCode:    c.ZipCode,
@@ -97,9 +97,14 @@ func (c ProvidersAndAppointments) Setup(fixtures map[string]interface{}) (interf
 		}(i)
 	}
 
-	// we wait for the remaining work to be done
+	// we wait for the remaining work to be done (we can only fill the
+	// channel once all workers have released their slot)
 	for i := int64(0); i < c.Concurrency; i++ {
-		<-workChannels
+		workChannels <- true
+	}
+
+	if workerErr != nil {
+		return nil, workerErr
 	}
 
 	return providersAndAppointments, nil
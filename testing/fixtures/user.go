@@ -17,3 +17,53 @@
 // along with this program.  If not, see <https://www.gnu.org/licenses/>.
 
 package fixtures
+
+import (
+	"fmt"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/forms"
+	"github.com/kiebitz-oss/services/helpers"
+)
+
+type User struct {
+}
+
+// Creates a new user and obtains a token for it
+func (c User) Setup(fixtures map[string]interface{}) (interface{}, error) {
+
+	client, ok := fixtures["client"].(*helpers.Client)
+
+	if !ok {
+		return nil, fmt.Errorf("client missing")
+	}
+
+	actor, err := crypto.MakeActor("user")
+
+	if err != nil {
+		return nil, err
+	}
+
+	user := &helpers.User{
+		Actor: actor,
+	}
+
+	signedTokenData := &services.SignedTokenData{}
+
+	if resp, err := client.Appointments.GetToken(user); err != nil {
+		return nil, err
+	} else if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("cannot get token")
+	} else if err := resp.CoerceResult(signedTokenData, &forms.SignedTokenDataForm); err != nil {
+		return nil, err
+	}
+
+	user.SignedTokenData = signedTokenData
+
+	return user, nil
+
+}
+
+func (c User) Teardown(fixture interface{}) error {
+	return nil
+}